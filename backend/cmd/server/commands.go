@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/expensesplit/backend/internal/database"
+	"github.com/expensesplit/backend/internal/repository"
+	"github.com/expensesplit/backend/internal/services"
+	"github.com/google/uuid"
+)
+
+// runCommand executes a one-off maintenance command given on the command
+// line instead of starting the HTTP server.
+func runCommand(name string, args []string, db *database.DB) error {
+	switch name {
+	case "import-rates":
+		if len(args) == 0 {
+			return errors.New("usage: server import-rates <file.csv|file.xml> [...]")
+		}
+		rateService := services.NewExchangeRateService(repository.NewExchangeRateRepository(db))
+		for _, path := range args {
+			count, err := rateService.ImportFile(path)
+			if err != nil {
+				return fmt.Errorf("failed to import %s: %w", path, err)
+			}
+			log.Printf("Imported %d exchange rates from %s", count, path)
+		}
+		return nil
+	case "rebuild-balances":
+		return rebuildBalances(args, db)
+	case "bench-queries":
+		if len(args) != 1 {
+			return errors.New("usage: server bench-queries <team-id>")
+		}
+		teamID, err := uuid.Parse(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid team ID %q", args[0])
+		}
+		return benchQueries(teamID, db)
+	default:
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
+
+// rebuildBalances recomputes the stored balances of the given teams, or of
+// all teams, and reports every balance that had drifted from its expenses
+// and settlements.
+func rebuildBalances(args []string, db *database.DB) error {
+	expenseRepo := repository.NewExpenseRepository(db)
+	balanceRepo := repository.NewBalanceRepository(db)
+	balanceService := services.NewBalanceService(db, expenseRepo, repository.NewTeamRepository(db),
+		repository.NewUserRepository(db), repository.NewSettlementRepository(db), balanceRepo,
+		repository.NewBalanceSnapshotRepository(db), repository.NewExpenseRevisionRepository(db), repository.NewAuditRepository(db))
+
+	var teamIDs []uuid.UUID
+	for _, arg := range args {
+		teamID, err := uuid.Parse(arg)
+		if err != nil {
+			return fmt.Errorf("usage: server rebuild-balances [team-id ...]: invalid team ID %q", arg)
+		}
+		teamIDs = append(teamIDs, teamID)
+	}
+	if len(teamIDs) == 0 {
+		var err error
+		if teamIDs, err = balanceRepo.GetAllTeamIDs(); err != nil {
+			return err
+		}
+	}
+
+	drifted := 0
+	for _, teamID := range teamIDs {
+		drift, err := balanceService.RebuildBalances(teamID)
+		if err != nil {
+			return fmt.Errorf("failed to rebuild balances of team %s: %w", teamID, err)
+		}
+		for _, d := range drift {
+			log.Printf("Team %s: %s owes %s %s, stored %s", teamID, d.FromUser, d.ToUser, d.Computed, d.Stored)
+		}
+		drifted += len(drift)
+	}
+	log.Printf("Rebuilt balances of %d teams, %d balances had drifted", len(teamIDs), drifted)
+	return nil
+}
+
+// benchQueries runs the service calls behind the team's heaviest read
+// requests once each and reports how many database queries and how much
+// time each of them took. Write requests are measured by the benchmarks of
+// the services package, which use a test database.
+func benchQueries(teamID uuid.UUID, db *database.DB) error {
+	expenseRepo := repository.NewExpenseRepository(db)
+	teamRepo := repository.NewTeamRepository(db)
+	userRepo := repository.NewUserRepository(db)
+	settlementRepo := repository.NewSettlementRepository(db)
+	balanceRepo := repository.NewBalanceRepository(db)
+	auditRepo := repository.NewAuditRepository(db)
+	categoryRepo := repository.NewCategoryRepository(db)
+	revisionRepo := repository.NewExpenseRevisionRepository(db)
+	teamService := services.NewTeamService(db, teamRepo, userRepo, auditRepo)
+	expenseService := services.NewExpenseService(db, expenseRepo, teamRepo, userRepo,
+		repository.NewApprovalRepository(db), auditRepo, revisionRepo, balanceRepo, settlementRepo,
+		services.NewExchangeRateService(repository.NewExchangeRateRepository(db)),
+		services.NewCategoryService(db, categoryRepo, teamRepo, expenseRepo, revisionRepo, auditRepo), services.NewBudgetService(repository.NewBudgetRepository(db), teamRepo, categoryRepo))
+	balanceService := services.NewBalanceService(db, expenseRepo, teamRepo, userRepo, settlementRepo, balanceRepo,
+		repository.NewBalanceSnapshotRepository(db), revisionRepo, auditRepo)
+
+	measure := func(name string, fn func() error) error {
+		queries, start := db.QueryCount(), time.Now()
+		if err := fn(); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		log.Printf("%-24s %6d queries %10s", name, db.QueryCount()-queries, time.Since(start).Round(time.Microsecond))
+		return nil
+	}
+
+	var first uuid.UUID
+	err := measure("list expenses", func() error {
+		expenses, _, _, err := expenseService.GetTeamExpenses(teamID, repository.ExpenseFilter{}, repository.Page{Limit: 20})
+		if len(expenses) > 0 {
+			first = expenses[0].ID
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if first != uuid.Nil {
+		err = measure("get expense", func() error {
+			_, err := expenseService.GetExpenseByID(first)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	err = measure("export expenses", func() error {
+		if _, err := teamService.GetTeamWithMembers(teamID); err != nil {
+			return err
+		}
+		_, err := expenseService.GetExpensesForExport(teamID, repository.ExpenseFilter{})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return measure("team balances", func() error {
+		_, err := balanceService.CalculateBalances(teamID, nil)
+		return err
+	})
+}
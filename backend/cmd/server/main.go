@@ -35,6 +35,15 @@ func main() {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
 
+	// Run a maintenance command instead of the server if one was given,
+	// e.g. "server import-rates eurofxref-hist.csv"
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1], os.Args[2:], db); err != nil {
+			log.Fatalf("Command %s failed: %v", os.Args[1], err)
+		}
+		return
+	}
+
 	// Create upload directory
 	if err := os.MkdirAll(cfg.UploadDir, 0755); err != nil {
 		log.Fatalf("Failed to create upload directory: %v", err)
@@ -46,14 +55,27 @@ func main() {
 	expenseRepo := repository.NewExpenseRepository(db)
 	settlementRepo := repository.NewSettlementRepository(db)
 	approvalRepo := repository.NewApprovalRepository(db)
+	rateRepo := repository.NewExchangeRateRepository(db)
+	recurringRepo := repository.NewRecurringExpenseRepository(db)
+	categoryRepo := repository.NewCategoryRepository(db)
+	budgetRepo := repository.NewBudgetRepository(db)
+	auditRepo := repository.NewAuditRepository(db)
+	revisionRepo := repository.NewExpenseRevisionRepository(db)
+	balanceRepo := repository.NewBalanceRepository(db)
+	snapshotRepo := repository.NewBalanceSnapshotRepository(db)
 
 	// Initialize services
 	tokenDuration, _ := time.ParseDuration(cfg.JWTExpiration)
 	authService := services.NewAuthService(userRepo, cfg.JWTSecret, tokenDuration)
-	teamService := services.NewTeamService(teamRepo, userRepo)
-	expenseService := services.NewExpenseService(expenseRepo, teamRepo, userRepo, approvalRepo)
-	balanceService := services.NewBalanceService(expenseRepo, teamRepo, userRepo, settlementRepo)
-	approvalService := services.NewApprovalService(approvalRepo, expenseRepo, teamRepo)
+	teamService := services.NewTeamService(db, teamRepo, userRepo, auditRepo)
+	rateService := services.NewExchangeRateService(rateRepo)
+	categoryService := services.NewCategoryService(db, categoryRepo, teamRepo, expenseRepo, revisionRepo, auditRepo)
+	budgetService := services.NewBudgetService(budgetRepo, teamRepo, categoryRepo)
+	expenseService := services.NewExpenseService(db, expenseRepo, teamRepo, userRepo, approvalRepo, auditRepo, revisionRepo, balanceRepo, settlementRepo, rateService, categoryService, budgetService)
+	balanceService := services.NewBalanceService(db, expenseRepo, teamRepo, userRepo, settlementRepo, balanceRepo, snapshotRepo, revisionRepo, auditRepo)
+	approvalService := services.NewApprovalService(db, approvalRepo, expenseRepo, teamRepo, auditRepo)
+	recurringService := services.NewRecurringExpenseService(recurringRepo, expenseService, categoryService)
+	auditService := services.NewAuditService(auditRepo)
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(authService, userRepo)
@@ -62,6 +84,11 @@ func main() {
 	balanceHandler := handlers.NewBalanceHandler(balanceService, teamService)
 	exportHandler := handlers.NewExportHandler(expenseService, balanceService, teamService)
 	approvalHandler := handlers.NewApprovalHandler(approvalService, teamService)
+	rateHandler := handlers.NewRateHandler(rateService)
+	recurringHandler := handlers.NewRecurringExpenseHandler(recurringService, teamService)
+	categoryHandler := handlers.NewCategoryHandler(categoryService, teamService)
+	budgetHandler := handlers.NewBudgetHandler(budgetService, teamService)
+	auditHandler := handlers.NewAuditHandler(auditService, teamService)
 
 	// Initialize middleware
 	authMiddleware := middleware.NewAuthMiddleware(authService)
@@ -93,28 +120,74 @@ func main() {
 	protected.HandleFunc("/teams/{id}/members", teamHandler.AddMember).Methods("POST")
 	protected.HandleFunc("/teams/{id}/members/{memberId}", teamHandler.RemoveMember).Methods("DELETE")
 
+	// Category routes
+	protected.HandleFunc("/teams/{id}/categories", categoryHandler.GetCategories).Methods("GET")
+	protected.HandleFunc("/teams/{id}/categories", categoryHandler.CreateCategory).Methods("POST")
+	protected.HandleFunc("/teams/{id}/categories/{categoryId}", categoryHandler.UpdateCategory).Methods("PUT")
+	protected.HandleFunc("/teams/{id}/categories/{categoryId}", categoryHandler.DeleteCategory).Methods("DELETE")
+
 	// Expense routes
 	protected.HandleFunc("/teams/{teamId}/expenses", expenseHandler.CreateExpense).Methods("POST")
 	protected.HandleFunc("/teams/{teamId}/expenses", expenseHandler.GetTeamExpenses).Methods("GET")
+	protected.HandleFunc("/teams/{teamId}/expenses/trash", expenseHandler.GetTrash).Methods("GET")
 	protected.HandleFunc("/teams/{teamId}/expenses/{id}", expenseHandler.GetExpense).Methods("GET")
 	protected.HandleFunc("/teams/{teamId}/expenses/{id}", expenseHandler.UpdateExpense).Methods("PUT")
 	protected.HandleFunc("/teams/{teamId}/expenses/{id}", expenseHandler.DeleteExpense).Methods("DELETE")
+	protected.HandleFunc("/teams/{teamId}/expenses/{id}/restore", expenseHandler.RestoreExpense).Methods("POST")
+	protected.HandleFunc("/teams/{teamId}/expenses/{id}/history", expenseHandler.GetExpenseHistory).Methods("GET")
+	protected.HandleFunc("/teams/{teamId}/expenses/{id}/revert", expenseHandler.RevertExpense).Methods("POST")
 	protected.HandleFunc("/teams/{teamId}/expenses/{id}/receipt", expenseHandler.UploadReceipt).Methods("POST")
 
+	// Recurring expense routes
+	protected.HandleFunc("/teams/{teamId}/recurring-expenses", recurringHandler.CreateRecurringExpense).Methods("POST")
+	protected.HandleFunc("/teams/{teamId}/recurring-expenses", recurringHandler.GetTeamRecurringExpenses).Methods("GET")
+	protected.HandleFunc("/teams/{teamId}/recurring-expenses/{id}", recurringHandler.GetRecurringExpense).Methods("GET")
+	protected.HandleFunc("/teams/{teamId}/recurring-expenses/{id}", recurringHandler.UpdateRecurringExpense).Methods("PUT")
+	protected.HandleFunc("/teams/{teamId}/recurring-expenses/{id}", recurringHandler.DeleteRecurringExpense).Methods("DELETE")
+
+	// Budget routes
+	protected.HandleFunc("/teams/{teamId}/budgets", budgetHandler.GetBudgets).Methods("GET")
+	protected.HandleFunc("/teams/{teamId}/budgets", budgetHandler.CreateBudget).Methods("POST")
+	protected.HandleFunc("/teams/{teamId}/budgets/status", budgetHandler.GetBudgetStatus).Methods("GET")
+	protected.HandleFunc("/teams/{teamId}/budgets/events", budgetHandler.GetBudgetEvents).Methods("GET")
+	protected.HandleFunc("/teams/{teamId}/budgets/{id}", budgetHandler.UpdateBudget).Methods("PUT")
+	protected.HandleFunc("/teams/{teamId}/budgets/{id}", budgetHandler.DeleteBudget).Methods("DELETE")
+
 	// Approval routes
 	protected.HandleFunc("/teams/{teamId}/approvals", approvalHandler.GetTeamApprovals).Methods("GET")
 	protected.HandleFunc("/teams/{teamId}/approvals/{id}", approvalHandler.UpdateApprovalStatus).Methods("PUT")
 
 	// Balance routes
+	protected.HandleFunc("/me/balances", balanceHandler.GetMyBalances).Methods("GET")
 	protected.HandleFunc("/teams/{teamId}/balances", balanceHandler.GetTeamBalances).Methods("GET")
 	protected.HandleFunc("/teams/{teamId}/balances/me", balanceHandler.GetUserBalance).Methods("GET")
+	protected.HandleFunc("/teams/{teamId}/balances/close", balanceHandler.ClosePeriod).Methods("POST")
+	protected.HandleFunc("/teams/{teamId}/balances/snapshots", balanceHandler.GetSnapshots).Methods("GET")
+	protected.HandleFunc("/teams/{teamId}/balances/snapshots/{id}", balanceHandler.GetSnapshot).Methods("GET")
+	protected.HandleFunc("/teams/{teamId}/ledger", balanceHandler.GetLedger).Methods("GET")
+	protected.HandleFunc("/teams/{teamId}/settlements", balanceHandler.GetSettlements).Methods("GET")
 	protected.HandleFunc("/teams/{teamId}/settlements", balanceHandler.RecordSettlement).Methods("POST")
+	protected.HandleFunc("/teams/{teamId}/settlements/{id}", balanceHandler.GetSettlement).Methods("GET")
+	protected.HandleFunc("/teams/{teamId}/settlements/{id}", balanceHandler.CorrectSettlement).Methods("PUT")
+	protected.HandleFunc("/teams/{teamId}/settlements/{id}/reverse", balanceHandler.ReverseSettlement).Methods("POST")
+	protected.HandleFunc("/teams/{teamId}/settlements/{id}/confirm", balanceHandler.ConfirmSettlement).Methods("POST")
+	protected.HandleFunc("/teams/{teamId}/settlements/{id}/dispute", balanceHandler.DisputeSettlement).Methods("POST")
+	protected.HandleFunc("/teams/{teamId}/settlements/{id}/cancel", balanceHandler.CancelSettlement).Methods("POST")
+	protected.HandleFunc("/teams/{teamId}/expenses/{id}/splits/{splitId}/settle", balanceHandler.SettleSplit).Methods("POST")
+	protected.HandleFunc("/teams/{teamId}/expenses/{id}/splits/{splitId}/unsettle", balanceHandler.UnsettleSplit).Methods("POST")
+
+	// Audit routes
+	protected.HandleFunc("/teams/{teamId}/audit", auditHandler.GetTeamAudit).Methods("GET")
 
 	// Export routes
 	protected.HandleFunc("/teams/{teamId}/export/expenses", exportHandler.ExportExpensesCSV).Methods("GET")
 	protected.HandleFunc("/teams/{teamId}/export/balances", exportHandler.ExportBalancesCSV).Methods("GET")
+	protected.HandleFunc("/teams/{teamId}/export/ledger", exportHandler.ExportLedgerCSV).Methods("GET")
 	protected.HandleFunc("/teams/{teamId}/export/summary", exportHandler.ExportReimbursementSummary).Methods("GET")
 
+	// Exchange rate routes
+	protected.HandleFunc("/rates", rateHandler.GetRates).Methods("GET")
+
 	// Serve uploaded files
 	router.PathPrefix("/uploads/").Handler(http.StripPrefix("/uploads/", http.FileServer(http.Dir(cfg.UploadDir))))
 
@@ -125,7 +198,7 @@ func main() {
 	}).Methods("GET")
 
 	// Apply middleware
-	handler := middleware.Logging(router)
+	handler := middleware.Logging(middleware.RequestMeta(router))
 
 	// CORS configuration
 	c := cors.New(cors.Options{
@@ -136,6 +209,26 @@ func main() {
 	})
 	handler = c.Handler(handler)
 
+	// Build the balances of teams from before balances were stored,
+	// before anything in the background can change them
+	if err := balanceService.BuildMissingBalances(); err != nil {
+		log.Fatalf("Failed to build balances: %v", err)
+	}
+
+	// Create due recurring expenses in the background
+	recurringInterval, err := time.ParseDuration(cfg.RecurringInterval)
+	if err != nil || recurringInterval <= 0 {
+		recurringInterval = time.Hour
+	}
+	go recurringService.StartScheduler(recurringInterval)
+
+	// Purge expenses that have been in the trash past the retention period
+	trashRetention, err := time.ParseDuration(cfg.TrashRetention)
+	if err != nil || trashRetention <= 0 {
+		trashRetention = 30 * 24 * time.Hour
+	}
+	go expenseService.StartTrashPurger(trashRetention, time.Hour)
+
 	// Start server
 	log.Printf("Server starting on port %s", cfg.ServerPort)
 	log.Printf("API available at http://localhost:%s/api/v1", cfg.ServerPort)
@@ -3,6 +3,7 @@ package appcontext
 import (
 	"context"
 
+	"github.com/expensesplit/backend/internal/models"
 	"github.com/google/uuid"
 )
 
@@ -11,6 +12,7 @@ type contextKey string
 const (
 	UserIDKey    contextKey = "userID"
 	UserEmailKey contextKey = "userEmail"
+	RequestKey   contextKey = "requestMeta"
 )
 
 func WithUserID(ctx context.Context, userID uuid.UUID) context.Context {
@@ -30,3 +32,12 @@ func GetUserEmail(ctx context.Context) (string, bool) {
 	email, ok := ctx.Value(UserEmailKey).(string)
 	return email, ok
 }
+
+func WithRequestMeta(ctx context.Context, meta models.RequestMeta) context.Context {
+	return context.WithValue(ctx, RequestKey, meta)
+}
+
+func GetRequestMeta(ctx context.Context) models.RequestMeta {
+	meta, _ := ctx.Value(RequestKey).(models.RequestMeta)
+	return meta
+}
@@ -13,6 +13,12 @@ type Config struct {
 	JWTExpiration  string
 	UploadDir      string
 	AllowedOrigins string
+
+	// How often the scheduler checks for due recurring expenses
+	RecurringInterval string
+
+	// How long deleted expenses stay in the trash before they are purged
+	TrashRetention string
 }
 
 func Load() (*Config, error) {
@@ -26,6 +32,9 @@ func Load() (*Config, error) {
 		JWTExpiration:  getEnv("JWT_EXPIRATION", "24h"),
 		UploadDir:      getEnv("UPLOAD_DIR", "./uploads"),
 		AllowedOrigins: getEnv("ALLOWED_ORIGINS", "http://localhost:3000"),
+
+		RecurringInterval: getEnv("RECURRING_INTERVAL", "1h"),
+		TrashRetention:    getEnv("TRASH_RETENTION", "720h"),
 	}
 
 	return config, nil
@@ -4,12 +4,23 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"sync/atomic"
 
 	_ "github.com/lib/pq"
 )
 
 type DB struct {
 	*sql.DB
+
+	queries atomic.Int64
+}
+
+// Querier is implemented by both *DB and *Tx, so repository methods
+// taking one can run on their own or as part of a larger transaction.
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
 }
 
 func New(databaseURL string) (*DB, error) {
@@ -23,7 +34,61 @@ func New(databaseURL string) (*DB, error) {
 	}
 
 	log.Println("Connected to database successfully")
-	return &DB{db}, nil
+	return &DB{DB: db}, nil
+}
+
+// Exec, Query and QueryRow count the statements they run; see QueryCount.
+
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	db.queries.Add(1)
+	return db.DB.Exec(query, args...)
+}
+
+func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	db.queries.Add(1)
+	return db.DB.Query(query, args...)
+}
+
+func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	db.queries.Add(1)
+	return db.DB.QueryRow(query, args...)
+}
+
+// QueryCount returns the number of statements run through db so far,
+// including those run inside its transactions.
+func (db *DB) QueryCount() int64 {
+	return db.queries.Load()
+}
+
+// Tx is a transaction begun on a DB. Its statements are counted together
+// with the DB's.
+type Tx struct {
+	*sql.Tx
+
+	db *DB
+}
+
+func (db *DB) Begin() (*Tx, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, db: db}, nil
+}
+
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	tx.db.queries.Add(1)
+	return tx.Tx.Exec(query, args...)
+}
+
+func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	tx.db.queries.Add(1)
+	return tx.Tx.Query(query, args...)
+}
+
+func (tx *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	tx.db.queries.Add(1)
+	return tx.Tx.QueryRow(query, args...)
 }
 
 func (db *DB) RunMigrations() error {
@@ -110,6 +175,329 @@ func (db *DB) RunMigrations() error {
 		`CREATE INDEX IF NOT EXISTS idx_team_members_user_id ON team_members(user_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_settlements_team_id ON settlements(team_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_approvals_expense_id ON approvals(expense_id)`,
+
+		// Multi-currency: teams have a base currency, expenses keep the
+		// original currency and amount plus the exchange rate that was used
+		`ALTER TABLE teams ADD COLUMN IF NOT EXISTS base_currency VARCHAR(3) NOT NULL DEFAULT 'USD'`,
+		`ALTER TABLE expenses ADD COLUMN IF NOT EXISTS currency VARCHAR(3)`,
+		`ALTER TABLE expenses ADD COLUMN IF NOT EXISTS original_amount DECIMAL(12,2)`,
+		`ALTER TABLE expenses ADD COLUMN IF NOT EXISTS exchange_rate DECIMAL(18,8) NOT NULL DEFAULT 1`,
+		`UPDATE expenses e SET currency = t.base_currency, original_amount = e.amount
+			FROM teams t WHERE e.team_id = t.id AND e.currency IS NULL`,
+
+		// Exchange rates imported from rate files (e.g. ECB reference rates)
+		`CREATE TABLE IF NOT EXISTS exchange_rates (
+			base_currency VARCHAR(3) NOT NULL,
+			quote_currency VARCHAR(3) NOT NULL,
+			effective_date DATE NOT NULL,
+			rate DECIMAL(18,8) NOT NULL,
+			source VARCHAR(50) NOT NULL,
+			imported_at TIMESTAMP DEFAULT NOW(),
+			PRIMARY KEY (base_currency, quote_currency, effective_date)
+		)`,
+
+		// Share weights for shares-based splits
+		`ALTER TABLE expense_splits ADD COLUMN IF NOT EXISTS shares INTEGER`,
+
+		// Itemized receipts: line items plus tax, service charge and tip
+		`ALTER TABLE expenses ADD COLUMN IF NOT EXISTS tax_amount DECIMAL(12,2) NOT NULL DEFAULT 0`,
+		`ALTER TABLE expenses ADD COLUMN IF NOT EXISTS service_charge DECIMAL(12,2) NOT NULL DEFAULT 0`,
+		`ALTER TABLE expenses ADD COLUMN IF NOT EXISTS tip_amount DECIMAL(12,2) NOT NULL DEFAULT 0`,
+		`CREATE TABLE IF NOT EXISTS expense_items (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			expense_id UUID REFERENCES expenses(id) ON DELETE CASCADE,
+			position INTEGER NOT NULL,
+			description TEXT,
+			amount DECIMAL(12,2) NOT NULL,
+			assigned_to UUID[] NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_expense_items_expense_id ON expense_items(expense_id)`,
+
+		// Multiple payers: each payer's contribution to an expense, in the
+		// team's base currency. Existing expenses were paid by paid_by alone.
+		`CREATE TABLE IF NOT EXISTS expense_payers (
+			expense_id UUID REFERENCES expenses(id) ON DELETE CASCADE,
+			user_id UUID REFERENCES users(id),
+			position INTEGER NOT NULL DEFAULT 0,
+			amount DECIMAL(12,2) NOT NULL,
+			PRIMARY KEY (expense_id, user_id)
+		)`,
+		`INSERT INTO expense_payers (expense_id, user_id, amount)
+			SELECT e.id, e.paid_by, e.amount FROM expenses e
+			WHERE e.paid_by IS NOT NULL
+			AND NOT EXISTS (SELECT 1 FROM expense_payers p WHERE p.expense_id = e.id)`,
+		`CREATE INDEX IF NOT EXISTS idx_expense_payers_user_id ON expense_payers(user_id)`,
+
+		// Date the money was spent, as opposed to when it was entered
+		`ALTER TABLE expenses ADD COLUMN IF NOT EXISTS incurred_on DATE`,
+		`UPDATE expenses SET incurred_on = created_at::date WHERE incurred_on IS NULL`,
+		`ALTER TABLE expenses ALTER COLUMN incurred_on SET DEFAULT CURRENT_DATE`,
+		`ALTER TABLE expenses ALTER COLUMN incurred_on SET NOT NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_expenses_team_incurred_on ON expenses(team_id, incurred_on DESC, created_at DESC)`,
+
+		// Recurring expenses. The unique index makes sure each occurrence
+		// becomes exactly one expense, whichever server instance creates it.
+		`CREATE TABLE IF NOT EXISTS recurring_expenses (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			team_id UUID REFERENCES teams(id) ON DELETE CASCADE,
+			created_by UUID REFERENCES users(id),
+			template JSONB NOT NULL,
+			frequency VARCHAR(20) NOT NULL,
+			interval_count INTEGER NOT NULL DEFAULT 1,
+			day_of_month INTEGER NOT NULL DEFAULT 0,
+			start_date DATE NOT NULL,
+			end_date DATE,
+			next_occurrence DATE,
+			created_at TIMESTAMP DEFAULT NOW(),
+			updated_at TIMESTAMP DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_recurring_expenses_team_id ON recurring_expenses(team_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_recurring_expenses_next_occurrence ON recurring_expenses(next_occurrence)`,
+		`ALTER TABLE expenses ADD COLUMN IF NOT EXISTS recurring_expense_id UUID REFERENCES recurring_expenses(id) ON DELETE SET NULL`,
+		`ALTER TABLE expenses ADD COLUMN IF NOT EXISTS occurrence_date DATE`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_expenses_recurring_occurrence ON expenses(recurring_expense_id, occurrence_date)`,
+
+		// Team-defined expense categories. Existing teams get the former
+		// built-in list plus every category their expenses already use.
+		// This is seeded only when the table is created, so categories a
+		// team deleted don't come back on the next start.
+		`DO $$
+		BEGIN
+			IF to_regclass('categories') IS NULL THEN
+				CREATE TABLE categories (
+					id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+					team_id UUID REFERENCES teams(id) ON DELETE CASCADE,
+					name VARCHAR(100) NOT NULL,
+					parent_id UUID REFERENCES categories(id),
+					archived BOOLEAN NOT NULL DEFAULT false,
+					created_at TIMESTAMP DEFAULT NOW(),
+					updated_at TIMESTAMP DEFAULT NOW()
+				);
+				CREATE UNIQUE INDEX idx_categories_team_name ON categories(team_id, lower(name));
+				INSERT INTO categories (team_id, name)
+					SELECT t.id, c.name FROM teams t
+					CROSS JOIN unnest(ARRAY['Food & Dining', 'Transportation', 'Accommodation', 'Office Supplies',
+						'Software & Tools', 'Entertainment', 'Travel', 'Utilities', 'Marketing', 'Other']) AS c(name);
+				INSERT INTO categories (team_id, name)
+					SELECT DISTINCT ON (team_id, lower(category)) team_id, category FROM expenses
+					WHERE category IS NOT NULL AND category <> ''
+					ON CONFLICT DO NOTHING;
+			END IF;
+		END $$`,
+
+		// Budgets and the threshold crossings recorded for notifications
+		`CREATE TABLE IF NOT EXISTS budgets (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			team_id UUID REFERENCES teams(id) ON DELETE CASCADE,
+			category_id UUID REFERENCES categories(id),
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			amount DECIMAL(12,2) NOT NULL,
+			period VARCHAR(20) NOT NULL,
+			start_date DATE NOT NULL,
+			end_date DATE,
+			warn_percent INTEGER NOT NULL DEFAULT 80,
+			created_by UUID REFERENCES users(id),
+			created_at TIMESTAMP DEFAULT NOW(),
+			updated_at TIMESTAMP DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_budgets_team_id ON budgets(team_id)`,
+		`CREATE TABLE IF NOT EXISTS budget_events (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			budget_id UUID REFERENCES budgets(id) ON DELETE CASCADE,
+			team_id UUID REFERENCES teams(id) ON DELETE CASCADE,
+			expense_id UUID REFERENCES expenses(id) ON DELETE SET NULL,
+			level VARCHAR(20) NOT NULL,
+			period_start DATE NOT NULL,
+			spent DECIMAL(12,2) NOT NULL,
+			amount DECIMAL(12,2) NOT NULL,
+			notified_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT NOW()
+		)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_budget_events_crossing ON budget_events(budget_id, period_start, level)`,
+		`CREATE INDEX IF NOT EXISTS idx_budget_events_team_id ON budget_events(team_id, created_at DESC)`,
+
+		// Full-text search over expense descriptions
+		`ALTER TABLE expenses ADD COLUMN IF NOT EXISTS search_vector TSVECTOR
+			GENERATED ALWAYS AS (to_tsvector('simple', COALESCE(description, ''))) STORED`,
+		`CREATE INDEX IF NOT EXISTS idx_expenses_search_vector ON expenses USING GIN(search_vector)`,
+
+		// Soft deletion: deleted expenses stay in the trash until purged
+		`ALTER TABLE expenses ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP`,
+		`ALTER TABLE expenses ADD COLUMN IF NOT EXISTS deleted_by UUID REFERENCES users(id)`,
+		`CREATE INDEX IF NOT EXISTS idx_expenses_deleted_at ON expenses(deleted_at) WHERE deleted_at IS NOT NULL`,
+
+		// Append-only audit log of changes to teams and their expenses.
+		// Events outlive their team: deleting it only clears team_id.
+		`CREATE TABLE IF NOT EXISTS audit_events (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			team_id UUID REFERENCES teams(id) ON DELETE SET NULL,
+			actor_id UUID NOT NULL,
+			action VARCHAR(50) NOT NULL,
+			entity_type VARCHAR(50) NOT NULL,
+			entity_id UUID NOT NULL,
+			before JSONB,
+			after JSONB,
+			request_id VARCHAR(64),
+			ip_address VARCHAR(64),
+			user_agent TEXT,
+			created_at TIMESTAMP DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_events_team ON audit_events(team_id, created_at DESC, id DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_events_entity ON audit_events(entity_type, entity_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_events_actor ON audit_events(team_id, actor_id)`,
+		`CREATE OR REPLACE FUNCTION audit_events_immutable() RETURNS TRIGGER AS $$
+		BEGIN
+			-- The only change allowed is the foreign key clearing team_id
+			-- when the team is deleted
+			IF TG_OP = 'UPDATE' AND pg_trigger_depth() > 1 THEN
+				IF NEW.team_id IS NULL AND to_jsonb(NEW) - 'team_id' = to_jsonb(OLD) - 'team_id' THEN
+					RETURN NEW;
+				END IF;
+			END IF;
+			RAISE EXCEPTION 'audit events cannot be modified or deleted';
+		END;
+		$$ LANGUAGE plpgsql`,
+		`DROP TRIGGER IF EXISTS audit_events_no_update ON audit_events`,
+		`CREATE TRIGGER audit_events_no_update BEFORE UPDATE ON audit_events
+			FOR EACH ROW EXECUTE FUNCTION audit_events_immutable()`,
+		`DROP TRIGGER IF EXISTS audit_events_no_delete ON audit_events`,
+		`CREATE TRIGGER audit_events_no_delete BEFORE DELETE ON audit_events
+			FOR EACH ROW EXECUTE FUNCTION audit_events_immutable()`,
+		`DROP TRIGGER IF EXISTS audit_events_no_truncate ON audit_events`,
+		`CREATE TRIGGER audit_events_no_truncate BEFORE TRUNCATE ON audit_events
+			FOR EACH STATEMENT EXECUTE FUNCTION audit_events_immutable()`,
+
+		// Every version of an expense with its payers, splits and items
+		`CREATE TABLE IF NOT EXISTS expense_revisions (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			expense_id UUID REFERENCES expenses(id) ON DELETE CASCADE,
+			revision INTEGER NOT NULL,
+			edited_by UUID REFERENCES users(id),
+			reason TEXT,
+			snapshot JSONB NOT NULL,
+			created_at TIMESTAMP DEFAULT NOW(),
+			UNIQUE(expense_id, revision)
+		)`,
+
+		// How suggested transfers are computed for a team
+		`ALTER TABLE teams ADD COLUMN IF NOT EXISTS balance_mode VARCHAR(20) NOT NULL DEFAULT 'pairwise'`,
+
+		// What each member owes each other member, maintained together with
+		// expenses and settlements. Teams that existed before have no
+		// balances_built_at and get their balances built on startup.
+		`CREATE TABLE IF NOT EXISTS balances (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			team_id UUID REFERENCES teams(id) ON DELETE CASCADE,
+			from_user UUID REFERENCES users(id),
+			to_user UUID REFERENCES users(id),
+			amount DECIMAL(12,2) NOT NULL DEFAULT 0,
+			updated_at TIMESTAMP DEFAULT NOW(),
+			UNIQUE(team_id, from_user, to_user)
+		)`,
+		`ALTER TABLE teams ADD COLUMN IF NOT EXISTS balances_built_at TIMESTAMP`,
+
+		// Settlements wait for the recipient to confirm them. Earlier
+		// settlements were counted right away and stay confirmed.
+		`ALTER TABLE settlements ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'confirmed'`,
+		`ALTER TABLE settlements ADD COLUMN IF NOT EXISTS recorded_by UUID REFERENCES users(id)`,
+		`ALTER TABLE settlements ADD COLUMN IF NOT EXISTS dispute_reason TEXT`,
+		`ALTER TABLE settlements ADD COLUMN IF NOT EXISTS resolved_at TIMESTAMP`,
+		`CREATE INDEX IF NOT EXISTS idx_settlements_team_status ON settlements(team_id, status)`,
+
+		// Settlements are never edited or deleted: a mistake is undone by a
+		// reversal paying the amount back, and each settlement can have at
+		// most one reversal that hasn't been cancelled
+		`ALTER TABLE settlements ADD COLUMN IF NOT EXISTS reverses_id UUID REFERENCES settlements(id)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_settlements_reverses ON settlements(reverses_id) WHERE status <> 'cancelled'`,
+
+		// Balances at the close of a period. Snapshots are only ever
+		// inserted; they keep the currency and balance mode the team had
+		// when they were taken.
+		`CREATE TABLE IF NOT EXISTS balance_snapshots (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			team_id UUID REFERENCES teams(id) ON DELETE CASCADE,
+			label VARCHAR(255),
+			as_of TIMESTAMP NOT NULL,
+			currency VARCHAR(3) NOT NULL,
+			balance_mode VARCHAR(20) NOT NULL,
+			closed_by UUID REFERENCES users(id),
+			created_at TIMESTAMP DEFAULT NOW()
+		)`,
+		`CREATE TABLE IF NOT EXISTS balance_snapshot_entries (
+			snapshot_id UUID REFERENCES balance_snapshots(id) ON DELETE CASCADE,
+			from_user UUID REFERENCES users(id),
+			to_user UUID REFERENCES users(id),
+			amount DECIMAL(12,2) NOT NULL,
+			PRIMARY KEY (snapshot_id, from_user, to_user)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_balance_snapshots_team_id ON balance_snapshots(team_id, as_of DESC)`,
+
+		// Which splits each confirmed settlement paid off, oldest first.
+		// Settlements made for one split record it in split_id.
+		`CREATE TABLE IF NOT EXISTS settlement_allocations (
+			settlement_id UUID REFERENCES settlements(id) ON DELETE CASCADE,
+			split_id UUID REFERENCES expense_splits(id) ON DELETE CASCADE,
+			amount DECIMAL(12,2) NOT NULL,
+			created_at TIMESTAMP DEFAULT NOW(),
+			PRIMARY KEY (settlement_id, split_id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_settlement_allocations_split_id ON settlement_allocations(split_id)`,
+		`ALTER TABLE settlements ADD COLUMN IF NOT EXISTS split_id UUID REFERENCES expense_splits(id) ON DELETE SET NULL`,
+
+		// Audit events used to be deleted together with their team
+		`ALTER TABLE audit_events DROP CONSTRAINT IF EXISTS audit_events_team_id_fkey`,
+		`ALTER TABLE audit_events ADD CONSTRAINT audit_events_team_id_fkey
+			FOREIGN KEY (team_id) REFERENCES teams(id) ON DELETE SET NULL`,
+
+		// Budgets used to be deleted together with their category
+		`ALTER TABLE budgets DROP CONSTRAINT IF EXISTS budgets_category_id_fkey`,
+		`ALTER TABLE budgets ADD CONSTRAINT budgets_category_id_fkey
+			FOREIGN KEY (category_id) REFERENCES categories(id)`,
+
+		// Whether a split is settled follows from the settlements applied
+		// to it instead of a flag that could disagree with them. Splits
+		// marked settled before get a confirmed settlement to each payer
+		// paying them off, and their teams' balances are built again.
+		`DO $$
+		BEGIN
+			IF EXISTS (SELECT 1 FROM information_schema.columns
+				WHERE table_name = 'expense_splits' AND column_name = 'is_settled') THEN
+				UPDATE teams SET balances_built_at = NULL WHERE id IN (
+					SELECT e.team_id FROM expense_splits es JOIN expenses e ON es.expense_id = e.id
+					WHERE es.is_settled);
+
+				WITH owed AS (
+					SELECT es.id AS split_id, e.team_id, es.user_id, p.user_id AS payer, e.created_at,
+						ROUND(es.amount * p.amount / SUM(p.amount) OVER (PARTITION BY es.id), 2) AS amount
+					FROM expense_splits es
+					JOIN expenses e ON es.expense_id = e.id
+					JOIN expense_payers p ON p.expense_id = e.id
+					WHERE es.is_settled
+					AND NOT EXISTS (SELECT 1 FROM settlement_allocations a WHERE a.split_id = es.id)
+				), paid AS (
+					INSERT INTO settlements (id, team_id, from_user, to_user, amount, status, split_id, created_at)
+					SELECT uuid_generate_v4(), team_id, user_id, payer, amount, 'confirmed', split_id, created_at
+					FROM owed WHERE payer <> user_id AND amount > 0
+					RETURNING id, split_id, amount
+				)
+				INSERT INTO settlement_allocations (settlement_id, split_id, amount)
+				SELECT id, split_id, amount FROM paid;
+
+				ALTER TABLE expense_splits DROP COLUMN is_settled;
+			END IF;
+		END $$`,
+
+		// Expenses purged from the trash leave a tombstone and keep their
+		// revisions, so balances as of before they were deleted still
+		// count them
+		`CREATE TABLE IF NOT EXISTS purged_expenses (
+			expense_id UUID PRIMARY KEY,
+			team_id UUID REFERENCES teams(id) ON DELETE CASCADE,
+			deleted_at TIMESTAMP NOT NULL,
+			purged_at TIMESTAMP DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_purged_expenses_team_id ON purged_expenses(team_id, deleted_at)`,
+		`ALTER TABLE expense_revisions DROP CONSTRAINT IF EXISTS expense_revisions_expense_id_fkey`,
 	}
 
 	for _, migration := range migrations {
@@ -122,6 +510,21 @@ func (db *DB) RunMigrations() error {
 	return nil
 }
 
+// WithTx runs fn inside a transaction that is committed if fn returns nil
+// and rolled back otherwise.
+func (db *DB) WithTx(fn func(tx *Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 func (db *DB) Close() error {
 	return db.DB.Close()
 }
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/expensesplit/backend/internal/models"
+	"github.com/expensesplit/backend/internal/repository"
 	"github.com/expensesplit/backend/internal/services"
 	"github.com/expensesplit/backend/pkg/utils"
 	"github.com/google/uuid"
@@ -48,13 +49,21 @@ func (h *ApprovalHandler) GetTeamApprovals(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	approvals, err := h.approvalService.GetTeamApprovals(teamID)
+	page, pageNumber := parsePage(r)
+	approvals, total, next, err := h.approvalService.GetTeamApprovals(teamID, page)
 	if err != nil {
+		if err == utils.ErrInvalidCursor {
+			utils.BadRequest(w, "Invalid cursor")
+			return
+		}
 		utils.InternalError(w, "Failed to get approvals")
 		return
 	}
+	if approvals == nil {
+		approvals = []models.Approval{}
+	}
 
-	utils.Success(w, approvals, "Approvals retrieved successfully")
+	utils.CursorPaginated(w, approvals, pageNumber, page.Limit, total, next)
 }
 
 func (h *ApprovalHandler) UpdateApprovalStatus(w http.ResponseWriter, r *http.Request) {
@@ -93,7 +102,12 @@ func (h *ApprovalHandler) UpdateApprovalStatus(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	if err := h.approvalService.UpdateApprovalStatus(approvalID, userID, req.Status, req.Comment); err != nil {
+	meta := GetRequestMetaFromContext(r.Context())
+	if err := h.approvalService.UpdateApprovalStatus(teamID, approvalID, userID, req.Status, req.Comment, meta); err != nil {
+		if err == repository.ErrApprovalNotFound {
+			utils.NotFound(w, "Approval not found")
+			return
+		}
 		utils.InternalError(w, "Failed to update approval status")
 		return
 	}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/expensesplit/backend/internal/repository"
+	"github.com/expensesplit/backend/internal/services"
+	"github.com/expensesplit/backend/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type AuditHandler struct {
+	auditService *services.AuditService
+	teamService  *services.TeamService
+}
+
+func NewAuditHandler(auditService *services.AuditService, teamService *services.TeamService) *AuditHandler {
+	return &AuditHandler{
+		auditService: auditService,
+		teamService:  teamService,
+	}
+}
+
+// GetTeamAudit lists the team's audit log, newest first. Only admins can
+// read it since events carry the IP addresses of members.
+func (h *AuditHandler) GetTeamAudit(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	teamID, err := uuid.Parse(vars["teamId"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid team ID")
+		return
+	}
+
+	// Check if user is an admin
+	isAdmin, err := h.teamService.IsAdmin(teamID, userID)
+	if err != nil {
+		utils.InternalError(w, "Failed to check permissions")
+		return
+	}
+	if !isAdmin {
+		utils.Forbidden(w, "Only admins can view the audit log")
+		return
+	}
+
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		utils.BadRequest(w, err.Error())
+		return
+	}
+
+	page, pageNumber := parsePage(r)
+	events, total, next, err := h.auditService.GetTeamAudit(teamID, filter, page)
+	if err != nil {
+		if err == utils.ErrInvalidCursor {
+			utils.BadRequest(w, "Invalid cursor")
+			return
+		}
+		utils.InternalError(w, "Failed to get audit log")
+		return
+	}
+	if events == nil {
+		events = []models.AuditEvent{}
+	}
+
+	utils.CursorPaginated(w, events, pageNumber, page.Limit, total, next)
+}
+
+// parseAuditFilter reads the optional ?actor=, ?entity_type=, ?entity_id=
+// and ?action= filters and the ?from= and ?to= bounds, which are either
+// RFC 3339 times or YYYY-MM-DD dates. A date as ?to= includes that day.
+func parseAuditFilter(r *http.Request) (repository.AuditFilter, error) {
+	var filter repository.AuditFilter
+	var err error
+	query := r.URL.Query()
+
+	if filter.ActorID, err = parseUUIDParam(query.Get("actor"), "actor"); err != nil {
+		return filter, err
+	}
+	if filter.EntityID, err = parseUUIDParam(query.Get("entity_id"), "entity_id"); err != nil {
+		return filter, err
+	}
+	filter.EntityType = models.AuditEntity(query.Get("entity_type"))
+	filter.Action = models.AuditAction(query.Get("action"))
+
+	if value := query.Get("from"); value != "" {
+		from, _, err := parseAuditTime(value)
+		if err != nil {
+			return filter, errors.New("invalid from, expected an RFC 3339 time or YYYY-MM-DD")
+		}
+		filter.From = from
+	}
+	if value := query.Get("to"); value != "" {
+		to, isDate, err := parseAuditTime(value)
+		if err != nil {
+			return filter, errors.New("invalid to, expected an RFC 3339 time or YYYY-MM-DD")
+		}
+		if isDate {
+			to = to.AddDate(0, 0, 1)
+		}
+		filter.To = to
+	}
+	return filter, nil
+}
+
+func parseAuditTime(value string) (time.Time, bool, error) {
+	// Event times are stored in the server's local time
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.Local(), false, nil
+	}
+	date, err := models.ParseDate(value)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return date.Time, true, nil
+}
@@ -2,9 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/expensesplit/backend/internal/models"
+	"github.com/expensesplit/backend/internal/repository"
 	"github.com/expensesplit/backend/internal/services"
 	"github.com/expensesplit/backend/pkg/utils"
 	"github.com/google/uuid"
@@ -23,6 +27,9 @@ func NewBalanceHandler(balanceService *services.BalanceService, teamService *ser
 	}
 }
 
+// GetTeamBalances shows who owes whom in the team, or with ?as_of= who owed
+// whom at that moment. Expenses purged from the trash since then no longer
+// count.
 func (h *BalanceHandler) GetTeamBalances(w http.ResponseWriter, r *http.Request) {
 	userID, ok := GetUserIDFromContext(r.Context())
 	if !ok {
@@ -48,7 +55,13 @@ func (h *BalanceHandler) GetTeamBalances(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	balances, err := h.balanceService.CalculateBalances(teamID)
+	asOf, err := parseAsOf(r)
+	if err != nil {
+		utils.BadRequest(w, err.Error())
+		return
+	}
+
+	balances, err := h.balanceService.CalculateBalances(teamID, asOf)
 	if err != nil {
 		utils.InternalError(w, "Failed to calculate balances")
 		return
@@ -57,6 +70,122 @@ func (h *BalanceHandler) GetTeamBalances(w http.ResponseWriter, r *http.Request)
 	utils.Success(w, balances, "")
 }
 
+// ClosePeriod keeps the team's balances at the end of a period as a
+// snapshot. Expenses purged from the trash since the end of the period no
+// longer count.
+func (h *BalanceHandler) ClosePeriod(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	teamID, err := uuid.Parse(vars["teamId"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid team ID")
+		return
+	}
+
+	var req models.PeriodCloseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.BadRequest(w, "Invalid request body")
+		return
+	}
+
+	snapshot, err := h.balanceService.ClosePeriod(teamID, &req, userID, GetRequestMetaFromContext(r.Context()))
+	if err != nil {
+		switch err {
+		case services.ErrNotAuthorized:
+			utils.Forbidden(w, "Only admins can close a period")
+		case services.ErrAsOfInFuture:
+			utils.BadRequest(w, err.Error())
+		default:
+			utils.InternalError(w, "Failed to close period")
+		}
+		return
+	}
+
+	utils.Created(w, snapshot, "Period closed successfully")
+}
+
+func (h *BalanceHandler) GetSnapshots(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	teamID, err := uuid.Parse(vars["teamId"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid team ID")
+		return
+	}
+
+	// Check if user is a member
+	isMember, err := h.teamService.IsMember(teamID, userID)
+	if err != nil {
+		utils.InternalError(w, "Failed to check membership")
+		return
+	}
+	if !isMember {
+		utils.Forbidden(w, "You are not a member of this team")
+		return
+	}
+
+	snapshots, err := h.balanceService.GetSnapshots(teamID)
+	if err != nil {
+		utils.InternalError(w, "Failed to get snapshots")
+		return
+	}
+
+	utils.Success(w, snapshots, "")
+}
+
+func (h *BalanceHandler) GetSnapshot(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	teamID, err := uuid.Parse(vars["teamId"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid team ID")
+		return
+	}
+	snapshotID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid snapshot ID")
+		return
+	}
+
+	// Check if user is a member
+	isMember, err := h.teamService.IsMember(teamID, userID)
+	if err != nil {
+		utils.InternalError(w, "Failed to check membership")
+		return
+	}
+	if !isMember {
+		utils.Forbidden(w, "You are not a member of this team")
+		return
+	}
+
+	snapshot, err := h.balanceService.GetSnapshot(teamID, snapshotID)
+	if err != nil {
+		if err == repository.ErrSnapshotNotFound {
+			utils.NotFound(w, "Snapshot not found")
+			return
+		}
+		utils.InternalError(w, "Failed to get snapshot")
+		return
+	}
+
+	utils.Success(w, snapshot, "")
+}
+
 func (h *BalanceHandler) GetUserBalance(w http.ResponseWriter, r *http.Request) {
 	userID, ok := GetUserIDFromContext(r.Context())
 	if !ok {
@@ -91,6 +220,169 @@ func (h *BalanceHandler) GetUserBalance(w http.ResponseWriter, r *http.Request)
 	utils.Success(w, balance, "")
 }
 
+// GetLedger shows how the balance between the current user and the member
+// given by ?with= came about.
+func (h *BalanceHandler) GetLedger(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	teamID, err := uuid.Parse(vars["teamId"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid team ID")
+		return
+	}
+
+	// Check if user is a member
+	isMember, err := h.teamService.IsMember(teamID, userID)
+	if err != nil {
+		utils.InternalError(w, "Failed to check membership")
+		return
+	}
+	if !isMember {
+		utils.Forbidden(w, "You are not a member of this team")
+		return
+	}
+
+	otherID, ok := ledgerWith(w, r, h.teamService, h.balanceService, teamID, userID)
+	if !ok {
+		return
+	}
+
+	ledger, err := h.balanceService.GetLedger(teamID, userID, otherID)
+	if err != nil {
+		if err == repository.ErrUserNotFound {
+			utils.NotFound(w, "User not found")
+			return
+		}
+		utils.InternalError(w, "Failed to get ledger")
+		return
+	}
+
+	utils.Success(w, ledger, "")
+}
+
+// GetMyBalances shows the current user's balances across all of their
+// teams. Pass ?net=true to net debts with the same person across teams.
+func (h *BalanceHandler) GetMyBalances(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	net := false
+	if value := r.URL.Query().Get("net"); value != "" {
+		var err error
+		if net, err = strconv.ParseBool(value); err != nil {
+			utils.BadRequest(w, "net must be true or false")
+			return
+		}
+	}
+
+	balances, err := h.balanceService.GetUserBalances(userID, net)
+	if err != nil {
+		utils.InternalError(w, "Failed to get balances")
+		return
+	}
+
+	utils.Success(w, balances, "")
+}
+
+func (h *BalanceHandler) GetSettlements(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	teamID, err := uuid.Parse(vars["teamId"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid team ID")
+		return
+	}
+
+	// Check if user is a member
+	isMember, err := h.teamService.IsMember(teamID, userID)
+	if err != nil {
+		utils.InternalError(w, "Failed to check membership")
+		return
+	}
+	if !isMember {
+		utils.Forbidden(w, "You are not a member of this team")
+		return
+	}
+
+	filter, err := parseSettlementFilter(r)
+	if err != nil {
+		utils.BadRequest(w, err.Error())
+		return
+	}
+
+	page, pageNumber := parsePage(r)
+	settlements, total, next, err := h.balanceService.GetSettlements(teamID, filter, page)
+	if err != nil {
+		if err == utils.ErrInvalidCursor {
+			utils.BadRequest(w, "Invalid cursor")
+			return
+		}
+		utils.InternalError(w, "Failed to get settlements")
+		return
+	}
+	if settlements == nil {
+		settlements = []models.Settlement{}
+	}
+
+	utils.CursorPaginated(w, settlements, pageNumber, page.Limit, total, next)
+}
+
+func (h *BalanceHandler) GetSettlement(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	teamID, err := uuid.Parse(vars["teamId"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid team ID")
+		return
+	}
+	settlementID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid settlement ID")
+		return
+	}
+
+	// Check if user is a member
+	isMember, err := h.teamService.IsMember(teamID, userID)
+	if err != nil {
+		utils.InternalError(w, "Failed to check membership")
+		return
+	}
+	if !isMember {
+		utils.Forbidden(w, "You are not a member of this team")
+		return
+	}
+
+	settlement, err := h.balanceService.GetSettlement(teamID, settlementID)
+	if err != nil {
+		if err == repository.ErrSettlementNotFound {
+			utils.NotFound(w, "Settlement not found")
+			return
+		}
+		utils.InternalError(w, "Failed to get settlement")
+		return
+	}
+
+	utils.Success(w, settlement, "")
+}
+
 func (h *BalanceHandler) RecordSettlement(w http.ResponseWriter, r *http.Request) {
 	userID, ok := GetUserIDFromContext(r.Context())
 	if !ok {
@@ -133,18 +425,357 @@ func (h *BalanceHandler) RecordSettlement(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = h.balanceService.RecordSettlement(teamID, &req)
+	settlement, err := h.balanceService.RecordSettlement(teamID, &req, userID, GetRequestMetaFromContext(r.Context()))
 	if err != nil {
 		utils.InternalError(w, "Failed to record settlement")
 		return
 	}
 
 	// Return updated balances
-	balances, err := h.balanceService.CalculateBalances(teamID)
+	balances, err := h.balanceService.CalculateBalances(teamID, nil)
 	if err != nil {
 		utils.InternalError(w, "Failed to get updated balances")
 		return
 	}
 
-	utils.Success(w, balances, "Settlement recorded successfully")
+	message := "Settlement recorded successfully"
+	if settlement.Status == models.SettlementStatusPending {
+		message = "Settlement recorded, waiting for confirmation"
+	}
+	utils.Success(w, balances, message)
+}
+
+// CorrectSettlement replaces a settlement with the one in the request body.
+// The original is reversed rather than changed, so it stays in the history.
+func (h *BalanceHandler) CorrectSettlement(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	teamID, err := uuid.Parse(vars["teamId"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid team ID")
+		return
+	}
+	settlementID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid settlement ID")
+		return
+	}
+
+	// Check if user is a member
+	isMember, err := h.teamService.IsMember(teamID, userID)
+	if err != nil {
+		utils.InternalError(w, "Failed to check membership")
+		return
+	}
+	if !isMember {
+		utils.Forbidden(w, "You are not a member of this team")
+		return
+	}
+
+	var req models.SettlementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.BadRequest(w, "Invalid request body")
+		return
+	}
+
+	// Validate that the user is either the payer or receiver
+	if req.FromUser != userID && req.ToUser != userID {
+		utils.Forbidden(w, "You can only record settlements involving yourself")
+		return
+	}
+
+	if req.Amount <= 0 {
+		utils.BadRequest(w, "Amount must be greater than 0")
+		return
+	}
+
+	correction, err := h.balanceService.CorrectSettlement(teamID, settlementID, &req, userID, GetRequestMetaFromContext(r.Context()))
+	if err != nil {
+		switch err {
+		case services.ErrNotAuthorized:
+			utils.Forbidden(w, "Only the payer or the recipient can correct a settlement")
+		case services.ErrSettlementNotConfirmed, services.ErrSettlementIsReversal, repository.ErrSettlementReversed:
+			utils.BadRequest(w, err.Error())
+		case repository.ErrSettlementNotFound:
+			utils.NotFound(w, "Settlement not found")
+		default:
+			utils.InternalError(w, "Failed to correct settlement")
+		}
+		return
+	}
+
+	utils.Success(w, correction, "Settlement corrected successfully")
+}
+
+func (h *BalanceHandler) ReverseSettlement(w http.ResponseWriter, r *http.Request) {
+	h.changeSettlementStatus(w, r, "Settlement reversed successfully",
+		"Only the payer or the recipient can reverse a settlement",
+		func(teamID, settlementID, userID uuid.UUID, meta models.RequestMeta) (*models.Settlement, error) {
+			return h.balanceService.ReverseSettlement(teamID, settlementID, userID, meta)
+		})
+}
+
+func (h *BalanceHandler) ConfirmSettlement(w http.ResponseWriter, r *http.Request) {
+	h.changeSettlementStatus(w, r, "Settlement confirmed successfully",
+		"Only the recipient can confirm a settlement",
+		func(teamID, settlementID, userID uuid.UUID, meta models.RequestMeta) (*models.Settlement, error) {
+			return h.balanceService.ConfirmSettlement(teamID, settlementID, userID, meta)
+		})
+}
+
+func (h *BalanceHandler) DisputeSettlement(w http.ResponseWriter, r *http.Request) {
+	var req models.SettlementDisputeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.BadRequest(w, "Invalid request body")
+		return
+	}
+
+	h.changeSettlementStatus(w, r, "Settlement disputed",
+		"Only the recipient can dispute a settlement",
+		func(teamID, settlementID, userID uuid.UUID, meta models.RequestMeta) (*models.Settlement, error) {
+			return h.balanceService.DisputeSettlement(teamID, settlementID, userID, req.Reason, meta)
+		})
+}
+
+func (h *BalanceHandler) CancelSettlement(w http.ResponseWriter, r *http.Request) {
+	h.changeSettlementStatus(w, r, "Settlement cancelled",
+		"Only the payer can cancel a settlement",
+		func(teamID, settlementID, userID uuid.UUID, meta models.RequestMeta) (*models.Settlement, error) {
+			return h.balanceService.CancelSettlement(teamID, settlementID, userID, meta)
+		})
+}
+
+// SettleSplit records payments of what is still owed on one split of an
+// expense.
+func (h *BalanceHandler) SettleSplit(w http.ResponseWriter, r *http.Request) {
+	h.changeSplitSettlement(w, r, "Split settled", "Only the member who owes the split or a payer can settle it",
+		h.balanceService.SettleSplit)
+}
+
+// UnsettleSplit reverses the payments made for one split of an expense.
+func (h *BalanceHandler) UnsettleSplit(w http.ResponseWriter, r *http.Request) {
+	h.changeSplitSettlement(w, r, "Split unsettled", "Only the member who owes the split or a payer can unsettle it",
+		h.balanceService.UnsettleSplit)
+}
+
+// changeSplitSettlement does the membership and ID checks shared by the
+// split settlement endpoints before calling change.
+func (h *BalanceHandler) changeSplitSettlement(w http.ResponseWriter, r *http.Request, message, forbidden string,
+	change func(teamID, expenseID, splitID, userID uuid.UUID, meta models.RequestMeta) ([]models.Settlement, error)) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	teamID, err := uuid.Parse(vars["teamId"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid team ID")
+		return
+	}
+	expenseID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid expense ID")
+		return
+	}
+	splitID, err := uuid.Parse(vars["splitId"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid split ID")
+		return
+	}
+
+	// Check if user is a member
+	isMember, err := h.teamService.IsMember(teamID, userID)
+	if err != nil {
+		utils.InternalError(w, "Failed to check membership")
+		return
+	}
+	if !isMember {
+		utils.Forbidden(w, "You are not a member of this team")
+		return
+	}
+
+	settlements, err := change(teamID, expenseID, splitID, userID, GetRequestMetaFromContext(r.Context()))
+	if err != nil {
+		switch err {
+		case services.ErrNotAuthorized:
+			utils.Forbidden(w, forbidden)
+		case services.ErrSplitSettled, services.ErrSplitNotSettled, services.ErrNothingOwed,
+			services.ErrSplitPaymentPending, services.ErrSplitPaidByOthers, repository.ErrSettlementReversed:
+			utils.BadRequest(w, err.Error())
+		case repository.ErrSplitNotFound, repository.ErrExpenseNotFound:
+			utils.NotFound(w, "Split not found")
+		default:
+			utils.InternalError(w, "Failed to update split")
+		}
+		return
+	}
+
+	for _, settlement := range settlements {
+		if settlement.Status == models.SettlementStatusPending {
+			message = "Split payment recorded, waiting for confirmation"
+			break
+		}
+	}
+	utils.Success(w, settlements, message)
+}
+
+// changeSettlementStatus does the membership and ID checks shared by the
+// settlement status and reversal endpoints before calling change.
+// forbidden explains who may make the change.
+func (h *BalanceHandler) changeSettlementStatus(w http.ResponseWriter, r *http.Request, message, forbidden string,
+	change func(teamID, settlementID, userID uuid.UUID, meta models.RequestMeta) (*models.Settlement, error)) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	teamID, err := uuid.Parse(vars["teamId"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid team ID")
+		return
+	}
+	settlementID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid settlement ID")
+		return
+	}
+
+	// Check if user is a member
+	isMember, err := h.teamService.IsMember(teamID, userID)
+	if err != nil {
+		utils.InternalError(w, "Failed to check membership")
+		return
+	}
+	if !isMember {
+		utils.Forbidden(w, "You are not a member of this team")
+		return
+	}
+
+	settlement, err := change(teamID, settlementID, userID, GetRequestMetaFromContext(r.Context()))
+	if err != nil {
+		switch err {
+		case services.ErrNotAuthorized:
+			utils.Forbidden(w, forbidden)
+		case services.ErrSettlementResolved, services.ErrSettlementDisputed, services.ErrDisputeReasonRequired,
+			services.ErrSettlementNotConfirmed, services.ErrSettlementIsReversal, repository.ErrSettlementReversed:
+			utils.BadRequest(w, err.Error())
+		case repository.ErrSettlementNotFound:
+			utils.NotFound(w, "Settlement not found")
+		default:
+			utils.InternalError(w, "Failed to update settlement")
+		}
+		return
+	}
+
+	utils.Success(w, settlement, message)
+}
+
+func parseSettlementFilter(r *http.Request) (repository.SettlementFilter, error) {
+	var filter repository.SettlementFilter
+	var err error
+	query := r.URL.Query()
+
+	if filter.UserID, err = parseUUIDParam(query.Get("user"), "user"); err != nil {
+		return filter, err
+	}
+	if filter.OtherUserID, err = parseUUIDParam(query.Get("other_user"), "other_user"); err != nil {
+		return filter, err
+	}
+	if filter.OtherUserID != nil && filter.UserID == nil {
+		return filter, errors.New("other_user requires user")
+	}
+	if value := query.Get("from"); value != "" {
+		if filter.From, err = models.ParseDate(value); err != nil {
+			return filter, err
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		if filter.To, err = models.ParseDate(value); err != nil {
+			return filter, err
+		}
+	}
+	if value := query.Get("status"); value != "" {
+		filter.Status = models.SettlementStatus(value)
+		switch filter.Status {
+		case models.SettlementStatusPending, models.SettlementStatusConfirmed,
+			models.SettlementStatusDisputed, models.SettlementStatusCancelled:
+		default:
+			return filter, errors.New("status must be pending, confirmed, disputed or cancelled")
+		}
+	}
+	return filter, nil
+}
+
+// parseLedgerWith reads the member a ledger is with from ?with=.
+func parseLedgerWith(r *http.Request, userID uuid.UUID) (uuid.UUID, error) {
+	value := r.URL.Query().Get("with")
+	if value == "" {
+		return uuid.Nil, errors.New("with is required")
+	}
+	otherID, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, errors.New("invalid with")
+	}
+	if otherID == userID {
+		return uuid.Nil, errors.New("with must be another member")
+	}
+	return otherID, nil
+}
+
+// ledgerWith reads the user a ledger is with from ?with= and checks that
+// they are in the team or share expenses or settlements with the current
+// user there, so ledgers can't be used to look up other users but still
+// cover former members. It writes the error response and returns false if
+// neither holds.
+func ledgerWith(w http.ResponseWriter, r *http.Request, teamService *services.TeamService, balanceService *services.BalanceService, teamID, userID uuid.UUID) (uuid.UUID, bool) {
+	otherID, err := parseLedgerWith(r, userID)
+	if err != nil {
+		utils.BadRequest(w, err.Error())
+		return uuid.Nil, false
+	}
+	isMember, err := teamService.IsMember(teamID, otherID)
+	if err != nil {
+		utils.InternalError(w, "Failed to check membership")
+		return uuid.Nil, false
+	}
+	if isMember {
+		return otherID, true
+	}
+	shared, err := balanceService.HaveHistory(teamID, userID, otherID)
+	if err != nil {
+		utils.InternalError(w, "Failed to check ledger history")
+		return uuid.Nil, false
+	}
+	if !shared {
+		utils.NotFound(w, "Member not found")
+		return uuid.Nil, false
+	}
+	return otherID, true
+}
+
+// parseAsOf reads ?as_of= as an RFC 3339 timestamp, or as a date meaning
+// the end of that day in UTC. It returns nil when as_of is not given.
+func parseAsOf(r *http.Request) (*time.Time, error) {
+	value := r.URL.Query().Get("as_of")
+	if value == "" {
+		return nil, nil
+	}
+	if asOf, err := time.Parse(time.RFC3339, value); err == nil {
+		return &asOf, nil
+	}
+	date, err := models.ParseDate(value)
+	if err != nil {
+		return nil, errors.New("as_of must be a date or an RFC 3339 timestamp")
+	}
+	asOf := date.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	return &asOf, nil
 }
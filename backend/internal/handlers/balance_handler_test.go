@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/expensesplit/backend/internal/appcontext"
+	"github.com/expensesplit/backend/internal/database"
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/expensesplit/backend/internal/repository"
+	"github.com/expensesplit/backend/internal/services"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+func TestLedgerWithNonMember(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := database.New(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.RunMigrations(); err != nil {
+		t.Fatal(err)
+	}
+
+	userRepo := repository.NewUserRepository(db)
+	teamRepo := repository.NewTeamRepository(db)
+	expenseRepo := repository.NewExpenseRepository(db)
+	auditRepo := repository.NewAuditRepository(db)
+	teamService := services.NewTeamService(db, teamRepo, userRepo, auditRepo)
+	balanceService := services.NewBalanceService(db, expenseRepo, teamRepo, userRepo,
+		repository.NewSettlementRepository(db), repository.NewBalanceRepository(db),
+		repository.NewBalanceSnapshotRepository(db), repository.NewExpenseRevisionRepository(db), auditRepo)
+	balanceHandler := NewBalanceHandler(balanceService, teamService)
+	exportHandler := NewExportHandler(nil, balanceService, teamService)
+
+	newUser := func(name string) uuid.UUID {
+		user := &models.User{Email: uuid.NewString() + "@example.com", PasswordHash: "-", Name: name}
+		if err := userRepo.Create(user); err != nil {
+			t.Fatal(err)
+		}
+		return user.ID
+	}
+	alice, bob, outsider := newUser("Alice"), newUser("Bob"), newUser("Outsider")
+	team, err := teamService.CreateTeam(&models.TeamCreateRequest{Name: "Ledger"}, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := teamRepo.AddMember(team.ID, bob, "member"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		with    uuid.UUID
+		status  int
+	}{
+		{"ledger with member", balanceHandler.GetLedger, bob, http.StatusOK},
+		{"ledger with non-member", balanceHandler.GetLedger, outsider, http.StatusNotFound},
+		{"export with member", exportHandler.ExportLedgerCSV, bob, http.StatusOK},
+		{"export with non-member", exportHandler.ExportLedgerCSV, outsider, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/?with="+tt.with.String(), nil)
+			r = mux.SetURLVars(r, map[string]string{"teamId": team.ID.String()})
+			r = r.WithContext(appcontext.WithUserID(r.Context(), alice))
+			w := httptest.NewRecorder()
+
+			tt.handler(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.status == http.StatusNotFound && strings.Contains(w.Body.String(), "Outsider") {
+				t.Fatalf("response leaks the user's name: %s", w.Body.String())
+			}
+		})
+	}
+}
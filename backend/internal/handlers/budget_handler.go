@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/expensesplit/backend/internal/repository"
+	"github.com/expensesplit/backend/internal/services"
+	"github.com/expensesplit/backend/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const budgetEventsLimit = 100
+
+type BudgetHandler struct {
+	budgetService *services.BudgetService
+	teamService   *services.TeamService
+}
+
+func NewBudgetHandler(budgetService *services.BudgetService, teamService *services.TeamService) *BudgetHandler {
+	return &BudgetHandler{
+		budgetService: budgetService,
+		teamService:   teamService,
+	}
+}
+
+func (h *BudgetHandler) GetBudgets(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	teamID, err := uuid.Parse(vars["teamId"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid team ID")
+		return
+	}
+
+	// Check if user is a member
+	isMember, err := h.teamService.IsMember(teamID, userID)
+	if err != nil {
+		utils.InternalError(w, "Failed to check membership")
+		return
+	}
+	if !isMember {
+		utils.Forbidden(w, "You are not a member of this team")
+		return
+	}
+
+	budgets, err := h.budgetService.GetTeamBudgets(teamID)
+	if err != nil {
+		utils.InternalError(w, "Failed to get budgets")
+		return
+	}
+	if budgets == nil {
+		budgets = []*models.Budget{}
+	}
+
+	utils.Success(w, budgets, "")
+}
+
+func (h *BudgetHandler) CreateBudget(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	teamID, err := uuid.Parse(vars["teamId"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid team ID")
+		return
+	}
+
+	// Check if user is a member
+	isMember, err := h.teamService.IsMember(teamID, userID)
+	if err != nil {
+		utils.InternalError(w, "Failed to check membership")
+		return
+	}
+	if !isMember {
+		utils.Forbidden(w, "You are not a member of this team")
+		return
+	}
+
+	var req models.BudgetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.BadRequest(w, "Invalid request body")
+		return
+	}
+
+	budget, err := h.budgetService.CreateBudget(teamID, &req, userID)
+	if err != nil {
+		switch {
+		case err == services.ErrNotAuthorized:
+			utils.Forbidden(w, "Only admins can manage budgets")
+		case isBudgetValidationError(err):
+			utils.BadRequest(w, err.Error())
+		default:
+			utils.InternalError(w, "Failed to create budget")
+		}
+		return
+	}
+
+	utils.Created(w, budget, "Budget created successfully")
+}
+
+func (h *BudgetHandler) UpdateBudget(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	teamID, err := uuid.Parse(vars["teamId"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid team ID")
+		return
+	}
+
+	// Check if user is a member
+	isMember, err := h.teamService.IsMember(teamID, userID)
+	if err != nil {
+		utils.InternalError(w, "Failed to check membership")
+		return
+	}
+	if !isMember {
+		utils.Forbidden(w, "You are not a member of this team")
+		return
+	}
+
+	id, err := uuid.Parse(vars["id"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid budget ID")
+		return
+	}
+
+	var req models.BudgetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.BadRequest(w, "Invalid request body")
+		return
+	}
+
+	budget, err := h.budgetService.UpdateBudget(teamID, id, &req, userID)
+	if err != nil {
+		switch {
+		case err == services.ErrNotAuthorized:
+			utils.Forbidden(w, "Only admins can manage budgets")
+		case err == repository.ErrBudgetNotFound:
+			utils.NotFound(w, "Budget not found")
+		case isBudgetValidationError(err):
+			utils.BadRequest(w, err.Error())
+		default:
+			utils.InternalError(w, "Failed to update budget")
+		}
+		return
+	}
+
+	utils.Success(w, budget, "Budget updated successfully")
+}
+
+func (h *BudgetHandler) DeleteBudget(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	teamID, err := uuid.Parse(vars["teamId"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid team ID")
+		return
+	}
+
+	// Check if user is a member
+	isMember, err := h.teamService.IsMember(teamID, userID)
+	if err != nil {
+		utils.InternalError(w, "Failed to check membership")
+		return
+	}
+	if !isMember {
+		utils.Forbidden(w, "You are not a member of this team")
+		return
+	}
+
+	id, err := uuid.Parse(vars["id"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid budget ID")
+		return
+	}
+
+	if err := h.budgetService.DeleteBudget(teamID, id, userID); err != nil {
+		switch err {
+		case services.ErrNotAuthorized:
+			utils.Forbidden(w, "Only admins can manage budgets")
+		case repository.ErrBudgetNotFound:
+			utils.NotFound(w, "Budget not found")
+		default:
+			utils.InternalError(w, "Failed to delete budget")
+		}
+		return
+	}
+
+	utils.Success(w, nil, "Budget deleted successfully")
+}
+
+// GetBudgetStatus reports spending against each budget for the period
+// containing ?date=YYYY-MM-DD, which defaults to today.
+func (h *BudgetHandler) GetBudgetStatus(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	teamID, err := uuid.Parse(vars["teamId"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid team ID")
+		return
+	}
+
+	// Check if user is a member
+	isMember, err := h.teamService.IsMember(teamID, userID)
+	if err != nil {
+		utils.InternalError(w, "Failed to check membership")
+		return
+	}
+	if !isMember {
+		utils.Forbidden(w, "You are not a member of this team")
+		return
+	}
+
+	date := models.Today()
+	if value := r.URL.Query().Get("date"); value != "" {
+		parsed, err := models.ParseDate(value)
+		if err != nil {
+			utils.BadRequest(w, "Invalid date, expected YYYY-MM-DD")
+			return
+		}
+		date = parsed
+	}
+
+	status, err := h.budgetService.GetStatus(teamID, date)
+	if err != nil {
+		utils.InternalError(w, "Failed to get budget status")
+		return
+	}
+
+	utils.Success(w, status, "")
+}
+
+func (h *BudgetHandler) GetBudgetEvents(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	teamID, err := uuid.Parse(vars["teamId"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid team ID")
+		return
+	}
+
+	// Check if user is a member
+	isMember, err := h.teamService.IsMember(teamID, userID)
+	if err != nil {
+		utils.InternalError(w, "Failed to check membership")
+		return
+	}
+	if !isMember {
+		utils.Forbidden(w, "You are not a member of this team")
+		return
+	}
+
+	events, err := h.budgetService.GetEvents(teamID, budgetEventsLimit)
+	if err != nil {
+		utils.InternalError(w, "Failed to get budget events")
+		return
+	}
+	if events == nil {
+		events = []models.BudgetEvent{}
+	}
+
+	utils.Success(w, events, "")
+}
+
+func isBudgetValidationError(err error) bool {
+	switch err {
+	case services.ErrInvalidBudgetPeriod, services.ErrInvalidBudget, services.ErrInvalidBudgetDates,
+		services.ErrInvalidBudgetMember, services.ErrUnknownCategory:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/expensesplit/backend/internal/repository"
+	"github.com/expensesplit/backend/internal/services"
+	"github.com/expensesplit/backend/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type CategoryHandler struct {
+	categoryService *services.CategoryService
+	teamService     *services.TeamService
+}
+
+func NewCategoryHandler(categoryService *services.CategoryService, teamService *services.TeamService) *CategoryHandler {
+	return &CategoryHandler{
+		categoryService: categoryService,
+		teamService:     teamService,
+	}
+}
+
+func (h *CategoryHandler) GetCategories(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	teamID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid team ID")
+		return
+	}
+
+	// Check if user is a member
+	isMember, err := h.teamService.IsMember(teamID, userID)
+	if err != nil {
+		utils.InternalError(w, "Failed to check membership")
+		return
+	}
+	if !isMember {
+		utils.Forbidden(w, "You are not a member of this team")
+		return
+	}
+
+	// Archived categories are only listed with ?include_archived=true
+	includeArchived := r.URL.Query().Get("include_archived") == "true"
+	categories, err := h.categoryService.GetTeamCategories(teamID, includeArchived)
+	if err != nil {
+		utils.InternalError(w, "Failed to get categories")
+		return
+	}
+	if categories == nil {
+		categories = []*models.Category{}
+	}
+
+	utils.Success(w, categories, "")
+}
+
+func (h *CategoryHandler) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	teamID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid team ID")
+		return
+	}
+
+	var req models.CategoryCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.BadRequest(w, "Invalid request body")
+		return
+	}
+
+	category, err := h.categoryService.CreateCategory(teamID, &req, userID)
+	if err != nil {
+		switch err {
+		case services.ErrNotAuthorized:
+			utils.Forbidden(w, "Only admins can manage categories")
+		case services.ErrCategoryNameRequired, services.ErrInvalidCategoryParent, repository.ErrCategoryExists:
+			utils.BadRequest(w, err.Error())
+		default:
+			utils.InternalError(w, "Failed to create category")
+		}
+		return
+	}
+
+	utils.Created(w, category, "Category created successfully")
+}
+
+func (h *CategoryHandler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	teamID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid team ID")
+		return
+	}
+	categoryID, err := uuid.Parse(vars["categoryId"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid category ID")
+		return
+	}
+
+	var req models.CategoryUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.BadRequest(w, "Invalid request body")
+		return
+	}
+
+	category, err := h.categoryService.UpdateCategory(teamID, categoryID, &req, userID, GetRequestMetaFromContext(r.Context()))
+	if err != nil {
+		switch err {
+		case services.ErrNotAuthorized:
+			utils.Forbidden(w, "Only admins can manage categories")
+		case services.ErrCategoryNameRequired, services.ErrInvalidCategoryParent, repository.ErrCategoryExists:
+			utils.BadRequest(w, err.Error())
+		case repository.ErrCategoryNotFound:
+			utils.NotFound(w, "Category not found")
+		default:
+			utils.InternalError(w, "Failed to update category")
+		}
+		return
+	}
+
+	utils.Success(w, category, "Category updated successfully")
+}
+
+func (h *CategoryHandler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	teamID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid team ID")
+		return
+	}
+	categoryID, err := uuid.Parse(vars["categoryId"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid category ID")
+		return
+	}
+
+	if err := h.categoryService.DeleteCategory(teamID, categoryID, userID); err != nil {
+		switch err {
+		case services.ErrNotAuthorized:
+			utils.Forbidden(w, "Only admins can manage categories")
+		case services.ErrCategoryInUse:
+			utils.BadRequest(w, err.Error())
+		case repository.ErrCategoryNotFound:
+			utils.NotFound(w, "Category not found")
+		default:
+			utils.InternalError(w, "Failed to delete category")
+		}
+		return
+	}
+
+	utils.Success(w, nil, "Category deleted successfully")
+}
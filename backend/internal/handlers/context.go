@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/expensesplit/backend/internal/appcontext"
+	"github.com/expensesplit/backend/internal/models"
 	"github.com/google/uuid"
 )
 
@@ -14,3 +15,7 @@ func GetUserIDFromContext(ctx context.Context) (uuid.UUID, bool) {
 func GetUserEmailFromContext(ctx context.Context) (string, bool) {
 	return appcontext.GetUserEmail(ctx)
 }
+
+func GetRequestMetaFromContext(ctx context.Context) models.RequestMeta {
+	return appcontext.GetRequestMeta(ctx)
+}
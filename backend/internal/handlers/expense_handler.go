@@ -2,11 +2,14 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/expensesplit/backend/internal/models"
 	"github.com/expensesplit/backend/internal/repository"
@@ -61,10 +64,13 @@ func (h *ExpenseHandler) CreateExpense(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	expense, err := h.expenseService.CreateExpense(teamID, userID, &req)
+	expense, err := h.expenseService.CreateExpense(teamID, userID, &req, GetRequestMetaFromContext(r.Context()))
 	if err != nil {
 		switch err {
-		case services.ErrAmountRequired, services.ErrSplitWithRequired, services.ErrInvalidSplitType, services.ErrInvalidCustomSplit:
+		case services.ErrAmountRequired, services.ErrSplitWithRequired, services.ErrInvalidSplitType, services.ErrInvalidCustomSplit,
+			services.ErrInvalidPercentSplit, services.ErrInvalidShareSplit, services.ErrInvalidSplit, services.ErrInvalidItemizedSplit,
+			services.ErrItemizedTotalMismatch, services.ErrInvalidPayers, services.ErrExchangeRateRequired, models.ErrInvalidCurrency,
+			services.ErrAmountTooLarge, services.ErrUnknownCategory, services.ErrCategoryArchived:
 			utils.BadRequest(w, err.Error())
 		default:
 			utils.InternalError(w, "Failed to create expense")
@@ -144,18 +150,19 @@ func (h *ExpenseHandler) GetTeamExpenses(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Parse pagination params
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
-	if page < 1 {
-		page = 1
-	}
-	if perPage < 1 {
-		perPage = 20
+	filter, err := parseExpenseFilter(r)
+	if err != nil {
+		utils.BadRequest(w, err.Error())
+		return
 	}
 
-	expenses, total, err := h.expenseService.GetTeamExpenses(teamID, page, perPage)
+	page, pageNumber := parsePage(r)
+	expenses, total, next, err := h.expenseService.GetTeamExpenses(teamID, filter, page)
 	if err != nil {
+		if err == utils.ErrInvalidCursor {
+			utils.BadRequest(w, "Invalid cursor")
+			return
+		}
 		utils.InternalError(w, "Failed to get expenses")
 		return
 	}
@@ -164,7 +171,7 @@ func (h *ExpenseHandler) GetTeamExpenses(w http.ResponseWriter, r *http.Request)
 		expenses = []*models.ExpenseResponse{}
 	}
 
-	utils.Paginated(w, expenses, page, perPage, total)
+	utils.CursorPaginated(w, expenses, pageNumber, page.Limit, total, next)
 }
 
 func (h *ExpenseHandler) UpdateExpense(w http.ResponseWriter, r *http.Request) {
@@ -187,11 +194,16 @@ func (h *ExpenseHandler) UpdateExpense(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	expense, err := h.expenseService.UpdateExpense(expenseID, &req, userID)
+	expense, err := h.expenseService.UpdateExpense(expenseID, &req, userID, GetRequestMetaFromContext(r.Context()))
 	if err != nil {
 		switch err {
 		case services.ErrNotAuthorized:
 			utils.Forbidden(w, "Only the payer can update this expense")
+		case services.ErrAmountRequired, services.ErrSplitWithRequired, services.ErrInvalidSplitType,
+			services.ErrInvalidCustomSplit, services.ErrInvalidPercentSplit, services.ErrInvalidShareSplit, services.ErrInvalidSplit,
+			services.ErrInvalidItemizedSplit, services.ErrItemizedTotalMismatch, services.ErrInvalidPayers,
+			services.ErrAmountTooLarge, services.ErrUnknownCategory, services.ErrCategoryArchived:
+			utils.BadRequest(w, err.Error())
 		case repository.ErrExpenseNotFound:
 			utils.NotFound(w, "Expense not found")
 		default:
@@ -217,7 +229,7 @@ func (h *ExpenseHandler) DeleteExpense(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.expenseService.DeleteExpense(expenseID, userID)
+	err = h.expenseService.DeleteExpense(expenseID, userID, GetRequestMetaFromContext(r.Context()))
 	if err != nil {
 		switch err {
 		case services.ErrNotAuthorized:
@@ -233,6 +245,179 @@ func (h *ExpenseHandler) DeleteExpense(w http.ResponseWriter, r *http.Request) {
 	utils.Success(w, nil, "Expense deleted successfully")
 }
 
+// GetTrash lists the team's deleted expenses that have not been purged yet.
+// It takes the same filters and pagination as GetTeamExpenses.
+func (h *ExpenseHandler) GetTrash(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	teamID, err := uuid.Parse(vars["teamId"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid team ID")
+		return
+	}
+
+	// Check if user is a member
+	isMember, err := h.teamService.IsMember(teamID, userID)
+	if err != nil {
+		utils.InternalError(w, "Failed to check membership")
+		return
+	}
+	if !isMember {
+		utils.Forbidden(w, "You are not a member of this team")
+		return
+	}
+
+	filter, err := parseExpenseFilter(r)
+	if err != nil {
+		utils.BadRequest(w, err.Error())
+		return
+	}
+	filter.Deleted = true
+
+	page, pageNumber := parsePage(r)
+	expenses, total, next, err := h.expenseService.GetTeamExpenses(teamID, filter, page)
+	if err != nil {
+		if err == utils.ErrInvalidCursor {
+			utils.BadRequest(w, "Invalid cursor")
+			return
+		}
+		utils.InternalError(w, "Failed to get deleted expenses")
+		return
+	}
+
+	if expenses == nil {
+		expenses = []*models.ExpenseResponse{}
+	}
+
+	utils.CursorPaginated(w, expenses, pageNumber, page.Limit, total, next)
+}
+
+func (h *ExpenseHandler) RestoreExpense(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	expenseID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid expense ID")
+		return
+	}
+
+	expense, err := h.expenseService.RestoreExpense(expenseID, userID, GetRequestMetaFromContext(r.Context()))
+	if err != nil {
+		switch err {
+		case services.ErrNotAuthorized:
+			utils.Forbidden(w, "Only the payer can restore this expense")
+		case repository.ErrExpenseNotFound:
+			utils.NotFound(w, "Expense not found in the trash")
+		default:
+			utils.InternalError(w, "Failed to restore expense")
+		}
+		return
+	}
+
+	utils.Success(w, expense, "Expense restored successfully")
+}
+
+// GetExpenseHistory lists the revisions of an expense, oldest first, with
+// the fields each one changed.
+func (h *ExpenseHandler) GetExpenseHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	teamID, err := uuid.Parse(vars["teamId"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid team ID")
+		return
+	}
+
+	expenseID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid expense ID")
+		return
+	}
+
+	// Check if user is a member
+	isMember, err := h.teamService.IsMember(teamID, userID)
+	if err != nil {
+		utils.InternalError(w, "Failed to check membership")
+		return
+	}
+	if !isMember {
+		utils.Forbidden(w, "You are not a member of this team")
+		return
+	}
+
+	history, err := h.expenseService.GetExpenseHistory(teamID, expenseID)
+	if err != nil {
+		if err == repository.ErrExpenseNotFound {
+			utils.NotFound(w, "Expense not found")
+			return
+		}
+		utils.InternalError(w, "Failed to get expense history")
+		return
+	}
+
+	utils.Success(w, history, "")
+}
+
+// RevertExpense puts an expense back the way it was at an earlier revision.
+func (h *ExpenseHandler) RevertExpense(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	expenseID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid expense ID")
+		return
+	}
+
+	var req models.ExpenseRevertRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.BadRequest(w, "Invalid request body")
+		return
+	}
+	if req.Revision < 1 {
+		utils.BadRequest(w, "revision is required")
+		return
+	}
+
+	expense, err := h.expenseService.RevertExpense(expenseID, req.Revision, req.Reason, userID, GetRequestMetaFromContext(r.Context()))
+	if err != nil {
+		switch err {
+		case services.ErrNotAuthorized:
+			utils.Forbidden(w, "Only the payer can revert this expense")
+		case services.ErrUnknownCategory, services.ErrCategoryArchived:
+			utils.BadRequest(w, err.Error())
+		case repository.ErrExpenseNotFound:
+			utils.NotFound(w, "Expense not found")
+		case repository.ErrRevisionNotFound:
+			utils.NotFound(w, "Revision not found")
+		default:
+			utils.InternalError(w, "Failed to revert expense")
+		}
+		return
+	}
+
+	utils.Success(w, expense, "Expense reverted successfully")
+}
+
 func (h *ExpenseHandler) UploadReceipt(w http.ResponseWriter, r *http.Request) {
 	userID, ok := GetUserIDFromContext(r.Context())
 	if !ok {
@@ -316,3 +501,104 @@ func (h *ExpenseHandler) UploadReceipt(w http.ResponseWriter, r *http.Request) {
 
 	utils.Success(w, map[string]string{"receipt_url": receiptURL}, "Receipt uploaded successfully")
 }
+
+// parseExpenseFilter reads the expense list query parameters shared by
+// expense listings and exports:
+//
+//	from, to             incurred-on dates, YYYY-MM-DD, inclusive
+//	category             one or more categories, repeated or comma-separated
+//	paid_by, participant member IDs
+//	min_amount,
+//	max_amount           in the team's base currency
+//	status               approval status
+//	has_receipt          true or false
+//	q                    full-text search over the description
+//	sort, order          date, amount or category; asc or desc
+func parseExpenseFilter(r *http.Request) (repository.ExpenseFilter, error) {
+	var filter repository.ExpenseFilter
+	var err error
+	query := r.URL.Query()
+
+	if value := query.Get("from"); value != "" {
+		if filter.From, err = models.ParseDate(value); err != nil {
+			return filter, err
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		if filter.To, err = models.ParseDate(value); err != nil {
+			return filter, err
+		}
+	}
+	for _, value := range query["category"] {
+		for _, category := range strings.Split(value, ",") {
+			if category = strings.TrimSpace(category); category != "" {
+				filter.Categories = append(filter.Categories, category)
+			}
+		}
+	}
+	if filter.PayerID, err = parseUUIDParam(query.Get("paid_by"), "paid_by"); err != nil {
+		return filter, err
+	}
+	if filter.ParticipantID, err = parseUUIDParam(query.Get("participant"), "participant"); err != nil {
+		return filter, err
+	}
+	if filter.MinAmount, err = parseMoneyParam(query.Get("min_amount"), "min_amount"); err != nil {
+		return filter, err
+	}
+	if filter.MaxAmount, err = parseMoneyParam(query.Get("max_amount"), "max_amount"); err != nil {
+		return filter, err
+	}
+	if value := query.Get("status"); value != "" {
+		filter.ApprovalStatus = models.ApprovalStatus(value)
+		switch filter.ApprovalStatus {
+		case models.ApprovalStatusPending, models.ApprovalStatusApproved, models.ApprovalStatusRejected:
+		default:
+			return filter, errors.New("status must be pending, approved or rejected")
+		}
+	}
+	if value := query.Get("has_receipt"); value != "" {
+		hasReceipt, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, errors.New("has_receipt must be true or false")
+		}
+		filter.HasReceipt = &hasReceipt
+	}
+	filter.Search = query.Get("q")
+
+	if value := query.Get("sort"); value != "" {
+		filter.Sort = repository.ExpenseSort(value)
+		if !repository.IsValidExpenseSort(filter.Sort) {
+			return filter, errors.New("sort must be date, amount or category")
+		}
+	}
+	switch query.Get("order") {
+	case "", "desc":
+	case "asc":
+		filter.Ascending = true
+	default:
+		return filter, errors.New("order must be asc or desc")
+	}
+	return filter, nil
+}
+
+func parseUUIDParam(value, name string) (*uuid.UUID, error) {
+	if value == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s", name)
+	}
+	return &id, nil
+}
+
+func parseMoneyParam(value, name string) (*models.Money, error) {
+	if value == "" {
+		return nil, nil
+	}
+	amount, err := models.NewMoneyFromString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s", name)
+	}
+	return &amount, nil
+}
@@ -5,8 +5,11 @@ import (
 	"encoding/csv"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/expensesplit/backend/internal/repository"
 	"github.com/expensesplit/backend/internal/services"
 	"github.com/expensesplit/backend/pkg/utils"
 	"github.com/google/uuid"
@@ -56,33 +59,61 @@ func (h *ExportHandler) ExportExpensesCSV(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Get all expenses
-	expenses, _, err := h.expenseService.GetTeamExpenses(teamID, 1, 10000)
+	filter, err := parseExpenseFilter(r)
+	if err != nil {
+		utils.BadRequest(w, err.Error())
+		return
+	}
+
+	team, err := h.teamService.GetTeamWithMembers(teamID)
+	if err != nil {
+		utils.InternalError(w, "Failed to get team")
+		return
+	}
+
+	// Get all expenses incurred in the requested period
+	expenses, err := h.expenseService.GetExpensesForExport(teamID, filter)
 	if err != nil {
 		utils.InternalError(w, "Failed to get expenses")
 		return
 	}
 
+	// Receipt lines of itemized expenses are listed below their expense
+	// when requested with ?include_items=true
+	includeItems := r.URL.Query().Get("include_items") == "true"
+
 	// Create CSV
 	var buf bytes.Buffer
 	writer := csv.NewWriter(&buf)
 
-	// Write header
-	header := []string{"ID", "Date", "Description", "Category", "Amount", "Paid By", "Split Type"}
+	// Write header. Amount is in the team's base currency; the original
+	// currency, amount and rate follow at the end of the row.
+	header := []string{"ID", "Date", "Description", "Category", "Amount (" + team.BaseCurrency + ")", "Paid By", "Split Type",
+		"Currency", "Original Amount", "Exchange Rate"}
+	if includeItems {
+		header = append(header, "Assigned To")
+	}
 	writer.Write(header)
 
 	// Write data
 	for _, expense := range expenses {
 		row := []string{
 			expense.ID.String(),
-			expense.CreatedAt.Format("2006-01-02"),
+			expense.IncurredOn.String(),
 			expense.Description,
 			expense.Category,
-			fmt.Sprintf("%.2f", expense.Amount),
-			expense.PaidBy.Name,
+			expense.Amount.String(),
+			formatPayers(expense),
 			string(expense.SplitType),
+			expense.Currency,
+			expense.OriginalAmount.String(),
+			expense.ExchangeRate.String(),
 		}
 		writer.Write(row)
+
+		if includeItems && expense.SplitType == models.SplitTypeItemized {
+			writeItemRows(writer, expense)
+		}
 	}
 
 	writer.Flush()
@@ -119,24 +150,53 @@ func (h *ExportHandler) ExportBalancesCSV(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Get balances
-	balances, err := h.balanceService.CalculateBalances(teamID)
-	if err != nil {
-		utils.InternalError(w, "Failed to calculate balances")
-		return
+	// Get balances, as of a closed period with ?snapshot= or as of any
+	// moment with ?as_of=
+	var balances *models.TeamBalanceSummary
+	if value := r.URL.Query().Get("snapshot"); value != "" {
+		snapshotID, err := uuid.Parse(value)
+		if err != nil {
+			utils.BadRequest(w, "Invalid snapshot ID")
+			return
+		}
+		snapshot, err := h.balanceService.GetSnapshot(teamID, snapshotID)
+		if err != nil {
+			if err == repository.ErrSnapshotNotFound {
+				utils.NotFound(w, "Snapshot not found")
+				return
+			}
+			utils.InternalError(w, "Failed to get snapshot")
+			return
+		}
+		balances = snapshot.Summary
+	} else {
+		asOf, err := parseAsOf(r)
+		if err != nil {
+			utils.BadRequest(w, err.Error())
+			return
+		}
+		if balances, err = h.balanceService.CalculateBalances(teamID, asOf); err != nil {
+			utils.InternalError(w, "Failed to calculate balances")
+			return
+		}
 	}
 
 	// Create CSV
 	var buf bytes.Buffer
 	writer := csv.NewWriter(&buf)
 
+	if balances.AsOf != nil {
+		writer.Write([]string{"Balances as of:", balances.AsOf.Format("2006-01-02 15:04:05")})
+		writer.Write([]string{})
+	}
+
 	// Write header for balances
-	writer.Write([]string{"From", "To", "Amount"})
+	writer.Write([]string{"From", "To", "Amount (" + balances.Currency + ")"})
 	for _, balance := range balances.Balances {
 		row := []string{
 			balance.FromUser.Name,
 			balance.ToUser.Name,
-			fmt.Sprintf("%.2f", balance.Amount),
+			balance.Amount.String(),
 		}
 		writer.Write(row)
 	}
@@ -150,9 +210,9 @@ func (h *ExportHandler) ExportBalancesCSV(w http.ResponseWriter, r *http.Request
 	for _, member := range balances.Members {
 		row := []string{
 			member.User.Name,
-			fmt.Sprintf("%.2f", member.TotalOwed),
-			fmt.Sprintf("%.2f", member.TotalOwing),
-			fmt.Sprintf("%.2f", member.NetBalance),
+			member.TotalOwed.String(),
+			member.TotalOwing.String(),
+			member.NetBalance.String(),
 		}
 		writer.Write(row)
 	}
@@ -166,6 +226,82 @@ func (h *ExportHandler) ExportBalancesCSV(w http.ResponseWriter, r *http.Request
 	w.Write(buf.Bytes())
 }
 
+// ExportLedgerCSV exports the ledger between the current user and the
+// member given by ?with=.
+func (h *ExportHandler) ExportLedgerCSV(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	teamID, err := uuid.Parse(vars["teamId"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid team ID")
+		return
+	}
+
+	// Check if user is a member
+	isMember, err := h.teamService.IsMember(teamID, userID)
+	if err != nil {
+		utils.InternalError(w, "Failed to check membership")
+		return
+	}
+	if !isMember {
+		utils.Forbidden(w, "You are not a member of this team")
+		return
+	}
+
+	otherID, ok := ledgerWith(w, r, h.teamService, h.balanceService, teamID, userID)
+	if !ok {
+		return
+	}
+
+	ledger, err := h.balanceService.GetLedger(teamID, userID, otherID)
+	if err != nil {
+		if err == repository.ErrUserNotFound {
+			utils.NotFound(w, "User not found")
+			return
+		}
+		utils.InternalError(w, "Failed to get ledger")
+		return
+	}
+
+	// Create CSV
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	// Amounts are owed to the current user when positive
+	writer.Write([]string{"Ledger between " + ledger.User.Name + " and " + ledger.With.Name})
+	writer.Write([]string{"Date", "Type", "Description", "Amount (" + ledger.Currency + ")",
+		"Balance (" + ledger.Currency + ")", "Note"})
+	for _, entry := range ledger.Entries {
+		note := ""
+		if entry.Settled {
+			note = "paid off"
+		}
+		writer.Write([]string{
+			entry.Date.String(),
+			string(entry.Type),
+			entry.Description,
+			entry.Amount.String(),
+			entry.Balance.String(),
+			note,
+		})
+	}
+	writer.Write([]string{})
+	writer.Write([]string{"Balance:", ledger.Balance.String()})
+
+	writer.Flush()
+
+	// Set headers for file download
+	filename := fmt.Sprintf("ledger_%s_%s_%s.csv", teamID.String()[:8], otherID.String()[:8], time.Now().Format("20060102"))
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	w.Write(buf.Bytes())
+}
+
 func (h *ExportHandler) ExportReimbursementSummary(w http.ResponseWriter, r *http.Request) {
 	userID, ok := GetUserIDFromContext(r.Context())
 	if !ok {
@@ -191,6 +327,12 @@ func (h *ExportHandler) ExportReimbursementSummary(w http.ResponseWriter, r *htt
 		return
 	}
 
+	filter, err := parseExpenseFilter(r)
+	if err != nil {
+		utils.BadRequest(w, err.Error())
+		return
+	}
+
 	// Get team info
 	team, err := h.teamService.GetTeamWithMembers(teamID)
 	if err != nil {
@@ -198,22 +340,22 @@ func (h *ExportHandler) ExportReimbursementSummary(w http.ResponseWriter, r *htt
 		return
 	}
 
-	// Get expenses
-	expenses, _, err := h.expenseService.GetTeamExpenses(teamID, 1, 10000)
+	// Get expenses incurred in the requested period
+	expenses, err := h.expenseService.GetExpensesForExport(teamID, filter)
 	if err != nil {
 		utils.InternalError(w, "Failed to get expenses")
 		return
 	}
 
 	// Get balances
-	balances, err := h.balanceService.CalculateBalances(teamID)
+	balances, err := h.balanceService.CalculateBalances(teamID, nil)
 	if err != nil {
 		utils.InternalError(w, "Failed to calculate balances")
 		return
 	}
 
 	// Calculate totals
-	var totalExpenses float64
+	var totalExpenses models.Money
 	for _, expense := range expenses {
 		totalExpenses += expense.Amount
 	}
@@ -225,23 +367,27 @@ func (h *ExportHandler) ExportReimbursementSummary(w http.ResponseWriter, r *htt
 	// Report header
 	writer.Write([]string{"REIMBURSEMENT SUMMARY REPORT"})
 	writer.Write([]string{"Team:", team.Name})
+	writer.Write([]string{"Currency:", team.BaseCurrency})
+	if period := formatPeriod(filter); period != "" {
+		writer.Write([]string{"Period:", period})
+	}
 	writer.Write([]string{"Generated:", time.Now().Format("2006-01-02 15:04:05")})
 	writer.Write([]string{})
 
 	// Summary
 	writer.Write([]string{"SUMMARY"})
-	writer.Write([]string{"Total Expenses:", fmt.Sprintf("%.2f", totalExpenses)})
+	writer.Write([]string{"Total Expenses:", totalExpenses.String()})
 	writer.Write([]string{"Number of Expenses:", fmt.Sprintf("%d", len(expenses))})
 	writer.Write([]string{})
 
 	// Settlements needed
 	writer.Write([]string{"SETTLEMENTS NEEDED"})
 	writer.Write([]string{"From", "To", "Amount"})
-	for _, balance := range balances.Balances {
+	for _, balance := range balances.Transfers {
 		writer.Write([]string{
 			balance.FromUser.Name + " (" + balance.FromUser.Email + ")",
 			balance.ToUser.Name + " (" + balance.ToUser.Email + ")",
-			fmt.Sprintf("%.2f", balance.Amount),
+			balance.Amount.String(),
 		})
 	}
 	writer.Write([]string{})
@@ -253,23 +399,24 @@ func (h *ExportHandler) ExportReimbursementSummary(w http.ResponseWriter, r *htt
 		writer.Write([]string{
 			member.User.Name,
 			member.User.Email,
-			fmt.Sprintf("%.2f", member.TotalOwed),
-			fmt.Sprintf("%.2f", member.TotalOwing),
-			fmt.Sprintf("%.2f", member.NetBalance),
+			member.TotalOwed.String(),
+			member.TotalOwing.String(),
+			member.NetBalance.String(),
 		})
 	}
 	writer.Write([]string{})
 
 	// Expense details
 	writer.Write([]string{"EXPENSE DETAILS"})
-	writer.Write([]string{"Date", "Description", "Category", "Amount", "Paid By"})
+	writer.Write([]string{"Date", "Description", "Category", "Amount", "Paid By", "Original Amount"})
 	for _, expense := range expenses {
 		writer.Write([]string{
-			expense.CreatedAt.Format("2006-01-02"),
+			expense.IncurredOn.String(),
 			expense.Description,
 			expense.Category,
-			fmt.Sprintf("%.2f", expense.Amount),
-			expense.PaidBy.Name,
+			expense.Amount.String(),
+			formatPayers(expense),
+			expense.OriginalAmount.String() + " " + expense.Currency,
 		})
 	}
 
@@ -281,3 +428,69 @@ func (h *ExportHandler) ExportReimbursementSummary(w http.ResponseWriter, r *htt
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
 	w.Write(buf.Bytes())
 }
+
+// writeItemRows lists the receipt items of an itemized expense, followed by
+// its tax, service charge and tip, in the expense's original currency.
+func writeItemRows(writer *csv.Writer, expense *models.ExpenseResponse) {
+	names := make(map[uuid.UUID]string)
+	for _, split := range expense.Splits {
+		names[split.User.ID] = split.User.Name
+	}
+
+	itemRow := func(description, amount, assignedTo string) []string {
+		return []string{expense.ID.String(), "", description, "", "", "", "item",
+			expense.Currency, amount, "", assignedTo}
+	}
+
+	for _, item := range expense.Items {
+		assigned := make([]string, len(item.AssignedTo))
+		for i, userID := range item.AssignedTo {
+			assigned[i] = names[userID]
+		}
+		writer.Write(itemRow(item.Description, item.Amount.String(), strings.Join(assigned, "; ")))
+	}
+
+	extras := []struct {
+		label  string
+		amount models.Money
+	}{
+		{"Tax", expense.Tax},
+		{"Service Charge", expense.ServiceCharge},
+		{"Tip", expense.Tip},
+	}
+	for _, extra := range extras {
+		if extra.amount != 0 {
+			writer.Write(itemRow(extra.label, extra.amount.String(), "proportional"))
+		}
+	}
+}
+
+// formatPeriod describes the incurred-on range of a filtered export, or
+// returns "" when the export is not filtered by date.
+func formatPeriod(filter repository.ExpenseFilter) string {
+	switch {
+	case !filter.From.IsZero() && !filter.To.IsZero():
+		return filter.From.String() + " to " + filter.To.String()
+	case !filter.From.IsZero():
+		return "from " + filter.From.String()
+	case !filter.To.IsZero():
+		return "until " + filter.To.String()
+	}
+	return ""
+}
+
+// formatPayers names the payer of an expense, or every payer with their
+// contribution when several members paid.
+func formatPayers(expense *models.ExpenseResponse) string {
+	if len(expense.Payers) == 0 {
+		return expense.PaidBy.Name
+	}
+	if len(expense.Payers) == 1 {
+		return expense.Payers[0].User.Name
+	}
+	names := make([]string, len(expense.Payers))
+	for i, payer := range expense.Payers {
+		names[i] = payer.User.Name + " (" + payer.Amount.String() + ")"
+	}
+	return strings.Join(names, "; ")
+}
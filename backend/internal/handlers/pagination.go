@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/expensesplit/backend/internal/repository"
+)
+
+const defaultPerPage = 20
+
+// parsePage reads the ?per_page= size and either the opaque ?cursor= of the
+// next page or a 1-based ?page= number. It returns the page number for the
+// response meta, which is 0 when paging by cursor.
+func parsePage(r *http.Request) (repository.Page, int) {
+	query := r.URL.Query()
+
+	perPage, _ := strconv.Atoi(query.Get("per_page"))
+	if perPage < 1 {
+		perPage = defaultPerPage
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		return repository.Page{Limit: perPage, Cursor: cursor}, 0
+	}
+
+	page, _ := strconv.Atoi(query.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	return repository.Page{Limit: perPage, Offset: (page - 1) * perPage}, page
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/expensesplit/backend/internal/repository"
+	"github.com/expensesplit/backend/internal/services"
+	"github.com/expensesplit/backend/pkg/utils"
+)
+
+type RateHandler struct {
+	rateService *services.ExchangeRateService
+}
+
+func NewRateHandler(rateService *services.ExchangeRateService) *RateHandler {
+	return &RateHandler{rateService: rateService}
+}
+
+func (h *RateHandler) GetRates(w http.ResponseWriter, r *http.Request) {
+	if _, ok := GetUserIDFromContext(r.Context()); !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	base := models.DefaultCurrency
+	if value := r.URL.Query().Get("base"); value != "" {
+		currency, err := models.NormalizeCurrency(value)
+		if err != nil {
+			utils.BadRequest(w, err.Error())
+			return
+		}
+		base = currency
+	}
+
+	date := time.Now()
+	if value := r.URL.Query().Get("date"); value != "" {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			utils.BadRequest(w, "Invalid date, expected YYYY-MM-DD")
+			return
+		}
+		date = parsed
+	}
+
+	rates, err := h.rateService.GetRates(base, date)
+	if err != nil {
+		if err == repository.ErrRateNotFound {
+			utils.NotFound(w, "No exchange rates available for this currency and date")
+			return
+		}
+		utils.InternalError(w, "Failed to get exchange rates")
+		return
+	}
+
+	utils.Success(w, rates, "")
+}
@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/expensesplit/backend/internal/repository"
+	"github.com/expensesplit/backend/internal/services"
+	"github.com/expensesplit/backend/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type RecurringExpenseHandler struct {
+	recurringService *services.RecurringExpenseService
+	teamService      *services.TeamService
+}
+
+func NewRecurringExpenseHandler(recurringService *services.RecurringExpenseService, teamService *services.TeamService) *RecurringExpenseHandler {
+	return &RecurringExpenseHandler{
+		recurringService: recurringService,
+		teamService:      teamService,
+	}
+}
+
+func (h *RecurringExpenseHandler) CreateRecurringExpense(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	teamID, err := uuid.Parse(vars["teamId"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid team ID")
+		return
+	}
+
+	// Check if user is a member
+	isMember, err := h.teamService.IsMember(teamID, userID)
+	if err != nil {
+		utils.InternalError(w, "Failed to check membership")
+		return
+	}
+	if !isMember {
+		utils.Forbidden(w, "You are not a member of this team")
+		return
+	}
+
+	var req models.RecurringExpenseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.BadRequest(w, "Invalid request body")
+		return
+	}
+
+	recurring, err := h.recurringService.Create(teamID, userID, &req)
+	if err != nil {
+		if isRecurringValidationError(err) {
+			utils.BadRequest(w, err.Error())
+			return
+		}
+		utils.InternalError(w, "Failed to create recurring expense")
+		return
+	}
+
+	utils.Created(w, recurring, "Recurring expense created successfully")
+}
+
+func (h *RecurringExpenseHandler) GetTeamRecurringExpenses(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	teamID, err := uuid.Parse(vars["teamId"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid team ID")
+		return
+	}
+
+	// Check if user is a member
+	isMember, err := h.teamService.IsMember(teamID, userID)
+	if err != nil {
+		utils.InternalError(w, "Failed to check membership")
+		return
+	}
+	if !isMember {
+		utils.Forbidden(w, "You are not a member of this team")
+		return
+	}
+
+	recurring, err := h.recurringService.GetTeamRecurringExpenses(teamID)
+	if err != nil {
+		utils.InternalError(w, "Failed to get recurring expenses")
+		return
+	}
+	if recurring == nil {
+		recurring = []*models.RecurringExpense{}
+	}
+
+	utils.Success(w, recurring, "")
+}
+
+func (h *RecurringExpenseHandler) GetRecurringExpense(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	teamID, err := uuid.Parse(vars["teamId"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid team ID")
+		return
+	}
+
+	// Check if user is a member
+	isMember, err := h.teamService.IsMember(teamID, userID)
+	if err != nil {
+		utils.InternalError(w, "Failed to check membership")
+		return
+	}
+	if !isMember {
+		utils.Forbidden(w, "You are not a member of this team")
+		return
+	}
+
+	id, err := uuid.Parse(vars["id"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid recurring expense ID")
+		return
+	}
+
+	recurring, err := h.recurringService.GetByID(teamID, id)
+	if err != nil {
+		if err == repository.ErrRecurringExpenseNotFound {
+			utils.NotFound(w, "Recurring expense not found")
+			return
+		}
+		utils.InternalError(w, "Failed to get recurring expense")
+		return
+	}
+
+	utils.Success(w, recurring, "")
+}
+
+func (h *RecurringExpenseHandler) UpdateRecurringExpense(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	teamID, err := uuid.Parse(vars["teamId"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid team ID")
+		return
+	}
+
+	// Check if user is a member
+	isMember, err := h.teamService.IsMember(teamID, userID)
+	if err != nil {
+		utils.InternalError(w, "Failed to check membership")
+		return
+	}
+	if !isMember {
+		utils.Forbidden(w, "You are not a member of this team")
+		return
+	}
+
+	id, err := uuid.Parse(vars["id"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid recurring expense ID")
+		return
+	}
+
+	var req models.RecurringExpenseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.BadRequest(w, "Invalid request body")
+		return
+	}
+
+	recurring, err := h.recurringService.Update(teamID, id, &req, userID)
+	if err != nil {
+		switch {
+		case err == services.ErrNotAuthorized:
+			utils.Forbidden(w, "Only the creator can update this recurring expense")
+		case err == repository.ErrRecurringExpenseNotFound:
+			utils.NotFound(w, "Recurring expense not found")
+		case isRecurringValidationError(err):
+			utils.BadRequest(w, err.Error())
+		default:
+			utils.InternalError(w, "Failed to update recurring expense")
+		}
+		return
+	}
+
+	utils.Success(w, recurring, "Recurring expense updated successfully")
+}
+
+func (h *RecurringExpenseHandler) DeleteRecurringExpense(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	teamID, err := uuid.Parse(vars["teamId"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid team ID")
+		return
+	}
+
+	// Check if user is a member
+	isMember, err := h.teamService.IsMember(teamID, userID)
+	if err != nil {
+		utils.InternalError(w, "Failed to check membership")
+		return
+	}
+	if !isMember {
+		utils.Forbidden(w, "You are not a member of this team")
+		return
+	}
+
+	id, err := uuid.Parse(vars["id"])
+	if err != nil {
+		utils.BadRequest(w, "Invalid recurring expense ID")
+		return
+	}
+
+	if err := h.recurringService.Delete(teamID, id, userID); err != nil {
+		switch err {
+		case services.ErrNotAuthorized:
+			utils.Forbidden(w, "Only the creator can delete this recurring expense")
+		case repository.ErrRecurringExpenseNotFound:
+			utils.NotFound(w, "Recurring expense not found")
+		default:
+			utils.InternalError(w, "Failed to delete recurring expense")
+		}
+		return
+	}
+
+	utils.Success(w, nil, "Recurring expense deleted successfully")
+}
+
+func isRecurringValidationError(err error) bool {
+	switch err {
+	case services.ErrInvalidFrequency, services.ErrInvalidSchedule, services.ErrInvalidSplitType,
+		services.ErrAmountRequired, services.ErrSplitWithRequired, services.ErrUnknownCategory,
+		services.ErrCategoryArchived:
+		return true
+	}
+	return false
+}
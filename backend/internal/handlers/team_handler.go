@@ -35,7 +35,7 @@ func (h *TeamHandler) CreateTeam(w http.ResponseWriter, r *http.Request) {
 
 	team, err := h.teamService.CreateTeam(&req, userID)
 	if err != nil {
-		if err == services.ErrTeamNameRequired {
+		if err == services.ErrTeamNameRequired || err == services.ErrInvalidBalanceMode || err == models.ErrInvalidCurrency {
 			utils.BadRequest(w, err.Error())
 			return
 		}
@@ -129,7 +129,7 @@ func (h *TeamHandler) AddMember(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.teamService.AddMember(teamID, &req, userID)
+	err = h.teamService.AddMember(teamID, &req, userID, GetRequestMetaFromContext(r.Context()))
 	if err != nil {
 		switch err {
 		case services.ErrNotAuthorized:
@@ -168,7 +168,7 @@ func (h *TeamHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.teamService.RemoveMember(teamID, memberID, userID)
+	err = h.teamService.RemoveMember(teamID, memberID, userID, GetRequestMetaFromContext(r.Context()))
 	if err != nil {
 		switch err {
 		case services.ErrNotAuthorized:
@@ -200,17 +200,19 @@ func (h *TeamHandler) UpdateTeam(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req models.TeamCreateRequest
+	var req models.TeamUpdateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		utils.BadRequest(w, "Invalid request body")
 		return
 	}
 
-	team, err := h.teamService.UpdateTeam(teamID, req.Name, userID)
+	team, err := h.teamService.UpdateTeam(teamID, &req, userID, GetRequestMetaFromContext(r.Context()))
 	if err != nil {
 		switch err {
 		case services.ErrNotAuthorized:
 			utils.Forbidden(w, "Only admins can update team")
+		case services.ErrTeamNameRequired, services.ErrInvalidBalanceMode:
+			utils.BadRequest(w, err.Error())
 		case repository.ErrTeamNotFound:
 			utils.NotFound(w, "Team not found")
 		default:
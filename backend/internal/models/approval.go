@@ -40,20 +40,21 @@ type ApprovalResponse struct {
 }
 
 type ReimbursementSummary struct {
-	TeamID          uuid.UUID           `json:"team_id"`
-	TeamName        string              `json:"team_name"`
-	Period          string              `json:"period"`
-	TotalExpenses   float64             `json:"total_expenses"`
-	TotalApproved   float64             `json:"total_approved"`
-	TotalPending    float64             `json:"total_pending"`
-	TotalRejected   float64             `json:"total_rejected"`
-	Expenses        []ExpenseResponse   `json:"expenses"`
-	Settlements     []SettlementSummary `json:"settlements"`
-	GeneratedAt     time.Time           `json:"generated_at"`
+	TeamID        uuid.UUID           `json:"team_id"`
+	TeamName      string              `json:"team_name"`
+	Period        string              `json:"period"`
+	Currency      string              `json:"currency"` // Team base currency all totals are in
+	TotalExpenses Money               `json:"total_expenses"`
+	TotalApproved Money               `json:"total_approved"`
+	TotalPending  Money               `json:"total_pending"`
+	TotalRejected Money               `json:"total_rejected"`
+	Expenses      []ExpenseResponse   `json:"expenses"`
+	Settlements   []SettlementSummary `json:"settlements"`
+	GeneratedAt   time.Time           `json:"generated_at"`
 }
 
 type SettlementSummary struct {
 	FromUser UserResponse `json:"from_user"`
 	ToUser   UserResponse `json:"to_user"`
-	Amount   float64      `json:"amount"`
+	Amount   Money        `json:"amount"`
 }
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AuditAction string
+
+const (
+	AuditExpenseCreated      AuditAction = "expense.created"
+	AuditExpenseUpdated      AuditAction = "expense.updated"
+	AuditExpenseDeleted      AuditAction = "expense.deleted"
+	AuditExpenseRestored     AuditAction = "expense.restored"
+	AuditExpenseReverted     AuditAction = "expense.reverted"
+	AuditSettlementRecorded  AuditAction = "settlement.recorded"
+	AuditSettlementConfirmed AuditAction = "settlement.confirmed"
+	AuditSettlementDisputed  AuditAction = "settlement.disputed"
+	AuditSettlementCancelled AuditAction = "settlement.cancelled"
+	AuditSettlementReversed  AuditAction = "settlement.reversed"
+	AuditApprovalUpdated     AuditAction = "approval.updated"
+	AuditMemberAdded         AuditAction = "member.added"
+	AuditMemberRemoved       AuditAction = "member.removed"
+	AuditTeamUpdated         AuditAction = "team.updated"
+	AuditBalancesClosed      AuditAction = "balances.closed"
+)
+
+type AuditEntity string
+
+const (
+	AuditEntityExpense    AuditEntity = "expense"
+	AuditEntitySettlement AuditEntity = "settlement"
+	AuditEntityApproval   AuditEntity = "approval"
+	AuditEntityMember     AuditEntity = "member" // EntityID is the member's user ID
+	AuditEntityTeam       AuditEntity = "team"
+	AuditEntitySnapshot   AuditEntity = "balance_snapshot"
+)
+
+// AuditEvent records one change to a team: who made it, to what, the state
+// of the entity before and after, and the request it came from. Before is
+// empty for creations and After for removals.
+type AuditEvent struct {
+	ID         uuid.UUID       `json:"id"`
+	TeamID     uuid.UUID       `json:"team_id"`
+	ActorID    uuid.UUID       `json:"actor_id"`
+	Action     AuditAction     `json:"action"`
+	EntityType AuditEntity     `json:"entity_type"`
+	EntityID   uuid.UUID       `json:"entity_id"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	RequestMeta
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RequestMeta identifies the HTTP request behind a change. It is empty for
+// changes made by background jobs.
+type RequestMeta struct {
+	RequestID string `json:"request_id,omitempty"`
+	IPAddress string `json:"ip_address,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+}
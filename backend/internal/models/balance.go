@@ -11,41 +11,181 @@ type Balance struct {
 	TeamID    uuid.UUID `json:"team_id"`
 	FromUser  uuid.UUID `json:"from_user"`
 	ToUser    uuid.UUID `json:"to_user"`
-	Amount    float64   `json:"amount"`
+	Amount    Money     `json:"amount"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type BalanceResponse struct {
 	FromUser UserResponse `json:"from_user"`
 	ToUser   UserResponse `json:"to_user"`
-	Amount   float64      `json:"amount"`
+	Amount   Money        `json:"amount"`
 }
 
 type UserBalanceSummary struct {
 	User       UserResponse `json:"user"`
-	TotalOwed  float64      `json:"total_owed"`  // Amount this user owes to others
-	TotalOwing float64      `json:"total_owing"` // Amount others owe to this user
-	NetBalance float64      `json:"net_balance"` // Positive = others owe you, Negative = you owe others
+	TotalOwed  Money        `json:"total_owed"`  // Amount this user owes to others
+	TotalOwing Money        `json:"total_owing"` // Amount others owe to this user
+	NetBalance Money        `json:"net_balance"` // Positive = others owe you, Negative = you owe others
 }
 
+// TeamBalanceSummary shows both the debts between each pair of members and
+// the transfers suggested to settle them, which depend on the team's
+// balance mode. Member totals follow the suggested transfers.
 type TeamBalanceSummary struct {
-	TeamID   uuid.UUID            `json:"team_id"`
-	TeamName string               `json:"team_name"`
-	Balances []BalanceResponse    `json:"balances"`
-	Members  []UserBalanceSummary `json:"members"`
+	TeamID      uuid.UUID            `json:"team_id"`
+	TeamName    string               `json:"team_name"`
+	Currency    string               `json:"currency"` // Team base currency all amounts are in
+	BalanceMode BalanceMode          `json:"balance_mode"`
+	Balances    []BalanceResponse    `json:"balances"`  // Pairwise debts
+	Transfers   []BalanceResponse    `json:"transfers"` // Suggested transfers
+	Members     []UserBalanceSummary `json:"members"`
+
+	// Payments that don't count towards the balances until confirmed
+	PendingSettlements []PendingSettlement `json:"pending_settlements"`
+
+	AsOf *time.Time `json:"as_of,omitempty"` // Set when showing balances at an earlier moment
 }
 
 type SettlementRequest struct {
 	FromUser uuid.UUID `json:"from_user"`
 	ToUser   uuid.UUID `json:"to_user"`
-	Amount   float64   `json:"amount"`
+	Amount   Money     `json:"amount"`
 }
 
+type SettlementStatus string
+
+const (
+	SettlementStatusPending   SettlementStatus = "pending"
+	SettlementStatusConfirmed SettlementStatus = "confirmed"
+	SettlementStatusDisputed  SettlementStatus = "disputed"
+	SettlementStatusCancelled SettlementStatus = "cancelled"
+)
+
+// Settlement is a payment from one member to another. Only confirmed
+// settlements reduce balances: a payment recorded by the payer waits for
+// the recipient to confirm or dispute it, while one recorded by the
+// recipient is confirmed right away.
 type Settlement struct {
-	ID        uuid.UUID `json:"id"`
-	TeamID    uuid.UUID `json:"team_id"`
-	FromUser  uuid.UUID `json:"from_user"`
-	ToUser    uuid.UUID `json:"to_user"`
-	Amount    float64   `json:"amount"`
-	CreatedAt time.Time `json:"created_at"`
+	ID            uuid.UUID        `json:"id"`
+	TeamID        uuid.UUID        `json:"team_id"`
+	FromUser      uuid.UUID        `json:"from_user"`
+	ToUser        uuid.UUID        `json:"to_user"`
+	Amount        Money            `json:"amount"`
+	Status        SettlementStatus `json:"status"`
+	RecordedBy    *uuid.UUID       `json:"recorded_by,omitempty"` // Unset on settlements from before confirmation
+	DisputeReason string           `json:"dispute_reason,omitempty"`
+	ResolvedAt    *time.Time       `json:"resolved_at,omitempty"` // When it was confirmed, disputed or cancelled
+	ReversesID    *uuid.UUID       `json:"reverses_id,omitempty"` // The settlement this one pays back
+	ReversedBy    *uuid.UUID       `json:"reversed_by,omitempty"` // The reversal of this settlement, unless cancelled
+	SplitID       *uuid.UUID       `json:"split_id,omitempty"`    // The split this payment was made for
+	CreatedAt     time.Time        `json:"created_at"`
+
+	// The splits this settlement paid off, once confirmed; only filled in
+	// when getting a single settlement
+	Allocations []SettlementAllocation `json:"allocations,omitempty"`
+}
+
+// SettlementAllocation is the part of a settlement applied to one split.
+type SettlementAllocation struct {
+	SettlementID uuid.UUID `json:"settlement_id"`
+	SplitID      uuid.UUID `json:"split_id"`
+	ExpenseID    uuid.UUID `json:"expense_id"`
+	Amount       Money     `json:"amount"`
+}
+
+// SettlementCorrection is the result of correcting a settlement: the
+// reversal of the original and the settlement recorded in its place.
+type SettlementCorrection struct {
+	Reversal   *Settlement `json:"reversal"`
+	Settlement *Settlement `json:"settlement"`
+}
+
+type SettlementDisputeRequest struct {
+	Reason string `json:"reason"`
+}
+
+// PendingSettlement is a settlement waiting for its recipient to confirm it.
+type PendingSettlement struct {
+	ID        uuid.UUID    `json:"id"`
+	FromUser  UserResponse `json:"from_user"`
+	ToUser    UserResponse `json:"to_user"`
+	Amount    Money        `json:"amount"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// UserBalances is the current user's balances across all of their teams.
+// Teams can have different base currencies, so totals are kept per
+// currency and counterparties are rolled up per currency.
+type UserBalances struct {
+	User           UserResponse          `json:"user"`
+	Netted         bool                  `json:"netted"` // Whether debts with each counterparty were netted across teams
+	Totals         []CurrencyBalance     `json:"totals"`
+	Counterparties []CounterpartyBalance `json:"counterparties"`
+	Teams          []TeamUserBalance     `json:"teams"`
+}
+
+type CurrencyBalance struct {
+	Currency   string `json:"currency"`
+	TotalOwed  Money  `json:"total_owed"`
+	TotalOwing Money  `json:"total_owing"`
+	NetBalance Money  `json:"net_balance"`
+}
+
+// CounterpartyBalance is what the current user and one other person owe
+// each other in the teams that use a currency.
+type CounterpartyBalance struct {
+	User       UserResponse     `json:"user"`
+	Currency   string           `json:"currency"`
+	TotalOwed  Money            `json:"total_owed"`  // Amount the current user owes them
+	TotalOwing Money            `json:"total_owing"` // Amount they owe the current user
+	NetBalance Money            `json:"net_balance"` // Positive = they owe you
+	Teams      []TeamNetBalance `json:"teams"`
+}
+
+type TeamNetBalance struct {
+	TeamID     uuid.UUID `json:"team_id"`
+	TeamName   string    `json:"team_name"`
+	NetBalance Money     `json:"net_balance"`
+}
+
+// TeamUserBalance is the current user's summary in one team, as returned
+// by the team's balances/me.
+type TeamUserBalance struct {
+	TeamID      uuid.UUID          `json:"team_id"`
+	TeamName    string             `json:"team_name"`
+	Currency    string             `json:"currency"`
+	BalanceMode BalanceMode        `json:"balance_mode"`
+	Summary     UserBalanceSummary `json:"summary"`
+}
+
+// BalanceSnapshot keeps a team's balances at the close of a period so they
+// can be reported on later, whatever changes after. Snapshots are never
+// updated.
+type BalanceSnapshot struct {
+	ID          uuid.UUID   `json:"id"`
+	TeamID      uuid.UUID   `json:"team_id"`
+	Label       string      `json:"label,omitempty"`
+	AsOf        time.Time   `json:"as_of"`
+	Currency    string      `json:"currency"`
+	BalanceMode BalanceMode `json:"balance_mode"`
+	ClosedBy    uuid.UUID   `json:"closed_by"`
+	CreatedAt   time.Time   `json:"created_at"`
+	Balances    []Balance   `json:"balances"` // What each member owed each other member
+}
+
+type BalanceSnapshotResponse struct {
+	ID        uuid.UUID    `json:"id"`
+	Label     string       `json:"label,omitempty"`
+	AsOf      time.Time    `json:"as_of"`
+	ClosedBy  UserResponse `json:"closed_by"`
+	CreatedAt time.Time    `json:"created_at"`
+
+	// Balances as of the close; left out of listings
+	Summary *TeamBalanceSummary `json:"summary,omitempty"`
+}
+
+// PeriodCloseRequest closes the period ending at AsOf, or now if unset.
+type PeriodCloseRequest struct {
+	AsOf  *time.Time `json:"as_of"`
+	Label string     `json:"label"`
 }
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type BudgetPeriod string
+
+const (
+	BudgetPeriodWeekly    BudgetPeriod = "weekly" // Monday to Sunday
+	BudgetPeriodMonthly   BudgetPeriod = "monthly"
+	BudgetPeriodQuarterly BudgetPeriod = "quarterly"
+	BudgetPeriodYearly    BudgetPeriod = "yearly"
+	BudgetPeriodCustom    BudgetPeriod = "custom" // A single period from StartDate to EndDate
+)
+
+// DefaultWarnPercent is the share of a budget at which a warning is raised
+// when no threshold is set.
+const DefaultWarnPercent = 80
+
+// Budget limits what a team spends per period, optionally only in one
+// category (including its subcategories) and optionally only for one member.
+// A member budget counts the member's share of expenses; other budgets count
+// full expense amounts. Amounts are in the team's base currency.
+type Budget struct {
+	ID          uuid.UUID    `json:"id"`
+	TeamID      uuid.UUID    `json:"team_id"`
+	CategoryID  *uuid.UUID   `json:"category_id,omitempty"`
+	UserID      *uuid.UUID   `json:"user_id,omitempty"`
+	Amount      Money        `json:"amount"`
+	Period      BudgetPeriod `json:"period"`
+	StartDate   Date         `json:"start_date"`
+	EndDate     *Date        `json:"end_date,omitempty"`
+	WarnPercent int          `json:"warn_percent"`
+	CreatedBy   uuid.UUID    `json:"created_by"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+type BudgetRequest struct {
+	CategoryID  *uuid.UUID   `json:"category_id,omitempty"`
+	UserID      *uuid.UUID   `json:"user_id,omitempty"`
+	Amount      Money        `json:"amount"`
+	Period      BudgetPeriod `json:"period"`
+	StartDate   *Date        `json:"start_date,omitempty"` // Defaults to today
+	EndDate     *Date        `json:"end_date,omitempty"`   // Required for custom periods
+	WarnPercent int          `json:"warn_percent,omitempty"`
+}
+
+// BudgetStatusLevel is how far spending has progressed through a budget.
+type BudgetStatusLevel string
+
+const (
+	BudgetStatusOK       BudgetStatusLevel = "ok"
+	BudgetStatusWarning  BudgetStatusLevel = "warning"
+	BudgetStatusExceeded BudgetStatusLevel = "exceeded"
+)
+
+type BudgetStatus struct {
+	Budget        Budget            `json:"budget"`
+	Category      string            `json:"category,omitempty"`
+	PeriodStart   Date              `json:"period_start"`
+	PeriodEnd     Date              `json:"period_end"`
+	Spent         Money             `json:"spent"`
+	Remaining     Money             `json:"remaining"`
+	PercentUsed   float64           `json:"percent_used"`
+	Projected     Money             `json:"projected"` // Spent at the current daily rate by the end of the period
+	Status        BudgetStatusLevel `json:"status"`
+	ProjectedOver bool              `json:"projected_over"`
+}
+
+type BudgetStatusResponse struct {
+	TeamID   uuid.UUID      `json:"team_id"`
+	Currency string         `json:"currency"`
+	Date     Date           `json:"date"`
+	Budgets  []BudgetStatus `json:"budgets"`
+}
+
+// BudgetEvent records an expense pushing a budget past its warning
+// threshold or past its full amount, for notifications.
+type BudgetEvent struct {
+	ID          uuid.UUID         `json:"id"`
+	BudgetID    uuid.UUID         `json:"budget_id"`
+	TeamID      uuid.UUID         `json:"team_id"`
+	ExpenseID   *uuid.UUID        `json:"expense_id,omitempty"`
+	Level       BudgetStatusLevel `json:"level"`
+	PeriodStart Date              `json:"period_start"`
+	Spent       Money             `json:"spent"`
+	Amount      Money             `json:"amount"`
+	NotifiedAt  *time.Time        `json:"notified_at,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
+// BudgetWarning is returned with an expense that pushed a budget past a
+// threshold.
+type BudgetWarning struct {
+	BudgetID    uuid.UUID         `json:"budget_id"`
+	Level       BudgetStatusLevel `json:"level"`
+	Category    string            `json:"category,omitempty"`
+	UserID      *uuid.UUID        `json:"user_id,omitempty"`
+	Spent       Money             `json:"spent"`
+	Amount      Money             `json:"amount"`
+	PeriodStart Date              `json:"period_start"`
+	PeriodEnd   Date              `json:"period_end"`
+	Message     string            `json:"message"`
+}
+
+// PeriodContaining returns the first and last day of the budget period that
+// contains day.
+func (b *Budget) PeriodContaining(day Date) (Date, Date) {
+	year, month, _ := day.Date()
+	switch b.Period {
+	case BudgetPeriodWeekly:
+		offset := (int(day.Weekday()) + 6) % 7 // Days since Monday
+		start := NewDate(day.AddDate(0, 0, -offset))
+		return start, NewDate(start.AddDate(0, 0, 6))
+	case BudgetPeriodQuarterly:
+		first := time.Month((int(month)-1)/3*3 + 1)
+		start := Date{time.Date(year, first, 1, 0, 0, 0, 0, time.UTC)}
+		return start, NewDate(start.AddDate(0, 3, -1))
+	case BudgetPeriodYearly:
+		start := Date{time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)}
+		return start, NewDate(start.AddDate(1, 0, -1))
+	case BudgetPeriodCustom:
+		end := b.StartDate
+		if b.EndDate != nil {
+			end = *b.EndDate
+		}
+		return b.StartDate, end
+	default:
+		start := Date{time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)}
+		return start, NewDate(start.AddDate(0, 1, -1))
+	}
+}
+
+// Applies reports whether the budget covers day.
+func (b *Budget) Applies(day Date) bool {
+	if day.Before(b.StartDate.Time) {
+		return false
+	}
+	return b.EndDate == nil || !day.After(b.EndDate.Time)
+}
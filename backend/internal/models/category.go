@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Category is an expense category defined by a team. Categories can be
+// nested under a parent category of the same team. Archived categories are
+// kept for existing expenses but can no longer be chosen for new ones.
+//
+// Expenses refer to their category by name, so renaming a category renames
+// it on all of the team's expenses as well.
+type Category struct {
+	ID        uuid.UUID  `json:"id"`
+	TeamID    uuid.UUID  `json:"team_id"`
+	Name      string     `json:"name"`
+	ParentID  *uuid.UUID `json:"parent_id,omitempty"`
+	Archived  bool       `json:"archived"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+type CategoryCreateRequest struct {
+	Name     string     `json:"name"`
+	ParentID *uuid.UUID `json:"parent_id,omitempty"`
+}
+
+type CategoryUpdateRequest struct {
+	Name         *string    `json:"name,omitempty"`
+	ParentID     *uuid.UUID `json:"parent_id,omitempty"`
+	RemoveParent bool       `json:"remove_parent,omitempty"` // Make it a top-level category
+	Archived     *bool      `json:"archived,omitempty"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"errors"
+	"strings"
+)
+
+// DefaultCurrency is the base currency assigned to teams that don't pick one.
+const DefaultCurrency = "USD"
+
+var ErrInvalidCurrency = errors.New("currency must be a 3-letter ISO 4217 code")
+
+// NormalizeCurrency upper-cases and validates an ISO 4217 currency code.
+func NormalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 3 {
+		return "", ErrInvalidCurrency
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return "", ErrInvalidCurrency
+		}
+	}
+	return code, nil
+}
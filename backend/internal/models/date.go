@@ -0,0 +1,96 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DateLayout is the format of calendar dates in the API and in exports.
+const DateLayout = "2006-01-02"
+
+var ErrInvalidDate = errors.New("invalid date, expected YYYY-MM-DD")
+
+// Date is a calendar day without a time of day, stored in DATE columns and
+// encoded in JSON as "YYYY-MM-DD".
+type Date struct {
+	time.Time
+}
+
+// NewDate returns the calendar day of t in t's location.
+func NewDate(t time.Time) Date {
+	year, month, day := t.Date()
+	return Date{time.Date(year, month, day, 0, 0, 0, 0, time.UTC)}
+}
+
+// Today returns the current day in the server's local time.
+func Today() Date {
+	return NewDate(time.Now())
+}
+
+func ParseDate(s string) (Date, error) {
+	t, err := time.Parse(DateLayout, strings.TrimSpace(s))
+	if err != nil {
+		return Date{}, ErrInvalidDate
+	}
+	return Date{t}, nil
+}
+
+func (d Date) String() string {
+	return d.Format(DateLayout)
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + d.String() + `"`), nil
+}
+
+func (d *Date) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	parsed, err := ParseDate(strings.Trim(s, `"`))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Scan implements sql.Scanner for DATE columns.
+func (d *Date) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*d = Date{}
+		return nil
+	case time.Time:
+		*d = NewDate(v)
+		return nil
+	case []byte:
+		parsed, err := ParseDate(string(v)[:min(len(v), len(DateLayout))])
+		if err != nil {
+			return err
+		}
+		*d = parsed
+		return nil
+	case string:
+		parsed, err := ParseDate(v[:min(len(v), len(DateLayout))])
+		if err != nil {
+			return err
+		}
+		*d = parsed
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into Date", src)
+	}
+}
+
+// Value implements driver.Valuer.
+func (d Date) Value() (driver.Value, error) {
+	if d.IsZero() {
+		return nil, nil
+	}
+	return d.String(), nil
+}
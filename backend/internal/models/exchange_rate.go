@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// ExchangeRate is the price of one unit of BaseCurrency in QuoteCurrency,
+// effective from EffectiveDate until the next imported date.
+type ExchangeRate struct {
+	BaseCurrency  string    `json:"base_currency"`
+	QuoteCurrency string    `json:"quote_currency"`
+	EffectiveDate time.Time `json:"effective_date"`
+	Rate          Rate      `json:"rate"`
+	Source        string    `json:"source"`
+}
+
+type RateQuote struct {
+	Currency      string `json:"currency"`
+	Rate          Rate   `json:"rate"`
+	EffectiveDate string `json:"effective_date"` // Date of the rate actually used (YYYY-MM-DD)
+}
+
+type RatesResponse struct {
+	Base  string      `json:"base"`
+	Date  string      `json:"date"`
+	Rates []RateQuote `json:"rates"`
+}
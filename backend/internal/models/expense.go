@@ -12,75 +12,195 @@ const (
 	SplitTypeEqual   SplitType = "equal"
 	SplitTypeCustom  SplitType = "custom"
 	SplitTypePercent SplitType = "percent"
+	SplitTypeShares  SplitType = "shares"
+	// SplitTypeItemized divides line items between the members they are
+	// assigned to and allocates tax, service charge and tip proportionally
+	// to each member's item subtotal.
+	SplitTypeItemized SplitType = "itemized"
 )
 
+// Expense amounts are kept in the team's base currency. The amount the
+// expense was originally entered in is preserved together with the exchange
+// rate used, so later rate changes never move existing balances.
+//
+// PaidBy is the member who recorded the expense and may edit it; who
+// actually paid, and how much, is kept in the expense's ExpensePayers.
 type Expense struct {
-	ID          uuid.UUID `json:"id"`
-	TeamID      uuid.UUID `json:"team_id"`
-	PaidBy      uuid.UUID `json:"paid_by"`
-	Amount      float64   `json:"amount"`
-	Description string    `json:"description"`
-	Category    string    `json:"category"`
-	ReceiptURL  string    `json:"receipt_url,omitempty"`
-	SplitType   SplitType `json:"split_type"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID             uuid.UUID `json:"id"`
+	TeamID         uuid.UUID `json:"team_id"`
+	PaidBy         uuid.UUID `json:"paid_by"`
+	Amount         Money     `json:"amount"` // In the team's base currency
+	Currency       string    `json:"currency"`
+	OriginalAmount Money     `json:"original_amount"`          // In Currency
+	ExchangeRate   Rate      `json:"exchange_rate"`            // Currency -> base currency
+	Tax            Money     `json:"tax,omitempty"`            // Itemized expenses only, in Currency
+	ServiceCharge  Money     `json:"service_charge,omitempty"` // Itemized expenses only, in Currency
+	Tip            Money     `json:"tip,omitempty"`            // Itemized expenses only, in Currency
+	Description    string    `json:"description"`
+	Category       string    `json:"category"`
+	ReceiptURL     string    `json:"receipt_url,omitempty"`
+	SplitType      SplitType `json:"split_type"`
+	IncurredOn     Date      `json:"incurred_on"` // When the money was spent
+	CreatedAt      time.Time `json:"created_at"`  // When the expense was entered
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	// Set on expenses created from a recurring expense, for the occurrence
+	// they were created for
+	RecurringExpenseID *uuid.UUID `json:"recurring_expense_id,omitempty"`
+	OccurrenceDate     Date       `json:"-"`
+
+	// Set while the expense is in the trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy *uuid.UUID `json:"deleted_by,omitempty"`
 }
 
 type ExpenseSplit struct {
 	ID        uuid.UUID `json:"id"`
 	ExpenseID uuid.UUID `json:"expense_id"`
 	UserID    uuid.UUID `json:"user_id"`
-	Amount    float64   `json:"amount"`
+	Amount    Money     `json:"amount"`
 	Percent   float64   `json:"percent,omitempty"`
-	IsSettled bool      `json:"is_settled"`
+	Shares    int64     `json:"shares,omitempty"` // Share weight for SplitTypeShares
+	IsSettled bool      `json:"is_settled"`       // Worked out from SettledAmount, not stored
+
+	// What settlements have paid off so far. Splits are settled once
+	// everything they owe is paid, and count towards balances in full
+	// either way since the settlements themselves reduce balances.
+	SettledAmount Money `json:"settled_amount"`
+}
+
+// ExpensePayer is one member's contribution towards paying an expense.
+// The contributions of an expense add up to its amount.
+type ExpensePayer struct {
+	ExpenseID uuid.UUID `json:"expense_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Amount    Money     `json:"amount"` // In the team's base currency
 }
 
 type ExpenseCreateRequest struct {
-	Amount      float64            `json:"amount"`
-	Description string             `json:"description"`
-	Category    string             `json:"category"`
-	SplitType   SplitType          `json:"split_type"`
-	SplitWith   []uuid.UUID        `json:"split_with"`             // User IDs to split with
-	CustomSplit []CustomSplitEntry `json:"custom_split,omitempty"` // For custom splits
+	Amount       Money              `json:"amount"`                  // In Currency
+	Currency     string             `json:"currency,omitempty"`      // Defaults to the team's base currency
+	ExchangeRate Rate               `json:"exchange_rate,omitempty"` // Required when Currency differs from the base currency
+	Description  string             `json:"description"`
+	Category     string             `json:"category"`
+	IncurredOn   *Date              `json:"incurred_on,omitempty"` // Defaults to today
+	Payers       []PayerEntry       `json:"payers,omitempty"`      // Defaults to the requester paying the full amount
+	SplitType    SplitType          `json:"split_type"`
+	SplitWith    []uuid.UUID        `json:"split_with"`             // User IDs to split with
+	CustomSplit  []CustomSplitEntry `json:"custom_split,omitempty"` // For custom splits, amounts in Currency
+
+	// Itemized splits. Amount may be left at 0 to use the sum of the items
+	// plus tax, service charge and tip.
+	Items         []ExpenseItemEntry `json:"items,omitempty"`
+	Tax           Money              `json:"tax,omitempty"`
+	ServiceCharge Money              `json:"service_charge,omitempty"`
+	Tip           Money              `json:"tip,omitempty"`
+
+	// Set by the recurring expense scheduler only
+	RecurringExpenseID *uuid.UUID `json:"-"`
+	OccurrenceDate     Date       `json:"-"`
+}
+
+type PayerEntry struct {
+	UserID uuid.UUID `json:"user_id"`
+	Amount Money     `json:"amount"` // In the expense currency
 }
 
 type CustomSplitEntry struct {
 	UserID  uuid.UUID `json:"user_id"`
-	Amount  float64   `json:"amount,omitempty"`
+	Amount  Money     `json:"amount,omitempty"`
 	Percent float64   `json:"percent,omitempty"`
+	Shares  int64     `json:"shares,omitempty"`
+}
+
+// ExpenseItem is a receipt line of an itemized expense.
+type ExpenseItem struct {
+	ID          uuid.UUID   `json:"id"`
+	ExpenseID   uuid.UUID   `json:"expense_id"`
+	Position    int         `json:"position"`
+	Description string      `json:"description"`
+	Amount      Money       `json:"amount"` // In the expense currency
+	AssignedTo  []uuid.UUID `json:"assigned_to"`
+}
+
+type ExpenseItemEntry struct {
+	Description string      `json:"description"`
+	Amount      Money       `json:"amount"`
+	AssignedTo  []uuid.UUID `json:"assigned_to"`
 }
 
 type ExpenseUpdateRequest struct {
-	Amount      *float64 `json:"amount,omitempty"`
-	Description *string  `json:"description,omitempty"`
-	Category    *string  `json:"category,omitempty"`
+	Amount      *Money  `json:"amount,omitempty"` // In the expense currency
+	Description *string `json:"description,omitempty"`
+	Category    *string `json:"category,omitempty"`
+	IncurredOn  *Date   `json:"incurred_on,omitempty"`
+
+	// Payers replaces the payer contributions. It must be sent again when
+	// the amount of an expense with several payers changes.
+	Payers []PayerEntry `json:"payers,omitempty"`
+
+	// Split changes. Fields that are left out keep their current value;
+	// when any of them or Amount is given, all splits are recomputed.
+	// Custom amounts must be sent again whenever a custom split changes.
+	SplitType     *SplitType         `json:"split_type,omitempty"`
+	SplitWith     []uuid.UUID        `json:"split_with,omitempty"`
+	CustomSplit   []CustomSplitEntry `json:"custom_split,omitempty"`
+	Items         []ExpenseItemEntry `json:"items,omitempty"`
+	Tax           *Money             `json:"tax,omitempty"`
+	ServiceCharge *Money             `json:"service_charge,omitempty"`
+	Tip           *Money             `json:"tip,omitempty"`
+
+	// Why the expense was changed, kept in its revision history
+	Reason string `json:"reason,omitempty"`
 }
 
 type ExpenseResponse struct {
 	ID             uuid.UUID            `json:"id"`
 	TeamID         uuid.UUID            `json:"team_id"`
 	PaidBy         UserResponse         `json:"paid_by"`
-	Amount         float64              `json:"amount"`
+	Payers         []ExpensePayerDetail `json:"payers"`
+	Amount         Money                `json:"amount"`
+	Currency       string               `json:"currency"`
+	OriginalAmount Money                `json:"original_amount"`
+	ExchangeRate   Rate                 `json:"exchange_rate"`
+	Tax            Money                `json:"tax,omitempty"`
+	ServiceCharge  Money                `json:"service_charge,omitempty"`
+	Tip            Money                `json:"tip,omitempty"`
 	Description    string               `json:"description"`
 	Category       string               `json:"category"`
 	ReceiptURL     string               `json:"receipt_url,omitempty"`
 	SplitType      SplitType            `json:"split_type"`
 	Splits         []ExpenseSplitDetail `json:"splits"`
+	Items          []ExpenseItem        `json:"items,omitempty"`
 	ApprovalStatus ApprovalStatus       `json:"approval_status"`
+	IncurredOn     Date                 `json:"incurred_on"`
 	CreatedAt      time.Time            `json:"created_at"`
+
+	RecurringExpenseID *uuid.UUID      `json:"recurring_expense_id,omitempty"`
+	BudgetWarnings     []BudgetWarning `json:"budget_warnings,omitempty"` // Only set when the expense is created
+	DeletedAt          *time.Time      `json:"deleted_at,omitempty"`
+	DeletedBy          *uuid.UUID      `json:"deleted_by,omitempty"`
+}
+
+type ExpensePayerDetail struct {
+	User   UserResponse `json:"user"`
+	Amount Money        `json:"amount"`
 }
 
 type ExpenseSplitDetail struct {
 	ID        uuid.UUID    `json:"id"`
 	User      UserResponse `json:"user"`
-	Amount    float64      `json:"amount"`
+	Amount    Money        `json:"amount"`
 	Percent   float64      `json:"percent,omitempty"`
+	Shares    int64        `json:"shares,omitempty"`
 	IsSettled bool         `json:"is_settled"`
+
+	SettledAmount Money `json:"settled_amount"` // Paid off by settlements so far
 }
 
-// Categories for expenses
-var ExpenseCategories = []string{
+// DefaultExpenseCategories are the categories every new team starts with.
+// Teams manage their own categories from there on; see Category.
+var DefaultExpenseCategories = []string{
 	"Food & Dining",
 	"Transportation",
 	"Accommodation",
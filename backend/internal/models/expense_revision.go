@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ExpenseSnapshot is an expense together with its payers, splits and receipt
+// items at one point in time.
+type ExpenseSnapshot struct {
+	Expense Expense        `json:"expense"`
+	Payers  []ExpensePayer `json:"payers"`
+	Splits  []ExpenseSplit `json:"splits"`
+	Items   []ExpenseItem  `json:"items,omitempty"`
+}
+
+// ExpenseRevision is one version of an expense. Revisions are numbered from
+// 1 per expense; a new one is kept every time the expense is created,
+// changed or reverted.
+type ExpenseRevision struct {
+	ID        uuid.UUID       `json:"id"`
+	ExpenseID uuid.UUID       `json:"expense_id"`
+	Revision  int             `json:"revision"`
+	EditedBy  uuid.UUID       `json:"edited_by"`
+	Reason    string          `json:"reason,omitempty"`
+	Snapshot  ExpenseSnapshot `json:"snapshot"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// FieldChange is the change of one field between two revisions. Splits and
+// payers are compared per member, as "splits.<user id>" and
+// "payers.<user id>"; Old or New is nil when the member was added or removed.
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+type ExpenseRevisionResponse struct {
+	Revision  int             `json:"revision"`
+	EditedBy  UserResponse    `json:"edited_by"`
+	Reason    string          `json:"reason,omitempty"`
+	Changes   []FieldChange   `json:"changes"` // Relative to the previous revision
+	Snapshot  ExpenseSnapshot `json:"snapshot"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type ExpenseRevertRequest struct {
+	Revision int    `json:"revision"`
+	Reason   string `json:"reason,omitempty"`
+}
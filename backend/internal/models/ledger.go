@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type LedgerEntryType string
+
+const (
+	LedgerEntryExpense    LedgerEntryType = "expense"
+	LedgerEntrySettlement LedgerEntryType = "settlement"
+)
+
+// LedgerEntry is one expense split or settlement between two members.
+// Amounts are seen from the member the ledger is for: positive amounts are
+// owed to them, negative ones are owed by them.
+type LedgerEntry struct {
+	Type        LedgerEntryType `json:"type"`
+	ID          uuid.UUID       `json:"id"` // The expense or settlement
+	Date        Date            `json:"date"`
+	Description string          `json:"description"`
+	Amount      Money           `json:"amount"`
+	Settled     bool            `json:"settled,omitempty"` // Split paid off by settlements
+	Balance     Money           `json:"balance"`           // Running balance after this entry
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// Ledger explains the balance between a member and one other member of a
+// team, entry by entry in date order. Its balance is positive when the
+// other member owes money.
+type Ledger struct {
+	TeamID   uuid.UUID     `json:"team_id"`
+	Currency string        `json:"currency"`
+	User     UserResponse  `json:"user"`
+	With     UserResponse  `json:"with"`
+	Entries  []LedgerEntry `json:"entries"`
+	Balance  Money         `json:"balance"`
+}
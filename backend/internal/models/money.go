@@ -0,0 +1,283 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidMoney  = errors.New("invalid money amount")
+	ErrNegativeShare = errors.New("weights to allocate by must not be negative")
+)
+
+// Money is an amount expressed in integer minor units (cents).
+//
+// It is encoded in JSON as a decimal number with two fractional digits
+// (e.g. 33.33), so API clients keep sending and receiving plain numbers,
+// and it is stored in DECIMAL(10,2) columns without going through float64.
+type Money int64
+
+// NewMoneyFromString parses a decimal string such as "12.34" or "-5".
+// Digits beyond the second decimal place are rounded half away from zero.
+func NewMoneyFromString(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, ErrInvalidMoney
+	}
+
+	negative := false
+	switch s[0] {
+	case '-':
+		negative = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return 0, ErrInvalidMoney
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	if !isDigits(whole) || !isDigits(frac) {
+		return 0, ErrInvalidMoney
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidMoney
+	}
+
+	// Pad or cut the fraction to exactly two digits and remember the
+	// first dropped digit for rounding.
+	roundUp := len(frac) > 2 && frac[2] >= '5'
+	frac = (frac + "00")[:2]
+	cents, _ := strconv.ParseInt(frac, 10, 64)
+
+	total := units*100 + cents
+	if roundUp {
+		total++
+	}
+	if negative {
+		total = -total
+	}
+	return Money(total), nil
+}
+
+// NewMoneyFromFloat converts a float amount, rounding to the nearest cent.
+// Prefer integer arithmetic on Money wherever the inputs are already exact.
+func NewMoneyFromFloat(f float64) Money {
+	m, err := NewMoneyFromString(strconv.FormatFloat(f, 'f', -1, 64))
+	if err != nil {
+		return 0
+	}
+	return m
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Cents returns the amount in minor units.
+func (m Money) Cents() int64 {
+	return int64(m)
+}
+
+// Float64 returns the amount in major units. Only use it for display or
+// ratios, never to compute amounts that are stored again.
+func (m Money) Float64() float64 {
+	return float64(m) / 100
+}
+
+// String formats the amount with exactly two decimals, e.g. "-12.05".
+func (m Money) String() string {
+	sign := ""
+	v := int64(m)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/100, v%100)
+}
+
+// Abs returns the absolute value of the amount.
+func (m Money) Abs() Money {
+	if m < 0 {
+		return -m
+	}
+	return m
+}
+
+// Allocate splits the amount into len(weights) parts proportional to the
+// given non-negative weights. The parts always add up exactly to m. A
+// negative weight is rejected with ErrNegativeShare.
+//
+// Every part first receives the floor of its exact share. The cents left
+// over are then handed out one at a time to the parts with the largest
+// remainder; ties go to the part that comes first in weights. With equal
+// weights this means the first participants in request order each get one
+// extra cent.
+func (m Money) Allocate(weights []int64) ([]Money, error) {
+	parts := make([]Money, len(weights))
+	if len(weights) == 0 {
+		return parts, nil
+	}
+
+	var totalWeight int64
+	for _, w := range weights {
+		if w < 0 {
+			return nil, ErrNegativeShare
+		}
+		totalWeight += w
+	}
+	if totalWeight <= 0 {
+		return parts, nil
+	}
+
+	amount := int64(m)
+	negative := amount < 0
+	if negative {
+		amount = -amount
+	}
+
+	remainders := make([]uint64, len(weights))
+	var allocated int64
+	for i, w := range weights {
+		share, rem := mulDiv(amount, w, totalWeight)
+		parts[i] = Money(share)
+		remainders[i] = rem
+		allocated += share
+	}
+
+	given := make([]bool, len(weights))
+	for left := amount - allocated; left > 0; left-- {
+		best := -1
+		for i := range remainders {
+			if weights[i] == 0 || given[i] {
+				continue
+			}
+			if best == -1 || remainders[i] > remainders[best] {
+				best = i
+			}
+		}
+		parts[best]++
+		given[best] = true
+	}
+
+	if negative {
+		for i := range parts {
+			parts[i] = -parts[i]
+		}
+	}
+	return parts, nil
+}
+
+// AllocateEqually splits the amount into n parts that differ by at most one
+// cent; see Allocate for how the leftover cents are assigned.
+func (m Money) AllocateEqually(n int) []Money {
+	weights := make([]int64, n)
+	for i := range weights {
+		weights[i] = 1
+	}
+	// Equal weights are never negative
+	parts, _ := m.Allocate(weights)
+	return parts
+}
+
+// mulDiv returns floor(a*b/c) and the remainder for non-negative inputs
+// with b <= c, using a 128-bit intermediate so large amounts cannot overflow.
+func mulDiv(a, b, c int64) (int64, uint64) {
+	hi, lo := bits.Mul64(uint64(a), uint64(b))
+	quo, rem := bits.Div64(hi, lo, uint64(c))
+	return int64(quo), rem
+}
+
+// MarshalJSON encodes the amount as a JSON number with two decimals.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a numeric string.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	s = strings.Trim(s, `"`)
+	// JSON numbers may use exponent notation, which the decimal parser
+	// does not handle.
+	if strings.ContainsAny(s, "eE") {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return ErrInvalidMoney
+		}
+		*m = NewMoneyFromFloat(f)
+		return nil
+	}
+	v, err := NewMoneyFromString(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// Scan implements sql.Scanner for DECIMAL columns.
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+		return nil
+	case []byte:
+		parsed, err := NewMoneyFromString(string(v))
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	case string:
+		parsed, err := NewMoneyFromString(v)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	case int64:
+		*m = Money(v * 100)
+		return nil
+	case float64:
+		*m = NewMoneyFromFloat(v)
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+}
+
+// Value implements driver.Valuer, writing the amount as an exact decimal.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// Convert multiplies the amount by an exchange rate and rounds the result
+// half away from zero to the nearest cent. The product is computed exactly,
+// so it fails only if the converted amount does not fit in Money.
+func (m Money) Convert(rate Rate) (Money, error) {
+	product := new(big.Int).Mul(big.NewInt(int64(m)), big.NewInt(int64(rate)))
+	converted, ok := divRound(product, rateScale)
+	if !ok {
+		return 0, ErrInvalidMoney
+	}
+	return Money(converted), nil
+}
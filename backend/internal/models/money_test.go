@@ -0,0 +1,82 @@
+package models
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  Money
+		weights []int64
+		want    []Money
+	}{
+		{"equal weights", 1000, []int64{1, 1, 1}, []Money{334, 333, 333}},
+		{"percent basis points", 1001, []int64{5000, 5000}, []Money{501, 500}},
+		{"negative amount", -1000, []int64{1, 1, 1}, []Money{-334, -333, -333}},
+		{"zero weight", 100, []int64{0, 1}, []Money{0, 100}},
+		{"no weights", 100, nil, []Money{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.amount.Allocate(tt.weights)
+			if err != nil {
+				t.Fatalf("Allocate(%v) returned %v", tt.weights, err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Allocate(%v) = %v, want %v", tt.weights, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Allocate(%v) = %v, want %v", tt.weights, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAllocateRejectsNegativeWeights(t *testing.T) {
+	for _, weights := range [][]int64{{-5000, 15000}, {1, -1, 1}} {
+		if _, err := Money(10000).Allocate(weights); err != ErrNegativeShare {
+			t.Errorf("Allocate(%v) error = %v, want %v", weights, err, ErrNegativeShare)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount Money
+		rate   string
+		want   Money
+	}{
+		{"plain rate", 10000, "1.0845", 10845},
+		{"half cent rounds away from zero", 1, "0.5", 1},
+		{"negative half cent", -1, "0.5", -1},
+		{"beyond float precision", 9007199254740993, "1", 9007199254740993},
+		{"large amount", 900719925474099300, "0.12345678", 111199981680872273},
+		{"all eight decimals", 123456789, "1.23456789", 152415788},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, err := NewRateFromString(tt.rate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := tt.amount.Convert(rate)
+			if err != nil {
+				t.Fatalf("%s.Convert(%s) returned %v", tt.amount, tt.rate, err)
+			}
+			if got != tt.want {
+				t.Errorf("%s.Convert(%s) = %s, want %s", tt.amount, tt.rate, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertOverflow(t *testing.T) {
+	if _, err := Money(math.MaxInt64).Convert(2 * RateOne); err != ErrInvalidMoney {
+		t.Errorf("Convert error = %v, want %v", err, ErrInvalidMoney)
+	}
+}
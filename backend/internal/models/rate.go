@@ -0,0 +1,145 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+var ErrInvalidRate = errors.New("invalid exchange rate")
+
+// rateDecimals is the number of decimals kept for exchange rates, matching
+// the DECIMAL(18,8) columns they are stored in.
+const rateDecimals = 8
+
+// RateOne is the rate between a currency and itself.
+const RateOne Rate = 100000000
+
+var rateScale = big.NewInt(int64(RateOne))
+
+// Rate is an exchange rate in units of 10^-8, so rates are kept and
+// multiplied exactly instead of drifting through float64.
+//
+// It is encoded in JSON as a decimal number without trailing zeros (e.g.
+// 1.0845) and stored in DECIMAL(18,8) columns as an exact decimal.
+type Rate int64
+
+// NewRateFromString parses a decimal string such as "1.0845" or "7.4e-05".
+// Digits beyond the eighth decimal place are rounded half away from zero.
+func NewRateFromString(s string) (Rate, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.Contains(s, "/") {
+		return 0, ErrInvalidRate
+	}
+	value, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, ErrInvalidRate
+	}
+	scaled := new(big.Int).Mul(value.Num(), rateScale)
+	rate, ok := divRound(scaled, value.Denom())
+	if !ok {
+		return 0, ErrInvalidRate
+	}
+	return Rate(rate), nil
+}
+
+// String formats the rate without trailing zeros, e.g. "1.0845" or "2".
+func (r Rate) String() string {
+	sign := ""
+	v := int64(r)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	whole, frac := v/int64(RateOne), v%int64(RateOne)
+	if frac == 0 {
+		return fmt.Sprintf("%s%d", sign, whole)
+	}
+	digits := strings.TrimRight(fmt.Sprintf("%0*d", rateDecimals, frac), "0")
+	return fmt.Sprintf("%s%d.%s", sign, whole, digits)
+}
+
+// Per returns the cross rate r/d, rounded half away from zero to eight
+// decimals. It fails for a zero divisor or a result too large to keep.
+func (r Rate) Per(d Rate) (Rate, error) {
+	if d == 0 {
+		return 0, ErrInvalidRate
+	}
+	scaled := new(big.Int).Mul(big.NewInt(int64(r)), rateScale)
+	rate, ok := divRound(scaled, big.NewInt(int64(d)))
+	if !ok {
+		return 0, ErrInvalidRate
+	}
+	return Rate(rate), nil
+}
+
+// divRound returns n/d rounded half away from zero, and whether the result
+// fits in an int64.
+func divRound(n, d *big.Int) (int64, bool) {
+	quo, rem := new(big.Int).QuoRem(n, d, new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2)).Cmp(new(big.Int).Abs(d)) >= 0 {
+		if (n.Sign() < 0) != (d.Sign() < 0) {
+			quo.Sub(quo, big.NewInt(1))
+		} else {
+			quo.Add(quo, big.NewInt(1))
+		}
+	}
+	if !quo.IsInt64() {
+		return 0, false
+	}
+	return quo.Int64(), true
+}
+
+// MarshalJSON encodes the rate as a JSON number.
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a numeric string.
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	v, err := NewRateFromString(strings.Trim(s, `"`))
+	if err != nil {
+		return err
+	}
+	*r = v
+	return nil
+}
+
+// Scan implements sql.Scanner for DECIMAL columns.
+func (r *Rate) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*r = 0
+		return nil
+	case []byte:
+		parsed, err := NewRateFromString(string(v))
+		if err != nil {
+			return err
+		}
+		*r = parsed
+		return nil
+	case string:
+		parsed, err := NewRateFromString(v)
+		if err != nil {
+			return err
+		}
+		*r = parsed
+		return nil
+	case int64:
+		*r = Rate(v) * RateOne
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into Rate", src)
+	}
+}
+
+// Value implements driver.Valuer, writing the rate as an exact decimal.
+func (r Rate) Value() (driver.Value, error) {
+	return r.String(), nil
+}
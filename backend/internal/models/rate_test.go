@@ -0,0 +1,54 @@
+package models
+
+import "testing"
+
+func TestNewRateFromString(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Rate
+	}{
+		{"1.0845", 108450000},
+		{"1", RateOne},
+		{"0.123456785", 12345679},
+		{"0.123456784999", 12345678},
+		{"7.4e-05", 7400},
+		{" 156.93 ", 15693000000},
+	}
+	for _, tt := range tests {
+		got, err := NewRateFromString(tt.in)
+		if err != nil {
+			t.Errorf("NewRateFromString(%q) returned %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NewRateFromString(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "abc", "1/3", "1.2.3"} {
+		if _, err := NewRateFromString(in); err != ErrInvalidRate {
+			t.Errorf("NewRateFromString(%q) error = %v, want %v", in, err, ErrInvalidRate)
+		}
+	}
+}
+
+func TestRateString(t *testing.T) {
+	for rate, want := range map[Rate]string{108450000: "1.0845", RateOne: "1", 7400: "0.000074", 12345678: "0.12345678"} {
+		if got := rate.String(); got != want {
+			t.Errorf("Rate(%d).String() = %q, want %q", int64(rate), got, want)
+		}
+	}
+}
+
+func TestRatePer(t *testing.T) {
+	euro := Rate(740000000) // 7.4 per euro
+	if got, err := RateOne.Per(euro); err != nil || got != 13513514 {
+		t.Errorf("1/7.4 = %s, %v, want 0.13513514", got, err)
+	}
+	if got, err := Rate(108450000).Per(euro); err != nil || got != 14655405 {
+		t.Errorf("1.0845/7.4 = %s, %v, want 0.14655405", got, err)
+	}
+	if _, err := RateOne.Per(0); err != ErrInvalidRate {
+		t.Errorf("Per(0) error = %v, want %v", err, ErrInvalidRate)
+	}
+}
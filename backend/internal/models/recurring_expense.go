@@ -0,0 +1,91 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type RecurrenceFrequency string
+
+const (
+	FrequencyWeekly  RecurrenceFrequency = "weekly"
+	FrequencyMonthly RecurrenceFrequency = "monthly"
+	FrequencyYearly  RecurrenceFrequency = "yearly"
+)
+
+// RecurringExpense is a template from which an expense is created on every
+// occurrence of its schedule, from StartDate until EndDate (inclusive).
+//
+// The schedule repeats every Interval weeks, months or years. Weekly
+// occurrences fall on the weekday of StartDate, yearly ones on its month and
+// day. Monthly occurrences fall on DayOfMonth, or the day of StartDate when
+// it is 0; in shorter months the last day of the month is used instead.
+type RecurringExpense struct {
+	ID             uuid.UUID            `json:"id"`
+	TeamID         uuid.UUID            `json:"team_id"`
+	CreatedBy      uuid.UUID            `json:"created_by"`
+	Template       ExpenseCreateRequest `json:"template"`
+	Frequency      RecurrenceFrequency  `json:"frequency"`
+	Interval       int                  `json:"interval"`
+	DayOfMonth     int                  `json:"day_of_month,omitempty"`
+	StartDate      Date                 `json:"start_date"`
+	EndDate        *Date                `json:"end_date,omitempty"`
+	NextOccurrence *Date                `json:"next_occurrence,omitempty"` // Nil once the schedule has ended
+	CreatedAt      time.Time            `json:"created_at"`
+	UpdatedAt      time.Time            `json:"updated_at"`
+}
+
+type RecurringExpenseRequest struct {
+	Template   ExpenseCreateRequest `json:"template"`
+	Frequency  RecurrenceFrequency  `json:"frequency"`
+	Interval   int                  `json:"interval,omitempty"` // Defaults to 1
+	DayOfMonth int                  `json:"day_of_month,omitempty"`
+	StartDate  *Date                `json:"start_date,omitempty"` // Defaults to today
+	EndDate    *Date                `json:"end_date,omitempty"`
+}
+
+// FirstOccurrence returns the first scheduled day on or after StartDate.
+func (r *RecurringExpense) FirstOccurrence() Date {
+	if r.Frequency != FrequencyMonthly || r.DayOfMonth == 0 {
+		return r.StartDate
+	}
+	first := monthDay(r.StartDate.Year(), r.StartDate.Month(), r.DayOfMonth)
+	if first.Before(r.StartDate.Time) {
+		first = monthDay(r.StartDate.Year(), r.StartDate.Month()+1, r.DayOfMonth)
+	}
+	return first
+}
+
+// OccurrenceAfter returns the scheduled day following the occurrence on d.
+// Days are always derived from the schedule's anchor day, so clamping to
+// the end of a short month does not move later occurrences.
+func (r *RecurringExpense) OccurrenceAfter(d Date) Date {
+	interval := r.Interval
+	if interval < 1 {
+		interval = 1
+	}
+	switch r.Frequency {
+	case FrequencyWeekly:
+		return NewDate(d.AddDate(0, 0, 7*interval))
+	case FrequencyYearly:
+		return monthDay(d.Year()+interval, r.StartDate.Month(), r.StartDate.Day())
+	default:
+		day := r.DayOfMonth
+		if day == 0 {
+			day = r.StartDate.Day()
+		}
+		return monthDay(d.Year(), d.Month()+time.Month(interval), day)
+	}
+}
+
+// monthDay returns the given day of the month, or the month's last day if it
+// has fewer days. Months past December roll over into the following years.
+func monthDay(year int, month time.Month, day int) Date {
+	firstOfMonth := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return Date{firstOfMonth.AddDate(0, 0, day-1)}
+}
@@ -6,11 +6,30 @@ import (
 	"github.com/google/uuid"
 )
 
+// BalanceMode is how a team's debts are turned into suggested transfers.
+type BalanceMode string
+
+const (
+	// BalanceModePairwise settles each pair of members separately, after
+	// netting out what they owe each other.
+	BalanceModePairwise BalanceMode = "pairwise"
+	// BalanceModeSimplified settles every member's net position with as few
+	// transfers as practical, so members may pay someone they never shared
+	// an expense with.
+	BalanceModeSimplified BalanceMode = "simplified"
+)
+
+func IsValidBalanceMode(mode BalanceMode) bool {
+	return mode == BalanceModePairwise || mode == BalanceModeSimplified
+}
+
 type Team struct {
-	ID        uuid.UUID `json:"id"`
-	Name      string    `json:"name"`
-	CreatedBy uuid.UUID `json:"created_by"`
-	CreatedAt time.Time `json:"created_at"`
+	ID           uuid.UUID   `json:"id"`
+	Name         string      `json:"name"`
+	BaseCurrency string      `json:"base_currency"`
+	BalanceMode  BalanceMode `json:"balance_mode"`
+	CreatedBy    uuid.UUID   `json:"created_by"`
+	CreatedAt    time.Time   `json:"created_at"`
 }
 
 type TeamMember struct {
@@ -21,15 +40,25 @@ type TeamMember struct {
 }
 
 type TeamCreateRequest struct {
-	Name string `json:"name"`
+	Name         string      `json:"name"`
+	BaseCurrency string      `json:"base_currency,omitempty"` // Defaults to DefaultCurrency
+	BalanceMode  BalanceMode `json:"balance_mode,omitempty"`  // Defaults to BalanceModePairwise
+}
+
+// TeamUpdateRequest changes the fields that are given and keeps the rest.
+type TeamUpdateRequest struct {
+	Name        *string      `json:"name,omitempty"`
+	BalanceMode *BalanceMode `json:"balance_mode,omitempty"`
 }
 
 type TeamResponse struct {
-	ID        uuid.UUID      `json:"id"`
-	Name      string         `json:"name"`
-	CreatedBy uuid.UUID      `json:"created_by"`
-	CreatedAt time.Time      `json:"created_at"`
-	Members   []MemberDetail `json:"members,omitempty"`
+	ID           uuid.UUID      `json:"id"`
+	Name         string         `json:"name"`
+	BaseCurrency string         `json:"base_currency"`
+	BalanceMode  BalanceMode    `json:"balance_mode"`
+	CreatedBy    uuid.UUID      `json:"created_by"`
+	CreatedAt    time.Time      `json:"created_at"`
+	Members      []MemberDetail `json:"members,omitempty"`
 }
 
 type MemberDetail struct {
@@ -47,9 +76,11 @@ type AddMemberRequest struct {
 
 func (t *Team) ToResponse() TeamResponse {
 	return TeamResponse{
-		ID:        t.ID,
-		Name:      t.Name,
-		CreatedBy: t.CreatedBy,
-		CreatedAt: t.CreatedAt,
+		ID:           t.ID,
+		Name:         t.Name,
+		BaseCurrency: t.BaseCurrency,
+		BalanceMode:  t.BalanceMode,
+		CreatedBy:    t.CreatedBy,
+		CreatedAt:    t.CreatedAt,
 	}
 }
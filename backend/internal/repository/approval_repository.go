@@ -8,6 +8,7 @@ import (
 	"github.com/expensesplit/backend/internal/database"
 	"github.com/expensesplit/backend/internal/models"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 var (
@@ -36,6 +37,11 @@ func (r *ApprovalRepository) Create(approval *models.Approval) error {
 }
 
 func (r *ApprovalRepository) GetByID(id uuid.UUID) (*models.Approval, error) {
+	return r.GetByIDTx(r.db, id)
+}
+
+// GetByIDTx reads the approval using q.
+func (r *ApprovalRepository) GetByIDTx(q database.Querier, id uuid.UUID) (*models.Approval, error) {
 	approval := &models.Approval{}
 	query := `
 		SELECT id, expense_id, approved_by, status, comment, created_at, approved_at
@@ -43,7 +49,7 @@ func (r *ApprovalRepository) GetByID(id uuid.UUID) (*models.Approval, error) {
 	`
 	var approvedBy sql.NullString
 	var approvedAt sql.NullTime
-	err := r.db.QueryRow(query, id).Scan(
+	err := q.QueryRow(query, id).Scan(
 		&approval.ID, &approval.ExpenseID, &approvedBy, &approval.Status,
 		&approval.Comment, &approval.CreatedAt, &approvedAt,
 	)
@@ -91,12 +97,50 @@ func (r *ApprovalRepository) GetByExpenseID(expenseID uuid.UUID) (*models.Approv
 	return approval, nil
 }
 
+// GetByExpenseIDs loads the approvals of several expenses in one query,
+// keyed by expense ID.
+func (r *ApprovalRepository) GetByExpenseIDs(expenseIDs []uuid.UUID) (map[uuid.UUID]*models.Approval, error) {
+	approvals := make(map[uuid.UUID]*models.Approval, len(expenseIDs))
+	if len(expenseIDs) == 0 {
+		return approvals, nil
+	}
+	query := `
+		SELECT id, expense_id, approved_by, status, comment, created_at, approved_at
+		FROM approvals WHERE expense_id = ANY($1::uuid[])
+	`
+	rows, err := r.db.Query(query, pq.Array(uuidStrings(expenseIDs)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		approval := &models.Approval{}
+		var approvedBy sql.NullString
+		var approvedAt sql.NullTime
+		err := rows.Scan(&approval.ID, &approval.ExpenseID, &approvedBy, &approval.Status,
+			&approval.Comment, &approval.CreatedAt, &approvedAt)
+		if err != nil {
+			return nil, err
+		}
+		if approvedBy.Valid {
+			uid, _ := uuid.Parse(approvedBy.String)
+			approval.ApprovedBy = uid
+		}
+		if approvedAt.Valid {
+			approval.ApprovedAt = &approvedAt.Time
+		}
+		approvals[approval.ExpenseID] = approval
+	}
+	return approvals, nil
+}
+
 func (r *ApprovalRepository) GetPendingByTeamID(teamID uuid.UUID) ([]models.Approval, error) {
 	query := `
 		SELECT a.id, a.expense_id, a.approved_by, a.status, a.comment, a.created_at, a.approved_at
 		FROM approvals a
 		INNER JOIN expenses e ON a.expense_id = e.id
-		WHERE e.team_id = $1 AND a.status = 'pending'
+		WHERE e.team_id = $1 AND e.deleted_at IS NULL AND a.status = 'pending'
 		ORDER BY a.created_at DESC
 	`
 	rows, err := r.db.Query(query, teamID)
@@ -129,17 +173,48 @@ func (r *ApprovalRepository) GetPendingByTeamID(teamID uuid.UUID) ([]models.Appr
 	return approvals, nil
 }
 
-func (r *ApprovalRepository) GetAllByTeamID(teamID uuid.UUID) ([]models.Approval, error) {
+// approvalKeys orders approvals newest first.
+var approvalKeys = keyset{
+	name:    "approvals",
+	columns: []string{"a.created_at", "a.id"},
+	types:   []string{"timestamp", "uuid"},
+}
+
+// GetAllByTeamID lists a page of the approvals of the team's expenses,
+// newest first, with the total number of approvals and the cursor of the
+// next page.
+func (r *ApprovalRepository) GetAllByTeamID(teamID uuid.UUID, page Page) ([]models.Approval, int64, string, error) {
+	var total int64
+	err := r.db.QueryRow(`
+		SELECT COUNT(*) FROM approvals a
+		INNER JOIN expenses e ON a.expense_id = e.id
+		WHERE e.team_id = $1 AND e.deleted_at IS NULL
+	`, teamID).Scan(&total)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	where := "e.team_id = $1 AND e.deleted_at IS NULL"
+	args := []interface{}{teamID}
+	if page.Cursor != "" {
+		var after string
+		if after, args, err = approvalKeys.after(page.Cursor, false, args); err != nil {
+			return nil, 0, "", err
+		}
+		where += " AND " + after
+	}
+	window, args := page.window(args)
+
 	query := `
 		SELECT a.id, a.expense_id, a.approved_by, a.status, a.comment, a.created_at, a.approved_at
 		FROM approvals a
 		INNER JOIN expenses e ON a.expense_id = e.id
-		WHERE e.team_id = $1
-		ORDER BY a.created_at DESC
-	`
-	rows, err := r.db.Query(query, teamID)
+		WHERE ` + where + `
+		ORDER BY ` + approvalKeys.orderBy(false) + `
+		` + window
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return nil, 0, "", err
 	}
 	defer rows.Close()
 
@@ -153,7 +228,7 @@ func (r *ApprovalRepository) GetAllByTeamID(teamID uuid.UUID) ([]models.Approval
 			&approval.Comment, &approval.CreatedAt, &approvedAt,
 		)
 		if err != nil {
-			return nil, err
+			return nil, 0, "", err
 		}
 		if approvedBy.Valid {
 			uid, _ := uuid.Parse(approvedBy.String)
@@ -164,16 +239,28 @@ func (r *ApprovalRepository) GetAllByTeamID(teamID uuid.UUID) ([]models.Approval
 		}
 		approvals = append(approvals, approval)
 	}
-	return approvals, nil
+
+	var next string
+	if len(approvals) > page.Limit {
+		approvals = approvals[:page.Limit]
+		last := approvals[page.Limit-1]
+		next = approvalKeys.cursor(cursorTime(last.CreatedAt), last.ID.String())
+	}
+	return approvals, total, next, nil
 }
 
 func (r *ApprovalRepository) UpdateStatus(id uuid.UUID, status models.ApprovalStatus, approvedBy uuid.UUID, comment string) error {
+	return r.UpdateStatusTx(r.db, id, status, approvedBy, comment)
+}
+
+// UpdateStatusTx records the approver's decision using q.
+func (r *ApprovalRepository) UpdateStatusTx(q database.Querier, id uuid.UUID, status models.ApprovalStatus, approvedBy uuid.UUID, comment string) error {
 	now := time.Now()
 	query := `
 		UPDATE approvals SET status = $1, approved_by = $2, comment = $3, approved_at = $4
 		WHERE id = $5
 	`
-	result, err := r.db.Exec(query, status, approvedBy, comment, now, id)
+	result, err := q.Exec(query, status, approvedBy, comment, now, id)
 	if err != nil {
 		return err
 	}
@@ -186,3 +273,14 @@ func (r *ApprovalRepository) UpdateStatus(id uuid.UUID, status models.ApprovalSt
 	}
 	return nil
 }
+
+// ResetToPendingTx puts the approval of an expense back to pending, e.g.
+// after the expense's amounts changed.
+func (r *ApprovalRepository) ResetToPendingTx(q database.Querier, expenseID uuid.UUID) error {
+	query := `
+		UPDATE approvals SET status = $1, approved_by = NULL, approved_at = NULL
+		WHERE expense_id = $2
+	`
+	_, err := q.Exec(query, models.ApprovalStatusPending, expenseID)
+	return err
+}
@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/expensesplit/backend/internal/database"
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// auditKeys orders audit events newest first.
+var auditKeys = keyset{
+	name:    "audit",
+	columns: []string{"created_at", "id"},
+	types:   []string{"timestamp", "uuid"},
+}
+
+// AuditFilter narrows down a team's audit log. Zero values match everything.
+type AuditFilter struct {
+	ActorID    *uuid.UUID
+	EntityType models.AuditEntity
+	EntityID   *uuid.UUID
+	Action     models.AuditAction
+	From       time.Time // At or after
+	To         time.Time // Before
+}
+
+// where returns the WHERE clause for the filter. The team ID is always $1;
+// filter values are appended to args.
+func (f AuditFilter) where(args []interface{}) (string, []interface{}) {
+	clause := "team_id = $1"
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		clause += " AND " + fmt.Sprintf(condition, len(args))
+	}
+
+	if f.ActorID != nil {
+		add("actor_id = $%d", *f.ActorID)
+	}
+	if f.EntityType != "" {
+		add("entity_type = $%d", f.EntityType)
+	}
+	if f.EntityID != nil {
+		add("entity_id = $%d", *f.EntityID)
+	}
+	if f.Action != "" {
+		add("action = $%d", f.Action)
+	}
+	if !f.From.IsZero() {
+		add("created_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		add("created_at < $%d", f.To)
+	}
+	return clause, args
+}
+
+// AuditRepository only ever appends events; they are never changed.
+type AuditRepository struct {
+	db *database.DB
+}
+
+func NewAuditRepository(db *database.DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+// CreateTx appends the event using q, which should be the transaction that
+// makes the change being recorded.
+func (r *AuditRepository) CreateTx(q database.Querier, event *models.AuditEvent) error {
+	event.ID = uuid.New()
+	event.CreatedAt = time.Now()
+
+	query := `
+		INSERT INTO audit_events (id, team_id, actor_id, action, entity_type, entity_id, before, after,
+			request_id, ip_address, user_agent, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`
+	_, err := q.Exec(query, event.ID, event.TeamID, event.ActorID, event.Action, event.EntityType,
+		event.EntityID, nullableJSON(event.Before), nullableJSON(event.After), event.RequestID,
+		event.IPAddress, event.UserAgent, event.CreatedAt)
+	return err
+}
+
+// GetByTeamID lists a page of the team's audit events matching filter,
+// newest first, with the number of matching events and the cursor of the
+// next page.
+func (r *AuditRepository) GetByTeamID(teamID uuid.UUID, filter AuditFilter, page Page) ([]models.AuditEvent, int64, string, error) {
+	where, args := filter.where([]interface{}{teamID})
+
+	var total int64
+	err := r.db.QueryRow("SELECT COUNT(*) FROM audit_events WHERE "+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	if page.Cursor != "" {
+		var after string
+		if after, args, err = auditKeys.after(page.Cursor, false, args); err != nil {
+			return nil, 0, "", err
+		}
+		where += " AND " + after
+	}
+	window, args := page.window(args)
+
+	query := `
+		SELECT id, team_id, actor_id, action, entity_type, entity_id, before, after,
+			COALESCE(request_id, ''), COALESCE(ip_address, ''), COALESCE(user_agent, ''), created_at
+		FROM audit_events WHERE ` + where + `
+		ORDER BY ` + auditKeys.orderBy(false) + `
+		` + window
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	defer rows.Close()
+
+	var events []models.AuditEvent
+	for rows.Next() {
+		event := models.AuditEvent{}
+		var before, after []byte
+		err := rows.Scan(&event.ID, &event.TeamID, &event.ActorID, &event.Action, &event.EntityType,
+			&event.EntityID, &before, &after, &event.RequestID, &event.IPAddress, &event.UserAgent,
+			&event.CreatedAt)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		event.Before = before
+		event.After = after
+		events = append(events, event)
+	}
+
+	var next string
+	if len(events) > page.Limit {
+		events = events[:page.Limit]
+		last := events[page.Limit-1]
+		next = auditKeys.cursor(cursorTime(last.CreatedAt), last.ID.String())
+	}
+	return events, total, next, nil
+}
+
+// nullableJSON stores empty JSON documents as NULL.
+// GetLastActions returns the last of the given actions taken on each entity
+// of the type in the team at or before asOf, keyed by entity ID. Entities
+// without any of the actions by then are left out.
+func (r *AuditRepository) GetLastActions(teamID uuid.UUID, entityType models.AuditEntity, actions []models.AuditAction, asOf time.Time) (map[uuid.UUID]models.AuditAction, error) {
+	names := make([]string, len(actions))
+	for i, action := range actions {
+		names[i] = string(action)
+	}
+	query := `
+		SELECT DISTINCT ON (entity_id) entity_id, action
+		FROM audit_events
+		WHERE team_id = $1 AND entity_type = $2 AND action = ANY($3) AND created_at <= $4
+		ORDER BY entity_id, created_at DESC, id DESC
+	`
+	rows, err := r.db.Query(query, teamID, entityType, pq.Array(names), asOf)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	last := make(map[uuid.UUID]models.AuditAction)
+	for rows.Next() {
+		var entityID uuid.UUID
+		var action models.AuditAction
+		if err := rows.Scan(&entityID, &action); err != nil {
+			return nil, err
+		}
+		last[entityID] = action
+	}
+	return last, rows.Err()
+}
+
+func nullableJSON(data []byte) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	return string(data)
+}
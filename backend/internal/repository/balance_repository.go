@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/expensesplit/backend/internal/database"
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// BalanceRepository stores what each member of a team owes each other
+// member. Balances are kept up to date by the transactions that change
+// expenses and settlements, so they never need to be recomputed on reads.
+type BalanceRepository struct {
+	db *database.DB
+}
+
+func NewBalanceRepository(db *database.DB) *BalanceRepository {
+	return &BalanceRepository{db: db}
+}
+
+// LockForWriteTx holds a shared lock on the team's balances until the
+// transaction using q ends. Transactions that change balances take it
+// before AddTx, so they can run side by side but not while the balances
+// are rebuilt.
+func (r *BalanceRepository) LockForWriteTx(q database.Querier, teamID uuid.UUID) error {
+	_, err := q.Exec(`SELECT pg_advisory_xact_lock_shared(hashtext('balances:' || $1::text))`, teamID)
+	return err
+}
+
+// LockForRebuildTx holds an exclusive lock on the team's balances until the
+// transaction using q ends. It waits for the transactions holding
+// LockForWriteTx to end, so everything they changed can be read, and keeps
+// new ones from changing balances until the rebuild is written.
+func (r *BalanceRepository) LockForRebuildTx(q database.Querier, teamID uuid.UUID) error {
+	_, err := q.Exec(`SELECT pg_advisory_xact_lock(hashtext('balances:' || $1::text))`, teamID)
+	return err
+}
+
+// AddTx adds amount to what fromUser owes toUser using q, which should be
+// the transaction making the change behind it and hold LockForWriteTx. A
+// negative amount reduces the debt.
+func (r *BalanceRepository) AddTx(q database.Querier, teamID, fromUser, toUser uuid.UUID, amount models.Money) error {
+	query := `
+		INSERT INTO balances (id, team_id, from_user, to_user, amount, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (team_id, from_user, to_user)
+		DO UPDATE SET amount = balances.amount + EXCLUDED.amount, updated_at = EXCLUDED.updated_at
+	`
+	_, err := q.Exec(query, uuid.New(), teamID, fromUser, toUser, amount, time.Now())
+	return err
+}
+
+func (r *BalanceRepository) GetByTeamID(teamID uuid.UUID) ([]models.Balance, error) {
+	return r.GetByTeamIDTx(r.db, teamID)
+}
+
+// GetByTeamIDTx loads the team's stored balances using q.
+func (r *BalanceRepository) GetByTeamIDTx(q database.Querier, teamID uuid.UUID) ([]models.Balance, error) {
+	query := `
+		SELECT id, team_id, from_user, to_user, amount, updated_at
+		FROM balances WHERE team_id = $1
+	`
+	rows, err := q.Query(query, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var balances []models.Balance
+	for rows.Next() {
+		balance := models.Balance{}
+		err := rows.Scan(&balance.ID, &balance.TeamID, &balance.FromUser, &balance.ToUser,
+			&balance.Amount, &balance.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		balances = append(balances, balance)
+	}
+	return balances, nil
+}
+
+// GetByTeamIDs loads the balances of several teams at once, keyed by team.
+func (r *BalanceRepository) GetByTeamIDs(teamIDs []uuid.UUID) (map[uuid.UUID][]models.Balance, error) {
+	balances := make(map[uuid.UUID][]models.Balance, len(teamIDs))
+	if len(teamIDs) == 0 {
+		return balances, nil
+	}
+	query := `
+		SELECT id, team_id, from_user, to_user, amount, updated_at
+		FROM balances WHERE team_id = ANY($1::uuid[])
+	`
+	rows, err := r.db.Query(query, pq.Array(uuidStrings(teamIDs)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		balance := models.Balance{}
+		err := rows.Scan(&balance.ID, &balance.TeamID, &balance.FromUser, &balance.ToUser,
+			&balance.Amount, &balance.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		balances[balance.TeamID] = append(balances[balance.TeamID], balance)
+	}
+	return balances, nil
+}
+
+// ReplaceTx makes balances the complete set of the team's balances using q,
+// which should hold LockForRebuildTx, and records when they were built.
+func (r *BalanceRepository) ReplaceTx(q database.Querier, teamID uuid.UUID, balances []models.Balance) error {
+	if _, err := q.Exec(`DELETE FROM balances WHERE team_id = $1`, teamID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	query := `
+		INSERT INTO balances (id, team_id, from_user, to_user, amount, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	for i := range balances {
+		balances[i].ID = uuid.New()
+		balances[i].TeamID = teamID
+		balances[i].UpdatedAt = now
+		_, err := q.Exec(query, balances[i].ID, teamID, balances[i].FromUser, balances[i].ToUser,
+			balances[i].Amount, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := q.Exec(`UPDATE teams SET balances_built_at = $1 WHERE id = $2`, now, teamID)
+	return err
+}
+
+// HaveHistory reports whether two users share an expense in the team, one
+// paying and the other owing a share of it, or have recorded a settlement
+// between them. It holds even after either has left the team.
+func (r *BalanceRepository) HaveHistory(teamID, userID, otherID uuid.UUID) (bool, error) {
+	var shared bool
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM expenses e
+			JOIN expense_payers p ON p.expense_id = e.id
+			JOIN expense_splits s ON s.expense_id = e.id
+			WHERE e.team_id = $1 AND e.deleted_at IS NULL
+				AND ((p.user_id = $2 AND s.user_id = $3) OR (p.user_id = $3 AND s.user_id = $2))
+		) OR EXISTS (
+			SELECT 1 FROM settlements
+			WHERE team_id = $1
+				AND ((from_user = $2 AND to_user = $3) OR (from_user = $3 AND to_user = $2))
+		)
+	`
+	err := r.db.QueryRow(query, teamID, userID, otherID).Scan(&shared)
+	return shared, err
+}
+
+// GetUnbuiltTeamIDs lists the teams whose balances have never been built,
+// i.e. teams that existed before balances were stored.
+func (r *BalanceRepository) GetUnbuiltTeamIDs() ([]uuid.UUID, error) {
+	rows, err := r.db.Query(`SELECT id FROM teams WHERE balances_built_at IS NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (r *BalanceRepository) GetAllTeamIDs() ([]uuid.UUID, error) {
+	rows, err := r.db.Query(`SELECT id FROM teams ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/expensesplit/backend/internal/database"
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+var ErrSnapshotNotFound = errors.New("balance snapshot not found")
+
+// BalanceSnapshotRepository stores balance snapshots. There is deliberately
+// no way to change or delete a snapshot once it is taken.
+type BalanceSnapshotRepository struct {
+	db *database.DB
+}
+
+func NewBalanceSnapshotRepository(db *database.DB) *BalanceSnapshotRepository {
+	return &BalanceSnapshotRepository{db: db}
+}
+
+// CreateTx inserts the snapshot and its balances using q.
+func (r *BalanceSnapshotRepository) CreateTx(q database.Querier, snapshot *models.BalanceSnapshot) error {
+	snapshot.ID = uuid.New()
+	snapshot.CreatedAt = time.Now()
+
+	query := `
+		INSERT INTO balance_snapshots (id, team_id, label, as_of, currency, balance_mode, closed_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := q.Exec(query, snapshot.ID, snapshot.TeamID, snapshot.Label, snapshot.AsOf, snapshot.Currency,
+		snapshot.BalanceMode, snapshot.ClosedBy, snapshot.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	for i := range snapshot.Balances {
+		balance := &snapshot.Balances[i]
+		balance.TeamID = snapshot.TeamID
+		balance.UpdatedAt = snapshot.AsOf
+		_, err := q.Exec(`
+			INSERT INTO balance_snapshot_entries (snapshot_id, from_user, to_user, amount)
+			VALUES ($1, $2, $3, $4)
+		`, snapshot.ID, balance.FromUser, balance.ToUser, balance.Amount)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetByID gets a snapshot with its balances.
+func (r *BalanceSnapshotRepository) GetByID(id uuid.UUID) (*models.BalanceSnapshot, error) {
+	query := `
+		SELECT id, team_id, COALESCE(label, ''), as_of, currency, balance_mode, closed_by, created_at
+		FROM balance_snapshots WHERE id = $1
+	`
+	snapshot, err := scanSnapshot(r.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrSnapshotNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(`
+		SELECT from_user, to_user, amount FROM balance_snapshot_entries WHERE snapshot_id = $1
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		balance := models.Balance{TeamID: snapshot.TeamID, UpdatedAt: snapshot.AsOf}
+		if err := rows.Scan(&balance.FromUser, &balance.ToUser, &balance.Amount); err != nil {
+			return nil, err
+		}
+		snapshot.Balances = append(snapshot.Balances, balance)
+	}
+	return snapshot, nil
+}
+
+// GetByTeamID lists the team's snapshots, latest period first, without
+// their balances.
+func (r *BalanceSnapshotRepository) GetByTeamID(teamID uuid.UUID) ([]models.BalanceSnapshot, error) {
+	query := `
+		SELECT id, team_id, COALESCE(label, ''), as_of, currency, balance_mode, closed_by, created_at
+		FROM balance_snapshots WHERE team_id = $1
+		ORDER BY as_of DESC, created_at DESC
+	`
+	rows, err := r.db.Query(query, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []models.BalanceSnapshot
+	for rows.Next() {
+		snapshot, err := scanSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, *snapshot)
+	}
+	return snapshots, nil
+}
+
+func scanSnapshot(row rowScanner) (*models.BalanceSnapshot, error) {
+	snapshot := &models.BalanceSnapshot{}
+	err := row.Scan(&snapshot.ID, &snapshot.TeamID, &snapshot.Label, &snapshot.AsOf, &snapshot.Currency,
+		&snapshot.BalanceMode, &snapshot.ClosedBy, &snapshot.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/expensesplit/backend/internal/database"
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrBudgetNotFound = errors.New("budget not found")
+)
+
+const budgetColumns = `id, team_id, category_id, user_id, amount, period, start_date, end_date, warn_percent,
+	created_by, created_at, updated_at`
+
+func scanBudget(row rowScanner) (*models.Budget, error) {
+	budget := &models.Budget{}
+	var categoryID, userID uuid.NullUUID
+	var endDate models.Date
+	err := row.Scan(&budget.ID, &budget.TeamID, &categoryID, &userID, &budget.Amount, &budget.Period,
+		&budget.StartDate, &endDate, &budget.WarnPercent, &budget.CreatedBy, &budget.CreatedAt, &budget.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if categoryID.Valid {
+		budget.CategoryID = &categoryID.UUID
+	}
+	if userID.Valid {
+		budget.UserID = &userID.UUID
+	}
+	if !endDate.IsZero() {
+		budget.EndDate = &endDate
+	}
+	return budget, nil
+}
+
+type BudgetRepository struct {
+	db *database.DB
+}
+
+func NewBudgetRepository(db *database.DB) *BudgetRepository {
+	return &BudgetRepository{db: db}
+}
+
+func (r *BudgetRepository) Create(budget *models.Budget) error {
+	budget.ID = uuid.New()
+	budget.CreatedAt = time.Now()
+	budget.UpdatedAt = time.Now()
+
+	query := `
+		INSERT INTO budgets (id, team_id, category_id, user_id, amount, period, start_date, end_date, warn_percent,
+			created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`
+	_, err := r.db.Exec(query, budget.ID, budget.TeamID, budget.CategoryID, budget.UserID, budget.Amount,
+		budget.Period, budget.StartDate, optionalDate(budget.EndDate), budget.WarnPercent, budget.CreatedBy,
+		budget.CreatedAt, budget.UpdatedAt)
+	return err
+}
+
+func (r *BudgetRepository) GetByID(id uuid.UUID) (*models.Budget, error) {
+	query := `SELECT ` + budgetColumns + ` FROM budgets WHERE id = $1`
+	budget, err := scanBudget(r.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrBudgetNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return budget, nil
+}
+
+func (r *BudgetRepository) GetByTeamID(teamID uuid.UUID) ([]*models.Budget, error) {
+	query := `SELECT ` + budgetColumns + ` FROM budgets WHERE team_id = $1 ORDER BY created_at`
+	rows, err := r.db.Query(query, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var budgets []*models.Budget
+	for rows.Next() {
+		budget, err := scanBudget(rows)
+		if err != nil {
+			return nil, err
+		}
+		budgets = append(budgets, budget)
+	}
+	return budgets, nil
+}
+
+func (r *BudgetRepository) Update(budget *models.Budget) error {
+	budget.UpdatedAt = time.Now()
+	query := `
+		UPDATE budgets SET category_id = $1, user_id = $2, amount = $3, period = $4, start_date = $5,
+			end_date = $6, warn_percent = $7, updated_at = $8
+		WHERE id = $9
+	`
+	result, err := r.db.Exec(query, budget.CategoryID, budget.UserID, budget.Amount, budget.Period,
+		budget.StartDate, optionalDate(budget.EndDate), budget.WarnPercent, budget.UpdatedAt, budget.ID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrBudgetNotFound
+	}
+	return nil
+}
+
+func (r *BudgetRepository) Delete(id uuid.UUID) error {
+	result, err := r.db.Exec(`DELETE FROM budgets WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrBudgetNotFound
+	}
+	return nil
+}
+
+// GetSpent sums the team's spending incurred between from and to
+// (inclusive). With categories, only expenses in one of those categories
+// count. With a user, only that user's share of each expense counts.
+func (r *BudgetRepository) GetSpent(teamID uuid.UUID, categories []string, userID *uuid.UUID, from, to models.Date) (models.Money, error) {
+	var spent models.Money
+	var categoryFilter interface{}
+	if categories != nil {
+		categoryFilter = pq.Array(categories)
+	}
+
+	var err error
+	if userID == nil {
+		query := `
+			SELECT COALESCE(SUM(amount), 0) FROM expenses
+			WHERE team_id = $1 AND incurred_on BETWEEN $2 AND $3 AND deleted_at IS NULL
+			AND ($4::text[] IS NULL OR lower(category) = ANY($4))
+		`
+		err = r.db.QueryRow(query, teamID, from, to, categoryFilter).Scan(&spent)
+	} else {
+		query := `
+			SELECT COALESCE(SUM(es.amount), 0) FROM expense_splits es
+			INNER JOIN expenses e ON es.expense_id = e.id
+			WHERE e.team_id = $1 AND e.incurred_on BETWEEN $2 AND $3 AND e.deleted_at IS NULL
+			AND ($4::text[] IS NULL OR lower(e.category) = ANY($4))
+			AND es.user_id = $5
+		`
+		err = r.db.QueryRow(query, teamID, from, to, categoryFilter, *userID).Scan(&spent)
+	}
+	return spent, err
+}
+
+// RecordEvent stores a threshold crossing. Each budget records every level
+// at most once per period; it returns false if the crossing was already
+// recorded.
+func (r *BudgetRepository) RecordEvent(event *models.BudgetEvent) (bool, error) {
+	event.ID = uuid.New()
+	event.CreatedAt = time.Now()
+
+	query := `
+		INSERT INTO budget_events (id, budget_id, team_id, expense_id, level, period_start, spent, amount, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (budget_id, period_start, level) DO NOTHING
+	`
+	result, err := r.db.Exec(query, event.ID, event.BudgetID, event.TeamID, event.ExpenseID, event.Level,
+		event.PeriodStart, event.Spent, event.Amount, event.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// GetEvents lists the team's most recent budget events.
+func (r *BudgetRepository) GetEvents(teamID uuid.UUID, limit int) ([]models.BudgetEvent, error) {
+	query := `
+		SELECT id, budget_id, team_id, expense_id, level, period_start, spent, amount, notified_at, created_at
+		FROM budget_events WHERE team_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`
+	rows, err := r.db.Query(query, teamID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.BudgetEvent
+	for rows.Next() {
+		event := models.BudgetEvent{}
+		var expenseID uuid.NullUUID
+		var notifiedAt sql.NullTime
+		err := rows.Scan(&event.ID, &event.BudgetID, &event.TeamID, &expenseID, &event.Level,
+			&event.PeriodStart, &event.Spent, &event.Amount, &notifiedAt, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if expenseID.Valid {
+			event.ExpenseID = &expenseID.UUID
+		}
+		if notifiedAt.Valid {
+			event.NotifiedAt = &notifiedAt.Time
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/expensesplit/backend/internal/database"
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrCategoryNotFound = errors.New("category not found")
+	ErrCategoryExists   = errors.New("a category with this name already exists")
+)
+
+const categoryColumns = `id, team_id, name, parent_id, archived, created_at, updated_at`
+
+func scanCategory(row rowScanner) (*models.Category, error) {
+	category := &models.Category{}
+	var parentID uuid.NullUUID
+	err := row.Scan(&category.ID, &category.TeamID, &category.Name, &parentID, &category.Archived,
+		&category.CreatedAt, &category.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if parentID.Valid {
+		category.ParentID = &parentID.UUID
+	}
+	return category, nil
+}
+
+// categoryError maps a violation of the unique team/name index.
+func categoryError(err error) error {
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		return ErrCategoryExists
+	}
+	return err
+}
+
+// insertCategories adds top-level categories with the given names to a team.
+func insertCategories(q database.Querier, teamID uuid.UUID, names []string) error {
+	query := `
+		INSERT INTO categories (id, team_id, name, archived, created_at, updated_at)
+		VALUES ($1, $2, $3, false, $4, $4)
+	`
+	now := time.Now()
+	for _, name := range names {
+		if _, err := q.Exec(query, uuid.New(), teamID, name, now); err != nil {
+			return categoryError(err)
+		}
+	}
+	return nil
+}
+
+type CategoryRepository struct {
+	db *database.DB
+}
+
+func NewCategoryRepository(db *database.DB) *CategoryRepository {
+	return &CategoryRepository{db: db}
+}
+
+func (r *CategoryRepository) Create(category *models.Category) error {
+	category.ID = uuid.New()
+	category.CreatedAt = time.Now()
+	category.UpdatedAt = time.Now()
+
+	query := `
+		INSERT INTO categories (id, team_id, name, parent_id, archived, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := r.db.Exec(query, category.ID, category.TeamID, category.Name, category.ParentID,
+		category.Archived, category.CreatedAt, category.UpdatedAt)
+	return categoryError(err)
+}
+
+func (r *CategoryRepository) GetByID(id uuid.UUID) (*models.Category, error) {
+	query := `SELECT ` + categoryColumns + ` FROM categories WHERE id = $1`
+	category, err := scanCategory(r.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrCategoryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+// GetByName looks up a team's category by name, ignoring case.
+func (r *CategoryRepository) GetByName(teamID uuid.UUID, name string) (*models.Category, error) {
+	query := `SELECT ` + categoryColumns + ` FROM categories WHERE team_id = $1 AND lower(name) = lower($2)`
+	category, err := scanCategory(r.db.QueryRow(query, teamID, name))
+	if err == sql.ErrNoRows {
+		return nil, ErrCategoryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+func (r *CategoryRepository) GetByTeamID(teamID uuid.UUID, includeArchived bool) ([]*models.Category, error) {
+	query := `
+		SELECT ` + categoryColumns + `
+		FROM categories WHERE team_id = $1 AND (archived = false OR $2)
+		ORDER BY name
+	`
+	rows, err := r.db.Query(query, teamID, includeArchived)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []*models.Category
+	for rows.Next() {
+		category, err := scanCategory(rows)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+	return categories, nil
+}
+
+// UpdateTx saves the category using q. If its name changed from oldName,
+// the team's recurring expense templates are renamed too; renaming the
+// expenses themselves is recorded in their history by the caller.
+func (r *CategoryRepository) UpdateTx(q database.Querier, category *models.Category, oldName string) error {
+	category.UpdatedAt = time.Now()
+	query := `
+		UPDATE categories SET name = $1, parent_id = $2, archived = $3, updated_at = $4
+		WHERE id = $5
+	`
+	result, err := q.Exec(query, category.Name, category.ParentID, category.Archived,
+		category.UpdatedAt, category.ID)
+	if err != nil {
+		return categoryError(err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrCategoryNotFound
+	}
+
+	if category.Name == oldName {
+		return nil
+	}
+	_, err = q.Exec(`
+		UPDATE recurring_expenses SET template = jsonb_set(template, '{category}', to_jsonb($1::text))
+		WHERE team_id = $2 AND lower(template->>'category') = lower($3)
+	`, category.Name, category.TeamID, oldName)
+	return err
+}
+
+// IsInUse reports whether any expense, recurring expense, budget or
+// subcategory still refers to the category.
+func (r *CategoryRepository) IsInUse(category *models.Category) (bool, error) {
+	var inUse bool
+	query := `
+		SELECT EXISTS (SELECT 1 FROM expenses WHERE team_id = $1 AND lower(category) = lower($2))
+			OR EXISTS (SELECT 1 FROM recurring_expenses WHERE team_id = $1 AND lower(template->>'category') = lower($2))
+			OR EXISTS (SELECT 1 FROM budgets WHERE category_id = $3)
+			OR EXISTS (SELECT 1 FROM categories WHERE parent_id = $3)
+	`
+	err := r.db.QueryRow(query, category.TeamID, category.Name, category.ID).Scan(&inUse)
+	return inUse, err
+}
+
+func (r *CategoryRepository) Delete(id uuid.UUID) error {
+	result, err := r.db.Exec(`DELETE FROM categories WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrCategoryNotFound
+	}
+	return nil
+}
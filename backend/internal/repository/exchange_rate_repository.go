@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/expensesplit/backend/internal/database"
+	"github.com/expensesplit/backend/internal/models"
+)
+
+var (
+	ErrRateNotFound = errors.New("exchange rate not found")
+)
+
+type ExchangeRateRepository struct {
+	db *database.DB
+}
+
+func NewExchangeRateRepository(db *database.DB) *ExchangeRateRepository {
+	return &ExchangeRateRepository{db: db}
+}
+
+// Upsert stores the given rates, replacing any existing rate for the same
+// currency pair and date. It returns the number of rows written.
+func (r *ExchangeRateRepository) Upsert(rates []models.ExchangeRate) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO exchange_rates (base_currency, quote_currency, effective_date, rate, source, imported_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (base_currency, quote_currency, effective_date)
+		DO UPDATE SET rate = EXCLUDED.rate, source = EXCLUDED.source, imported_at = EXCLUDED.imported_at
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	now := time.Now()
+	for _, rate := range rates {
+		_, err := stmt.Exec(rate.BaseCurrency, rate.QuoteCurrency, rate.EffectiveDate, rate.Rate, rate.Source, now)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(rates), nil
+}
+
+// GetEffective returns the rate for the pair on the given date, falling back
+// to the nearest earlier date when no rate was published that day.
+func (r *ExchangeRateRepository) GetEffective(base, quote string, date time.Time) (*models.ExchangeRate, error) {
+	rate := &models.ExchangeRate{}
+	query := `
+		SELECT base_currency, quote_currency, effective_date, rate, source
+		FROM exchange_rates
+		WHERE base_currency = $1 AND quote_currency = $2 AND effective_date <= $3
+		ORDER BY effective_date DESC
+		LIMIT 1
+	`
+	err := r.db.QueryRow(query, base, quote, date).Scan(
+		&rate.BaseCurrency, &rate.QuoteCurrency, &rate.EffectiveDate, &rate.Rate, &rate.Source,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrRateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rate, nil
+}
+
+// GetEffectiveForBase returns, for every quote currency of base, the rate
+// effective on the given date (or the nearest earlier one).
+func (r *ExchangeRateRepository) GetEffectiveForBase(base string, date time.Time) ([]models.ExchangeRate, error) {
+	query := `
+		SELECT DISTINCT ON (quote_currency) base_currency, quote_currency, effective_date, rate, source
+		FROM exchange_rates
+		WHERE base_currency = $1 AND effective_date <= $2
+		ORDER BY quote_currency, effective_date DESC
+	`
+	rows, err := r.db.Query(query, base, date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rates []models.ExchangeRate
+	for rows.Next() {
+		rate := models.ExchangeRate{}
+		err := rows.Scan(&rate.BaseCurrency, &rate.QuoteCurrency, &rate.EffectiveDate, &rate.Rate, &rate.Source)
+		if err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+	return rates, nil
+}
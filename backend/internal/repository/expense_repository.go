@@ -3,17 +3,72 @@ package repository
 import (
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/expensesplit/backend/internal/database"
 	"github.com/expensesplit/backend/internal/models"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 var (
-	ErrExpenseNotFound = errors.New("expense not found")
+	ErrExpenseNotFound  = errors.New("expense not found")
+	ErrOccurrenceExists = errors.New("an expense already exists for this occurrence")
+	ErrSplitNotFound    = errors.New("split not found")
 )
 
+// recurringOccurrenceIndex is the unique index behind ErrOccurrenceExists.
+const recurringOccurrenceIndex = "idx_expenses_recurring_occurrence"
+
+// expenseColumns lists the columns read by scanExpense, in order.
+const expenseColumns = `id, team_id, paid_by, amount, currency, original_amount, exchange_rate,
+	tax_amount, service_charge, tip_amount, description, category, receipt_url, split_type, incurred_on,
+	created_at, updated_at, recurring_expense_id, occurrence_date, deleted_at, deleted_by`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanExpense(row rowScanner) (*models.Expense, error) {
+	expense := &models.Expense{}
+	var recurringID, deletedBy uuid.NullUUID
+	var deletedAt sql.NullTime
+	err := row.Scan(
+		&expense.ID, &expense.TeamID, &expense.PaidBy, &expense.Amount, &expense.Currency,
+		&expense.OriginalAmount, &expense.ExchangeRate, &expense.Tax, &expense.ServiceCharge, &expense.Tip,
+		&expense.Description,
+		&expense.Category, &expense.ReceiptURL, &expense.SplitType, &expense.IncurredOn,
+		&expense.CreatedAt, &expense.UpdatedAt, &recurringID, &expense.OccurrenceDate, &deletedAt, &deletedBy,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if recurringID.Valid {
+		expense.RecurringExpenseID = &recurringID.UUID
+	}
+	if deletedAt.Valid {
+		expense.DeletedAt = &deletedAt.Time
+	}
+	if deletedBy.Valid {
+		expense.DeletedBy = &deletedBy.UUID
+	}
+	return expense, nil
+}
+
+// splitColumns lists the columns read by scanSplit, in order.
+const splitColumns = `expense_splits.id, expense_splits.expense_id, expense_splits.user_id,
+	expense_splits.amount, expense_splits.percent, COALESCE(expense_splits.shares, 0),
+	COALESCE((SELECT SUM(a.amount) FROM settlement_allocations a WHERE a.split_id = expense_splits.id), 0)`
+
+func scanSplit(row rowScanner) (models.ExpenseSplit, error) {
+	split := models.ExpenseSplit{}
+	err := row.Scan(&split.ID, &split.ExpenseID, &split.UserID, &split.Amount, &split.Percent,
+		&split.Shares, &split.SettledAmount)
+	return split, err
+}
+
 type ExpenseRepository struct {
 	db *database.DB
 }
@@ -22,56 +77,243 @@ func NewExpenseRepository(db *database.DB) *ExpenseRepository {
 	return &ExpenseRepository{db: db}
 }
 
-func (r *ExpenseRepository) Create(expense *models.Expense, splits []models.ExpenseSplit) error {
-	tx, err := r.db.Begin()
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
+func (r *ExpenseRepository) Create(expense *models.Expense, payers []models.ExpensePayer, splits []models.ExpenseSplit, items []models.ExpenseItem) error {
+	return r.db.WithTx(func(tx *database.Tx) error {
+		return r.CreateTx(tx, expense, payers, splits, items)
+	})
+}
 
+// CreateTx inserts the expense with its payers, splits and receipt items
+// using q, which is typically a transaction owned by the caller.
+func (r *ExpenseRepository) CreateTx(q database.Querier, expense *models.Expense, payers []models.ExpensePayer, splits []models.ExpenseSplit, items []models.ExpenseItem) error {
 	expense.ID = uuid.New()
 	expense.CreatedAt = time.Now()
 	expense.UpdatedAt = time.Now()
 
 	// Insert expense
 	query := `
-		INSERT INTO expenses (id, team_id, paid_by, amount, description, category, receipt_url, split_type, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		INSERT INTO expenses (id, team_id, paid_by, amount, currency, original_amount, exchange_rate,
+			tax_amount, service_charge, tip_amount, description, category, receipt_url, split_type, incurred_on,
+			created_at, updated_at, recurring_expense_id, occurrence_date)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
 	`
-	_, err = tx.Exec(query, expense.ID, expense.TeamID, expense.PaidBy, expense.Amount, expense.Description,
-		expense.Category, expense.ReceiptURL, expense.SplitType, expense.CreatedAt, expense.UpdatedAt)
+	_, err := q.Exec(query, expense.ID, expense.TeamID, expense.PaidBy, expense.Amount, expense.Currency,
+		expense.OriginalAmount, expense.ExchangeRate, expense.Tax, expense.ServiceCharge, expense.Tip, expense.Description,
+		expense.Category, expense.ReceiptURL, expense.SplitType, expense.IncurredOn, expense.CreatedAt, expense.UpdatedAt,
+		expense.RecurringExpenseID, expense.OccurrenceDate)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" && pqErr.Constraint == recurringOccurrenceIndex {
+		return ErrOccurrenceExists
+	}
 	if err != nil {
 		return err
 	}
 
-	// Insert splits
-	splitQuery := `
-		INSERT INTO expense_splits (id, expense_id, user_id, amount, percent, is_settled)
+	if err := insertPayers(q, expense.ID, payers); err != nil {
+		return err
+	}
+	for i := range splits {
+		if err := insertSplit(q, expense.ID, &splits[i]); err != nil {
+			return err
+		}
+	}
+	return insertItems(q, expense.ID, items)
+}
+
+func insertSplit(q database.Querier, expenseID uuid.UUID, split *models.ExpenseSplit) error {
+	split.ID = uuid.New()
+	split.ExpenseID = expenseID
+	query := `
+		INSERT INTO expense_splits (id, expense_id, user_id, amount, percent, shares)
 		VALUES ($1, $2, $3, $4, $5, $6)
 	`
-	for i := range splits {
-		splits[i].ID = uuid.New()
-		splits[i].ExpenseID = expense.ID
-		_, err = tx.Exec(splitQuery, splits[i].ID, splits[i].ExpenseID, splits[i].UserID,
-			splits[i].Amount, splits[i].Percent, splits[i].IsSettled)
+	_, err := q.Exec(query, split.ID, split.ExpenseID, split.UserID,
+		split.Amount, split.Percent, nullableShares(split.Shares))
+	return err
+}
+
+func insertPayers(q database.Querier, expenseID uuid.UUID, payers []models.ExpensePayer) error {
+	query := `
+		INSERT INTO expense_payers (expense_id, user_id, position, amount)
+		VALUES ($1, $2, $3, $4)
+	`
+	for i := range payers {
+		payers[i].ExpenseID = expenseID
+		if _, err := q.Exec(query, expenseID, payers[i].UserID, i, payers[i].Amount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertItems(q database.Querier, expenseID uuid.UUID, items []models.ExpenseItem) error {
+	query := `
+		INSERT INTO expense_items (id, expense_id, position, description, amount, assigned_to)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	for i := range items {
+		items[i].ID = uuid.New()
+		items[i].ExpenseID = expenseID
+		items[i].Position = i
+		_, err := q.Exec(query, items[i].ID, items[i].ExpenseID, items[i].Position,
+			items[i].Description, items[i].Amount, pq.Array(uuidStrings(items[i].AssignedTo)))
 		if err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
-	return tx.Commit()
+func (r *ExpenseRepository) GetPayersByExpenseID(expenseID uuid.UUID) ([]models.ExpensePayer, error) {
+	return r.GetPayersByExpenseIDTx(r.db, expenseID)
 }
 
-func (r *ExpenseRepository) GetByID(id uuid.UUID) (*models.Expense, error) {
-	expense := &models.Expense{}
+// GetPayersByExpenseIDTx loads the payers of the expense using q.
+func (r *ExpenseRepository) GetPayersByExpenseIDTx(q database.Querier, expenseID uuid.UUID) ([]models.ExpensePayer, error) {
 	query := `
-		SELECT id, team_id, paid_by, amount, description, category, receipt_url, split_type, created_at, updated_at
-		FROM expenses WHERE id = $1
+		SELECT expense_id, user_id, amount
+		FROM expense_payers WHERE expense_id = $1
+		ORDER BY position
 	`
-	err := r.db.QueryRow(query, id).Scan(
-		&expense.ID, &expense.TeamID, &expense.PaidBy, &expense.Amount, &expense.Description,
-		&expense.Category, &expense.ReceiptURL, &expense.SplitType, &expense.CreatedAt, &expense.UpdatedAt,
-	)
+	rows, err := q.Query(query, expenseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payers []models.ExpensePayer
+	for rows.Next() {
+		payer := models.ExpensePayer{}
+		if err := rows.Scan(&payer.ExpenseID, &payer.UserID, &payer.Amount); err != nil {
+			return nil, err
+		}
+		payers = append(payers, payer)
+	}
+	return payers, nil
+}
+
+// GetPayersByExpenseIDs loads the payers of several expenses in one query,
+// keyed by expense ID.
+func (r *ExpenseRepository) GetPayersByExpenseIDs(expenseIDs []uuid.UUID) (map[uuid.UUID][]models.ExpensePayer, error) {
+	return r.GetPayersByExpenseIDsTx(r.db, expenseIDs)
+}
+
+// GetPayersByExpenseIDsTx loads the payers of several expenses using q.
+func (r *ExpenseRepository) GetPayersByExpenseIDsTx(q database.Querier, expenseIDs []uuid.UUID) (map[uuid.UUID][]models.ExpensePayer, error) {
+	payers := make(map[uuid.UUID][]models.ExpensePayer, len(expenseIDs))
+	if len(expenseIDs) == 0 {
+		return payers, nil
+	}
+	query := `
+		SELECT expense_id, user_id, amount
+		FROM expense_payers WHERE expense_id = ANY($1::uuid[])
+		ORDER BY expense_id, position
+	`
+	rows, err := q.Query(query, pq.Array(uuidStrings(expenseIDs)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		payer := models.ExpensePayer{}
+		if err := rows.Scan(&payer.ExpenseID, &payer.UserID, &payer.Amount); err != nil {
+			return nil, err
+		}
+		payers[payer.ExpenseID] = append(payers[payer.ExpenseID], payer)
+	}
+	return payers, nil
+}
+
+func (r *ExpenseRepository) GetItemsByExpenseID(expenseID uuid.UUID) ([]models.ExpenseItem, error) {
+	return r.GetItemsByExpenseIDTx(r.db, expenseID)
+}
+
+// GetItemsByExpenseIDTx loads the receipt items of the expense using q.
+func (r *ExpenseRepository) GetItemsByExpenseIDTx(q database.Querier, expenseID uuid.UUID) ([]models.ExpenseItem, error) {
+	query := `
+		SELECT id, expense_id, position, COALESCE(description, ''), amount, assigned_to
+		FROM expense_items WHERE expense_id = $1
+		ORDER BY position
+	`
+	rows, err := q.Query(query, expenseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []models.ExpenseItem
+	for rows.Next() {
+		item := models.ExpenseItem{}
+		var assignedTo pq.StringArray
+		err := rows.Scan(&item.ID, &item.ExpenseID, &item.Position, &item.Description, &item.Amount, &assignedTo)
+		if err != nil {
+			return nil, err
+		}
+		item.AssignedTo, err = parseUUIDs(assignedTo)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// GetItemsByExpenseIDs loads the receipt items of several expenses in one
+// query, keyed by expense ID.
+func (r *ExpenseRepository) GetItemsByExpenseIDs(expenseIDs []uuid.UUID) (map[uuid.UUID][]models.ExpenseItem, error) {
+	items := make(map[uuid.UUID][]models.ExpenseItem, len(expenseIDs))
+	if len(expenseIDs) == 0 {
+		return items, nil
+	}
+	query := `
+		SELECT id, expense_id, position, COALESCE(description, ''), amount, assigned_to
+		FROM expense_items WHERE expense_id = ANY($1::uuid[])
+		ORDER BY expense_id, position
+	`
+	rows, err := r.db.Query(query, pq.Array(uuidStrings(expenseIDs)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := models.ExpenseItem{}
+		var assignedTo pq.StringArray
+		err := rows.Scan(&item.ID, &item.ExpenseID, &item.Position, &item.Description, &item.Amount, &assignedTo)
+		if err != nil {
+			return nil, err
+		}
+		item.AssignedTo, err = parseUUIDs(assignedTo)
+		if err != nil {
+			return nil, err
+		}
+		items[item.ExpenseID] = append(items[item.ExpenseID], item)
+	}
+	return items, nil
+}
+
+// GetByID returns the expense unless it is in the trash.
+func (r *ExpenseRepository) GetByID(id uuid.UUID) (*models.Expense, error) {
+	return r.GetByIDTx(r.db, id)
+}
+
+// GetByIDTx returns the expense using q unless it is in the trash.
+func (r *ExpenseRepository) GetByIDTx(q database.Querier, id uuid.UUID) (*models.Expense, error) {
+	query := `SELECT ` + expenseColumns + ` FROM expenses WHERE id = $1 AND deleted_at IS NULL`
+	expense, err := scanExpense(q.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrExpenseNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return expense, nil
+}
+
+// GetDeletedByID returns the expense if it is in the trash.
+func (r *ExpenseRepository) GetDeletedByID(id uuid.UUID) (*models.Expense, error) {
+	query := `SELECT ` + expenseColumns + ` FROM expenses WHERE id = $1 AND deleted_at IS NOT NULL`
+	expense, err := scanExpense(r.db.QueryRow(query, id))
 	if err == sql.ErrNoRows {
 		return nil, ErrExpenseNotFound
 	}
@@ -81,47 +323,255 @@ func (r *ExpenseRepository) GetByID(id uuid.UUID) (*models.Expense, error) {
 	return expense, nil
 }
 
-func (r *ExpenseRepository) GetByTeamID(teamID uuid.UUID, limit, offset int) ([]*models.Expense, int64, error) {
+// GetForUpdateTx returns the expense and locks it until the transaction q
+// ends, so changes to it are made one at a time. With deleted set it
+// returns the expense only if it is in the trash, otherwise only if it
+// isn't.
+func (r *ExpenseRepository) GetForUpdateTx(q database.Querier, id uuid.UUID, deleted bool) (*models.Expense, error) {
+	condition := "deleted_at IS NULL"
+	if deleted {
+		condition = "deleted_at IS NOT NULL"
+	}
+	query := `SELECT ` + expenseColumns + ` FROM expenses WHERE id = $1 AND ` + condition + ` FOR UPDATE`
+	expense, err := scanExpense(q.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrExpenseNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return expense, nil
+}
+
+// GetByCategoryForUpdateTx returns the team's expenses in the category,
+// including those in the trash, and locks them until the transaction q
+// ends. They are locked in ID order so concurrent callers can't deadlock.
+func (r *ExpenseRepository) GetByCategoryForUpdateTx(q database.Querier, teamID uuid.UUID, category string) ([]*models.Expense, error) {
+	query := `
+		SELECT ` + expenseColumns + ` FROM expenses
+		WHERE team_id = $1 AND lower(category) = lower($2)
+		ORDER BY id
+		FOR UPDATE
+	`
+	rows, err := q.Query(query, teamID, category)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var expenses []*models.Expense
+	for rows.Next() {
+		expense, err := scanExpense(rows)
+		if err != nil {
+			return nil, err
+		}
+		expenses = append(expenses, expense)
+	}
+	return expenses, nil
+}
+
+// SetCategoryTx moves the expense to another category using q. Unlike
+// UpdateTx it also applies to expenses in the trash, so that renaming a
+// category renames it everywhere.
+func (r *ExpenseRepository) SetCategoryTx(q database.Querier, expense *models.Expense) error {
+	expense.UpdatedAt = time.Now()
+	_, err := q.Exec(`UPDATE expenses SET category = $1, updated_at = $2 WHERE id = $3`,
+		expense.Category, expense.UpdatedAt, expense.ID)
+	return err
+}
+
+// ExpenseSort is a field the expense list can be ordered by.
+type ExpenseSort string
+
+const (
+	ExpenseSortDate     ExpenseSort = "date" // Incurred on, then created at
+	ExpenseSortAmount   ExpenseSort = "amount"
+	ExpenseSortCategory ExpenseSort = "category"
+)
+
+// expenseSortKeys maps each sort to its keyset. Ties are broken by creation
+// time and then ID.
+var expenseSortKeys = map[ExpenseSort]keyset{
+	ExpenseSortDate: {
+		name:    string(ExpenseSortDate),
+		columns: []string{"incurred_on", "created_at", "id"},
+		types:   []string{"date", "timestamp", "uuid"},
+	},
+	ExpenseSortAmount: {
+		name:    string(ExpenseSortAmount),
+		columns: []string{"amount", "created_at", "id"},
+		types:   []string{"numeric", "timestamp", "uuid"},
+	},
+	ExpenseSortCategory: {
+		name:    string(ExpenseSortCategory),
+		columns: []string{"lower(COALESCE(category, ''))", "incurred_on", "created_at", "id"},
+		types:   []string{"text", "date", "timestamp", "uuid"},
+	},
+}
+
+// IsValidExpenseSort reports whether sort is a supported ExpenseSort.
+func IsValidExpenseSort(sort ExpenseSort) bool {
+	_, ok := expenseSortKeys[sort]
+	return ok
+}
+
+// ExpenseFilter narrows and orders a team's expense list. Zero values match
+// everything.
+type ExpenseFilter struct {
+	From           models.Date   // Incurred on or after
+	To             models.Date   // Incurred on or before
+	Categories     []string      // Any of these categories, case-insensitive
+	PayerID        *uuid.UUID    // Paid (in part) by this member
+	ParticipantID  *uuid.UUID    // Split with this member
+	MinAmount      *models.Money // In the team's base currency
+	MaxAmount      *models.Money
+	ApprovalStatus models.ApprovalStatus
+	HasReceipt     *bool
+	Search         string // Full-text search over the description
+	Deleted        bool   // List the trash instead of the live expenses
+
+	Sort      ExpenseSort // Defaults to ExpenseSortDate
+	Ascending bool        // Defaults to descending
+}
+
+// where returns the WHERE clause for the filter. The team ID is always $1;
+// filter values are appended to args.
+func (f ExpenseFilter) where(args []interface{}) (string, []interface{}) {
+	clause := "team_id = $1 AND deleted_at IS NULL"
+	if f.Deleted {
+		clause = "team_id = $1 AND deleted_at IS NOT NULL"
+	}
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		clause += " AND " + fmt.Sprintf(condition, len(args))
+	}
+
+	if !f.From.IsZero() {
+		add("incurred_on >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		add("incurred_on <= $%d", f.To)
+	}
+	if len(f.Categories) > 0 {
+		categories := make([]string, len(f.Categories))
+		for i, category := range f.Categories {
+			categories[i] = strings.ToLower(category)
+		}
+		add("lower(category) = ANY($%d)", pq.Array(categories))
+	}
+	if f.PayerID != nil {
+		add("id IN (SELECT expense_id FROM expense_payers WHERE user_id = $%d)", *f.PayerID)
+	}
+	if f.ParticipantID != nil {
+		add("id IN (SELECT expense_id FROM expense_splits WHERE user_id = $%d)", *f.ParticipantID)
+	}
+	if f.MinAmount != nil {
+		add("amount >= $%d", *f.MinAmount)
+	}
+	if f.MaxAmount != nil {
+		add("amount <= $%d", *f.MaxAmount)
+	}
+	if f.ApprovalStatus != "" {
+		// Expenses without an approval record count as pending
+		add(`COALESCE((SELECT status FROM approvals WHERE expense_id = expenses.id LIMIT 1), 'pending') = $%d`,
+			f.ApprovalStatus)
+	}
+	if f.HasReceipt != nil {
+		if *f.HasReceipt {
+			clause += " AND COALESCE(receipt_url, '') <> ''"
+		} else {
+			clause += " AND COALESCE(receipt_url, '') = ''"
+		}
+	}
+	if search := strings.TrimSpace(f.Search); search != "" {
+		add("search_vector @@ websearch_to_tsquery('simple', $%d)", search)
+	}
+	return clause, args
+}
+
+// keyset returns the sort key of the filter's order.
+func (f ExpenseFilter) keyset() keyset {
+	if key, ok := expenseSortKeys[f.Sort]; ok {
+		return key
+	}
+	return expenseSortKeys[ExpenseSortDate]
+}
+
+// expenseCursor returns the cursor following expense in the given order.
+func expenseCursor(key keyset, expense *models.Expense) string {
+	values := []string{expense.IncurredOn.String(), cursorTime(expense.CreatedAt), expense.ID.String()}
+	switch key.name {
+	case string(ExpenseSortAmount):
+		values[0] = expense.Amount.String()
+	case string(ExpenseSortCategory):
+		values = append([]string{strings.ToLower(expense.Category)}, values...)
+	}
+	return key.cursor(values...)
+}
+
+// GetByTeamID lists a page of the team's expenses matching filter in the
+// filter's order, most recently incurred first by default. The total counts
+// every matching expense; the cursor of the next page is empty on the last
+// page.
+func (r *ExpenseRepository) GetByTeamID(teamID uuid.UUID, filter ExpenseFilter, page Page) ([]*models.Expense, int64, string, error) {
+	where, args := filter.where([]interface{}{teamID})
+
 	// Get total count
 	var total int64
-	err := r.db.QueryRow("SELECT COUNT(*) FROM expenses WHERE team_id = $1", teamID).Scan(&total)
+	err := r.db.QueryRow("SELECT COUNT(*) FROM expenses WHERE "+where, args...).Scan(&total)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, "", err
 	}
 
+	key := filter.keyset()
+	if page.Cursor != "" {
+		var after string
+		if after, args, err = key.after(page.Cursor, filter.Ascending, args); err != nil {
+			return nil, 0, "", err
+		}
+		where += " AND " + after
+	}
+	window, args := page.window(args)
+
 	query := `
-		SELECT id, team_id, paid_by, amount, description, category, receipt_url, split_type, created_at, updated_at
-		FROM expenses WHERE team_id = $1
-		ORDER BY created_at DESC
-		LIMIT $2 OFFSET $3
-	`
-	rows, err := r.db.Query(query, teamID, limit, offset)
+		SELECT ` + expenseColumns + `
+		FROM expenses WHERE ` + where + `
+		ORDER BY ` + key.orderBy(filter.Ascending) + `
+		` + window
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, "", err
 	}
 	defer rows.Close()
 
 	var expenses []*models.Expense
 	for rows.Next() {
-		expense := &models.Expense{}
-		err := rows.Scan(
-			&expense.ID, &expense.TeamID, &expense.PaidBy, &expense.Amount, &expense.Description,
-			&expense.Category, &expense.ReceiptURL, &expense.SplitType, &expense.CreatedAt, &expense.UpdatedAt,
-		)
+		expense, err := scanExpense(rows)
 		if err != nil {
-			return nil, 0, err
+			return nil, 0, "", err
 		}
 		expenses = append(expenses, expense)
 	}
-	return expenses, total, nil
+
+	var next string
+	if len(expenses) > page.Limit {
+		expenses = expenses[:page.Limit]
+		next = expenseCursor(key, expenses[page.Limit-1])
+	}
+	return expenses, total, next, nil
 }
 
 func (r *ExpenseRepository) GetSplitsByExpenseID(expenseID uuid.UUID) ([]models.ExpenseSplit, error) {
+	return r.GetSplitsByExpenseIDTx(r.db, expenseID)
+}
+
+// GetSplitsByExpenseIDTx loads the splits of the expense using q.
+func (r *ExpenseRepository) GetSplitsByExpenseIDTx(q database.Querier, expenseID uuid.UUID) ([]models.ExpenseSplit, error) {
 	query := `
-		SELECT id, expense_id, user_id, amount, percent, is_settled
+		SELECT ` + splitColumns + `
 		FROM expense_splits WHERE expense_id = $1
 	`
-	rows, err := r.db.Query(query, expenseID)
+	rows, err := q.Query(query, expenseID)
 	if err != nil {
 		return nil, err
 	}
@@ -129,8 +579,7 @@ func (r *ExpenseRepository) GetSplitsByExpenseID(expenseID uuid.UUID) ([]models.
 
 	var splits []models.ExpenseSplit
 	for rows.Next() {
-		split := models.ExpenseSplit{}
-		err := rows.Scan(&split.ID, &split.ExpenseID, &split.UserID, &split.Amount, &split.Percent, &split.IsSettled)
+		split, err := scanSplit(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -139,14 +588,55 @@ func (r *ExpenseRepository) GetSplitsByExpenseID(expenseID uuid.UUID) ([]models.
 	return splits, nil
 }
 
+// GetSplitsByExpenseIDs loads the splits of several expenses in one query,
+// keyed by expense ID.
+func (r *ExpenseRepository) GetSplitsByExpenseIDs(expenseIDs []uuid.UUID) (map[uuid.UUID][]models.ExpenseSplit, error) {
+	return r.GetSplitsByExpenseIDsTx(r.db, expenseIDs)
+}
+
+// GetSplitsByExpenseIDsTx loads the splits of several expenses using q.
+func (r *ExpenseRepository) GetSplitsByExpenseIDsTx(q database.Querier, expenseIDs []uuid.UUID) (map[uuid.UUID][]models.ExpenseSplit, error) {
+	splits := make(map[uuid.UUID][]models.ExpenseSplit, len(expenseIDs))
+	if len(expenseIDs) == 0 {
+		return splits, nil
+	}
+	query := `
+		SELECT ` + splitColumns + `
+		FROM expense_splits WHERE expense_id = ANY($1::uuid[])
+	`
+	rows, err := q.Query(query, pq.Array(uuidStrings(expenseIDs)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		split, err := scanSplit(rows)
+		if err != nil {
+			return nil, err
+		}
+		splits[split.ExpenseID] = append(splits[split.ExpenseID], split)
+	}
+	return splits, nil
+}
+
 func (r *ExpenseRepository) Update(expense *models.Expense) error {
+	return r.UpdateTx(r.db, expense)
+}
+
+// UpdateTx writes all editable expense fields using q. Expenses in the
+// trash can't be changed.
+func (r *ExpenseRepository) UpdateTx(q database.Querier, expense *models.Expense) error {
 	expense.UpdatedAt = time.Now()
 	query := `
-		UPDATE expenses SET amount = $1, description = $2, category = $3, receipt_url = $4, updated_at = $5
-		WHERE id = $6
+		UPDATE expenses SET amount = $1, original_amount = $2, tax_amount = $3, service_charge = $4,
+			tip_amount = $5, description = $6, category = $7, receipt_url = $8, split_type = $9,
+			incurred_on = $10, updated_at = $11
+		WHERE id = $12 AND deleted_at IS NULL
 	`
-	result, err := r.db.Exec(query, expense.Amount, expense.Description, expense.Category,
-		expense.ReceiptURL, expense.UpdatedAt, expense.ID)
+	result, err := q.Exec(query, expense.Amount, expense.OriginalAmount, expense.Tax, expense.ServiceCharge,
+		expense.Tip, expense.Description, expense.Category, expense.ReceiptURL, expense.SplitType,
+		expense.IncurredOn, expense.UpdatedAt, expense.ID)
 	if err != nil {
 		return err
 	}
@@ -160,9 +650,68 @@ func (r *ExpenseRepository) Update(expense *models.Expense) error {
 	return nil
 }
 
-func (r *ExpenseRepository) Delete(id uuid.UUID) error {
-	query := `DELETE FROM expenses WHERE id = $1`
-	result, err := r.db.Exec(query, id)
+// ReplaceSplitsTx makes splits the complete set of splits of the expense.
+// Splits with an ID are updated in place so their identity is kept, splits
+// without one are inserted and any other existing split is deleted.
+func (r *ExpenseRepository) ReplaceSplitsTx(q database.Querier, expenseID uuid.UUID, splits []models.ExpenseSplit) error {
+	var keep []uuid.UUID
+	for _, split := range splits {
+		if split.ID != uuid.Nil {
+			keep = append(keep, split.ID)
+		}
+	}
+	_, err := q.Exec(`DELETE FROM expense_splits WHERE expense_id = $1 AND NOT (id = ANY($2::uuid[]))`,
+		expenseID, pq.Array(uuidStrings(keep)))
+	if err != nil {
+		return err
+	}
+
+	for i := range splits {
+		if splits[i].ID == uuid.Nil {
+			if err := insertSplit(q, expenseID, &splits[i]); err != nil {
+				return err
+			}
+			continue
+		}
+		query := `
+			UPDATE expense_splits SET amount = $1, percent = $2, shares = $3
+			WHERE id = $4 AND expense_id = $5
+		`
+		_, err := q.Exec(query, splits[i].Amount, splits[i].Percent, nullableShares(splits[i].Shares),
+			splits[i].ID, expenseID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReplacePayersTx replaces all payer contributions of the expense.
+func (r *ExpenseRepository) ReplacePayersTx(q database.Querier, expenseID uuid.UUID, payers []models.ExpensePayer) error {
+	if _, err := q.Exec(`DELETE FROM expense_payers WHERE expense_id = $1`, expenseID); err != nil {
+		return err
+	}
+	return insertPayers(q, expenseID, payers)
+}
+
+// ReplaceItemsTx replaces all receipt items of the expense.
+func (r *ExpenseRepository) ReplaceItemsTx(q database.Querier, expenseID uuid.UUID, items []models.ExpenseItem) error {
+	if _, err := q.Exec(`DELETE FROM expense_items WHERE expense_id = $1`, expenseID); err != nil {
+		return err
+	}
+	return insertItems(q, expenseID, items)
+}
+
+// Delete moves the expense to the trash. Its splits, payers and approval
+// are kept so that it can be restored.
+func (r *ExpenseRepository) Delete(id, deletedBy uuid.UUID) error {
+	return r.DeleteTx(r.db, id, deletedBy)
+}
+
+// DeleteTx moves the expense to the trash using q.
+func (r *ExpenseRepository) DeleteTx(q database.Querier, id, deletedBy uuid.UUID) error {
+	query := `UPDATE expenses SET deleted_at = $1, deleted_by = $2 WHERE id = $3 AND deleted_at IS NULL`
+	result, err := q.Exec(query, time.Now(), deletedBy, id)
 	if err != nil {
 		return err
 	}
@@ -176,9 +725,15 @@ func (r *ExpenseRepository) Delete(id uuid.UUID) error {
 	return nil
 }
 
-func (r *ExpenseRepository) MarkSplitAsSettled(splitID uuid.UUID) error {
-	query := `UPDATE expense_splits SET is_settled = true WHERE id = $1`
-	result, err := r.db.Exec(query, splitID)
+// Restore takes the expense back out of the trash.
+func (r *ExpenseRepository) Restore(id uuid.UUID) error {
+	return r.RestoreTx(r.db, id)
+}
+
+// RestoreTx takes the expense back out of the trash using q.
+func (r *ExpenseRepository) RestoreTx(q database.Querier, id uuid.UUID) error {
+	query := `UPDATE expenses SET deleted_at = NULL, deleted_by = NULL WHERE id = $1 AND deleted_at IS NOT NULL`
+	result, err := q.Exec(query, id)
 	if err != nil {
 		return err
 	}
@@ -187,19 +742,127 @@ func (r *ExpenseRepository) MarkSplitAsSettled(splitID uuid.UUID) error {
 		return err
 	}
 	if rowsAffected == 0 {
-		return errors.New("split not found")
+		return ErrExpenseNotFound
 	}
 	return nil
 }
 
+// GetDeletedBeforeForUpdateTx returns the expenses that were moved to the
+// trash before the cutoff and locks them until the transaction q ends.
+func (r *ExpenseRepository) GetDeletedBeforeForUpdateTx(q database.Querier, before time.Time) ([]*models.Expense, error) {
+	query := `
+		SELECT ` + expenseColumns + ` FROM expenses
+		WHERE deleted_at < $1
+		ORDER BY id
+		FOR UPDATE
+	`
+	rows, err := q.Query(query, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var expenses []*models.Expense
+	for rows.Next() {
+		expense, err := scanExpense(rows)
+		if err != nil {
+			return nil, err
+		}
+		expenses = append(expenses, expense)
+	}
+	return expenses, nil
+}
+
+// PurgeTx permanently removes the expenses in the trash, along with their
+// splits, payers and approvals, using q. Each leaves a tombstone recording
+// when it was deleted; its revisions are kept.
+func (r *ExpenseRepository) PurgeTx(q database.Querier, ids []uuid.UUID) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	_, err := q.Exec(`
+		INSERT INTO purged_expenses (expense_id, team_id, deleted_at)
+		SELECT id, team_id, deleted_at FROM expenses
+		WHERE id = ANY($1::uuid[]) AND deleted_at IS NOT NULL
+		ON CONFLICT (expense_id) DO NOTHING
+	`, pq.Array(uuidStrings(ids)))
+	if err != nil {
+		return 0, err
+	}
+	result, err := q.Exec(`DELETE FROM expenses WHERE id = ANY($1::uuid[]) AND deleted_at IS NOT NULL`,
+		pq.Array(uuidStrings(ids)))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetPurgedDeletedAfter returns when each of the team's purged expenses
+// that were still out of the trash at the given time was deleted, keyed
+// by expense ID.
+func (r *ExpenseRepository) GetPurgedDeletedAfter(teamID uuid.UUID, after time.Time) (map[uuid.UUID]time.Time, error) {
+	rows, err := r.db.Query(`
+		SELECT expense_id, deleted_at FROM purged_expenses
+		WHERE team_id = $1 AND deleted_at > $2
+	`, teamID, after)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deleted := make(map[uuid.UUID]time.Time)
+	for rows.Next() {
+		var id uuid.UUID
+		var deletedAt time.Time
+		if err := rows.Scan(&id, &deletedAt); err != nil {
+			return nil, err
+		}
+		deleted[id] = deletedAt
+	}
+	return deleted, rows.Err()
+}
+
+// GetSplitForUpdateTx reads the split using q and locks its row until the
+// transaction ends, so settling it can't race another settlement of it.
+func (r *ExpenseRepository) GetSplitForUpdateTx(q database.Querier, splitID uuid.UUID) (*models.ExpenseSplit, error) {
+	return r.getSplit(q, splitID, "FOR NO KEY UPDATE")
+}
+
+func (r *ExpenseRepository) getSplit(q database.Querier, splitID uuid.UUID, lock string) (*models.ExpenseSplit, error) {
+	query := `
+		SELECT ` + splitColumns + `
+		FROM expense_splits WHERE id = $1
+	` + lock
+	split, err := scanSplit(q.QueryRow(query, splitID))
+	if err == sql.ErrNoRows {
+		return nil, ErrSplitNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &split, nil
+}
+
+// GetUnsettledSplitsByUser lists the user's splits in the team that
+// settlements haven't fully paid off yet, oldest expense first. Whom they are owed to depends on
+// the payers of each expense.
 func (r *ExpenseRepository) GetUnsettledSplitsByUser(teamID, userID uuid.UUID) ([]models.ExpenseSplit, error) {
+	return r.GetUnsettledSplitsByUserTx(r.db, teamID, userID)
+}
+
+// GetUnsettledSplitsByUserTx reads the user's unsettled splits using q.
+func (r *ExpenseRepository) GetUnsettledSplitsByUserTx(q database.Querier, teamID, userID uuid.UUID) ([]models.ExpenseSplit, error) {
 	query := `
-		SELECT es.id, es.expense_id, es.user_id, es.amount, es.percent, es.is_settled
-		FROM expense_splits es
-		INNER JOIN expenses e ON es.expense_id = e.id
-		WHERE e.team_id = $1 AND es.user_id = $2 AND es.is_settled = false AND e.paid_by != $2
+		SELECT ` + splitColumns + `
+		FROM expense_splits
+		INNER JOIN expenses e ON expense_splits.expense_id = e.id
+		WHERE e.team_id = $1 AND expense_splits.user_id = $2
+		AND COALESCE((SELECT SUM(a.amount) FROM settlement_allocations a WHERE a.split_id = expense_splits.id), 0)
+			< expense_splits.amount
+		AND e.deleted_at IS NULL
+		ORDER BY e.incurred_on, e.created_at, expense_splits.id
 	`
-	rows, err := r.db.Query(query, teamID, userID)
+	rows, err := q.Query(query, teamID, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -207,8 +870,7 @@ func (r *ExpenseRepository) GetUnsettledSplitsByUser(teamID, userID uuid.UUID) (
 
 	var splits []models.ExpenseSplit
 	for rows.Next() {
-		split := models.ExpenseSplit{}
-		err := rows.Scan(&split.ID, &split.ExpenseID, &split.UserID, &split.Amount, &split.Percent, &split.IsSettled)
+		split, err := scanSplit(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -217,11 +879,49 @@ func (r *ExpenseRepository) GetUnsettledSplitsByUser(teamID, userID uuid.UUID) (
 	return splits, nil
 }
 
+// GetAllByTeamID returns every expense of the team that is not in the
+// trash, for computations that need all of them.
+func (r *ExpenseRepository) GetAllByTeamID(teamID uuid.UUID) ([]*models.Expense, error) {
+	return r.GetAllByTeamIDTx(r.db, teamID)
+}
+
+// GetAllByTeamIDTx loads the team's expenses outside the trash using q.
+func (r *ExpenseRepository) GetAllByTeamIDTx(q database.Querier, teamID uuid.UUID) ([]*models.Expense, error) {
+	return r.getAllByTeamID(q, teamID, "deleted_at IS NULL")
+}
+
+// GetAllByTeamIDWithTrash lists all of the team's expenses, including those
+// in the trash.
+func (r *ExpenseRepository) GetAllByTeamIDWithTrash(teamID uuid.UUID) ([]*models.Expense, error) {
+	return r.getAllByTeamID(r.db, teamID, "TRUE")
+}
+
+func (r *ExpenseRepository) getAllByTeamID(q database.Querier, teamID uuid.UUID, condition string) ([]*models.Expense, error) {
+	query := `SELECT ` + expenseColumns + ` FROM expenses WHERE team_id = $1 AND ` + condition
+	rows, err := q.Query(query, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var expenses []*models.Expense
+	for rows.Next() {
+		expense, err := scanExpense(rows)
+		if err != nil {
+			return nil, err
+		}
+		expenses = append(expenses, expense)
+	}
+	return expenses, nil
+}
+
 func (r *ExpenseRepository) GetExpensesByUserPaid(teamID, userID uuid.UUID) ([]*models.Expense, error) {
 	query := `
-		SELECT id, team_id, paid_by, amount, description, category, receipt_url, split_type, created_at, updated_at
-		FROM expenses WHERE team_id = $1 AND paid_by = $2
-		ORDER BY created_at DESC
+		SELECT ` + expenseColumns + `
+		FROM expenses
+		WHERE team_id = $1 AND id IN (SELECT expense_id FROM expense_payers WHERE user_id = $2)
+		AND deleted_at IS NULL
+		ORDER BY incurred_on DESC, created_at DESC
 	`
 	rows, err := r.db.Query(query, teamID, userID)
 	if err != nil {
@@ -231,11 +931,7 @@ func (r *ExpenseRepository) GetExpensesByUserPaid(teamID, userID uuid.UUID) ([]*
 
 	var expenses []*models.Expense
 	for rows.Next() {
-		expense := &models.Expense{}
-		err := rows.Scan(
-			&expense.ID, &expense.TeamID, &expense.PaidBy, &expense.Amount, &expense.Description,
-			&expense.Category, &expense.ReceiptURL, &expense.SplitType, &expense.CreatedAt, &expense.UpdatedAt,
-		)
+		expense, err := scanExpense(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -243,3 +939,31 @@ func (r *ExpenseRepository) GetExpensesByUserPaid(teamID, userID uuid.UUID) ([]*
 	}
 	return expenses, nil
 }
+
+// nullableShares stores share weights only for shares-based splits.
+func nullableShares(shares int64) interface{} {
+	if shares == 0 {
+		return nil
+	}
+	return shares
+}
+
+func uuidStrings(ids []uuid.UUID) []string {
+	values := make([]string, len(ids))
+	for i, id := range ids {
+		values[i] = id.String()
+	}
+	return values
+}
+
+func parseUUIDs(values []string) ([]uuid.UUID, error) {
+	ids := make([]uuid.UUID, len(values))
+	for i, value := range values {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
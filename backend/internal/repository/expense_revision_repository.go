@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/expensesplit/backend/internal/database"
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+type ExpenseRevisionRepository struct {
+	db *database.DB
+}
+
+func NewExpenseRevisionRepository(db *database.DB) *ExpenseRevisionRepository {
+	return &ExpenseRevisionRepository{db: db}
+}
+
+// CreateTx stores the next revision of the expense using q, which should be
+// the transaction that changes the expense. The revision number is assigned
+// here; CreatedAt defaults to now.
+func (r *ExpenseRevisionRepository) CreateTx(q database.Querier, revision *models.ExpenseRevision) error {
+	revision.ID = uuid.New()
+	if revision.CreatedAt.IsZero() {
+		revision.CreatedAt = time.Now()
+	}
+	snapshot, err := json.Marshal(revision.Snapshot)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO expense_revisions (id, expense_id, revision, edited_by, reason, snapshot, created_at)
+		VALUES ($1, $2, (SELECT COALESCE(MAX(revision), 0) + 1 FROM expense_revisions WHERE expense_id = $2),
+			$3, $4, $5, $6)
+		RETURNING revision
+	`
+	return q.QueryRow(query, revision.ID, revision.ExpenseID, revision.EditedBy, revision.Reason,
+		string(snapshot), revision.CreatedAt).Scan(&revision.Revision)
+}
+
+// LatestTx returns the number of the expense's latest revision, or 0 if it
+// has none.
+func (r *ExpenseRevisionRepository) LatestTx(q database.Querier, expenseID uuid.UUID) (int, error) {
+	var latest int
+	err := q.QueryRow(`SELECT COALESCE(MAX(revision), 0) FROM expense_revisions WHERE expense_id = $1`,
+		expenseID).Scan(&latest)
+	return latest, err
+}
+
+// GetByExpenseID lists the revisions of the expense, oldest first.
+func (r *ExpenseRevisionRepository) GetByExpenseID(expenseID uuid.UUID) ([]models.ExpenseRevision, error) {
+	query := `
+		SELECT id, expense_id, revision, edited_by, COALESCE(reason, ''), snapshot, created_at
+		FROM expense_revisions WHERE expense_id = $1
+		ORDER BY revision
+	`
+	rows, err := r.db.Query(query, expenseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []models.ExpenseRevision
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, *revision)
+	}
+	return revisions, rows.Err()
+}
+
+// GetAsOf returns, for each of the expenses that has revisions, its latest
+// revision made at or before asOf, or its first revision if it only got
+// one later.
+func (r *ExpenseRevisionRepository) GetAsOf(expenseIDs []uuid.UUID, asOf time.Time) (map[uuid.UUID]models.ExpenseRevision, error) {
+	revisions := make(map[uuid.UUID]models.ExpenseRevision, len(expenseIDs))
+	if len(expenseIDs) == 0 {
+		return revisions, nil
+	}
+	query := `
+		SELECT DISTINCT ON (expense_id)
+			id, expense_id, revision, edited_by, COALESCE(reason, ''), snapshot, created_at
+		FROM expense_revisions WHERE expense_id = ANY($1::uuid[])
+		ORDER BY expense_id, created_at <= $2 DESC,
+			CASE WHEN created_at <= $2 THEN -revision ELSE revision END
+	`
+	rows, err := r.db.Query(query, pq.Array(uuidStrings(expenseIDs)), asOf)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions[revision.ExpenseID] = *revision
+	}
+	return revisions, rows.Err()
+}
+
+func (r *ExpenseRevisionRepository) Get(expenseID uuid.UUID, number int) (*models.ExpenseRevision, error) {
+	query := `
+		SELECT id, expense_id, revision, edited_by, COALESCE(reason, ''), snapshot, created_at
+		FROM expense_revisions WHERE expense_id = $1 AND revision = $2
+	`
+	revision, err := scanRevision(r.db.QueryRow(query, expenseID, number))
+	if err == sql.ErrNoRows {
+		return nil, ErrRevisionNotFound
+	}
+	return revision, err
+}
+
+func scanRevision(row rowScanner) (*models.ExpenseRevision, error) {
+	revision := &models.ExpenseRevision{}
+	var snapshot []byte
+	err := row.Scan(&revision.ID, &revision.ExpenseID, &revision.Revision, &revision.EditedBy, &revision.Reason,
+		&snapshot, &revision.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(snapshot, &revision.Snapshot); err != nil {
+		return nil, err
+	}
+	return revision, nil
+}
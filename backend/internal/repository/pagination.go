@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/expensesplit/backend/pkg/utils"
+)
+
+// Page selects a window of a list: the rows after Cursor or, without one,
+// the rows after skipping Offset.
+type Page struct {
+	Limit  int
+	Offset int
+	Cursor string
+}
+
+// cursorTimeLayout keeps the full precision of TIMESTAMP columns in cursors.
+const cursorTimeLayout = "2006-01-02 15:04:05.999999"
+
+func cursorTime(t time.Time) string {
+	return t.Format(cursorTimeLayout)
+}
+
+// keyset is the sort key of a list: SQL expressions with the type to cast
+// cursor values to, ending in a unique column so that the order is total.
+// All columns are sorted in the same direction.
+type keyset struct {
+	name    string // Stored in cursors so they can't be reused with another order
+	columns []string
+	types   []string
+}
+
+func (k keyset) orderBy(ascending bool) string {
+	direction := " DESC"
+	if ascending {
+		direction = " ASC"
+	}
+	return strings.Join(k.columns, direction+", ") + direction
+}
+
+// after returns the condition selecting the rows that follow the cursor, with
+// the cursor values appended to args.
+func (k keyset) after(cursor string, ascending bool, args []interface{}) (string, []interface{}, error) {
+	values, err := utils.DecodeCursor(cursor, len(k.columns)+1)
+	if err != nil {
+		return "", nil, err
+	}
+	if values[0] != k.name {
+		return "", nil, utils.ErrInvalidCursor
+	}
+
+	params := make([]string, len(k.columns))
+	for i, value := range values[1:] {
+		args = append(args, value)
+		params[i] = fmt.Sprintf("$%d::%s", len(args), k.types[i])
+	}
+	operator := "<"
+	if ascending {
+		operator = ">"
+	}
+	return fmt.Sprintf("(%s) %s (%s)", strings.Join(k.columns, ", "), operator, strings.Join(params, ", ")), args, nil
+}
+
+// cursor returns the cursor following a row with the given sort key values.
+func (k keyset) cursor(values ...string) string {
+	return utils.EncodeCursor(append([]string{k.name}, values...)...)
+}
+
+// window returns the LIMIT/OFFSET clause for page, with its values appended
+// to args. One extra row is fetched to tell whether there is a next page.
+func (p Page) window(args []interface{}) (string, []interface{}) {
+	offset := p.Offset
+	if p.Cursor != "" {
+		offset = 0
+	}
+	args = append(args, p.Limit+1, offset)
+	return fmt.Sprintf("LIMIT $%d OFFSET $%d", len(args)-1, len(args)), args
+}
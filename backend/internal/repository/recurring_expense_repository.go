@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/expensesplit/backend/internal/database"
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrRecurringExpenseNotFound = errors.New("recurring expense not found")
+)
+
+const recurringExpenseColumns = `id, team_id, created_by, template, frequency, interval_count, day_of_month,
+	start_date, end_date, next_occurrence, created_at, updated_at`
+
+func scanRecurringExpense(row rowScanner) (*models.RecurringExpense, error) {
+	recurring := &models.RecurringExpense{}
+	var template []byte
+	var endDate, nextOccurrence models.Date
+	err := row.Scan(
+		&recurring.ID, &recurring.TeamID, &recurring.CreatedBy, &template, &recurring.Frequency,
+		&recurring.Interval, &recurring.DayOfMonth, &recurring.StartDate, &endDate, &nextOccurrence,
+		&recurring.CreatedAt, &recurring.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(template, &recurring.Template); err != nil {
+		return nil, err
+	}
+	if !endDate.IsZero() {
+		recurring.EndDate = &endDate
+	}
+	if !nextOccurrence.IsZero() {
+		recurring.NextOccurrence = &nextOccurrence
+	}
+	return recurring, nil
+}
+
+// optionalDate stores a nil date as NULL.
+func optionalDate(d *models.Date) interface{} {
+	if d == nil {
+		return nil
+	}
+	return *d
+}
+
+type RecurringExpenseRepository struct {
+	db *database.DB
+}
+
+func NewRecurringExpenseRepository(db *database.DB) *RecurringExpenseRepository {
+	return &RecurringExpenseRepository{db: db}
+}
+
+func (r *RecurringExpenseRepository) Create(recurring *models.RecurringExpense) error {
+	template, err := json.Marshal(recurring.Template)
+	if err != nil {
+		return err
+	}
+
+	recurring.ID = uuid.New()
+	recurring.CreatedAt = time.Now()
+	recurring.UpdatedAt = time.Now()
+
+	query := `
+		INSERT INTO recurring_expenses (id, team_id, created_by, template, frequency, interval_count, day_of_month,
+			start_date, end_date, next_occurrence, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`
+	_, err = r.db.Exec(query, recurring.ID, recurring.TeamID, recurring.CreatedBy, template, recurring.Frequency,
+		recurring.Interval, recurring.DayOfMonth, recurring.StartDate, optionalDate(recurring.EndDate),
+		optionalDate(recurring.NextOccurrence), recurring.CreatedAt, recurring.UpdatedAt)
+	return err
+}
+
+func (r *RecurringExpenseRepository) GetByID(id uuid.UUID) (*models.RecurringExpense, error) {
+	query := `SELECT ` + recurringExpenseColumns + ` FROM recurring_expenses WHERE id = $1`
+	recurring, err := scanRecurringExpense(r.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrRecurringExpenseNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return recurring, nil
+}
+
+func (r *RecurringExpenseRepository) GetByTeamID(teamID uuid.UUID) ([]*models.RecurringExpense, error) {
+	query := `
+		SELECT ` + recurringExpenseColumns + `
+		FROM recurring_expenses WHERE team_id = $1
+		ORDER BY created_at DESC
+	`
+	return r.query(query, teamID)
+}
+
+// GetDue returns the recurring expenses with an occurrence on or before the
+// given day that has not been created yet.
+func (r *RecurringExpenseRepository) GetDue(day models.Date) ([]*models.RecurringExpense, error) {
+	query := `
+		SELECT ` + recurringExpenseColumns + `
+		FROM recurring_expenses WHERE next_occurrence <= $1
+		ORDER BY next_occurrence
+	`
+	return r.query(query, day)
+}
+
+func (r *RecurringExpenseRepository) query(query string, args ...interface{}) ([]*models.RecurringExpense, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recurring []*models.RecurringExpense
+	for rows.Next() {
+		item, err := scanRecurringExpense(rows)
+		if err != nil {
+			return nil, err
+		}
+		recurring = append(recurring, item)
+	}
+	return recurring, nil
+}
+
+func (r *RecurringExpenseRepository) Update(recurring *models.RecurringExpense) error {
+	template, err := json.Marshal(recurring.Template)
+	if err != nil {
+		return err
+	}
+
+	recurring.UpdatedAt = time.Now()
+	query := `
+		UPDATE recurring_expenses SET template = $1, frequency = $2, interval_count = $3, day_of_month = $4,
+			start_date = $5, end_date = $6, next_occurrence = $7, updated_at = $8
+		WHERE id = $9
+	`
+	result, err := r.db.Exec(query, template, recurring.Frequency, recurring.Interval, recurring.DayOfMonth,
+		recurring.StartDate, optionalDate(recurring.EndDate), optionalDate(recurring.NextOccurrence),
+		recurring.UpdatedAt, recurring.ID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecurringExpenseNotFound
+	}
+	return nil
+}
+
+// Advance moves the next occurrence from current to next (nil once the
+// schedule has ended). It only succeeds if the next occurrence is still
+// current, so when several instances process the same occurrence exactly
+// one of them advances it; the others get false.
+func (r *RecurringExpenseRepository) Advance(id uuid.UUID, current models.Date, next *models.Date) (bool, error) {
+	query := `
+		UPDATE recurring_expenses SET next_occurrence = $1, updated_at = $2
+		WHERE id = $3 AND next_occurrence = $4
+	`
+	result, err := r.db.Exec(query, optionalDate(next), time.Now(), id, current)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+func (r *RecurringExpenseRepository) Delete(id uuid.UUID) error {
+	result, err := r.db.Exec(`DELETE FROM recurring_expenses WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecurringExpenseNotFound
+	}
+	return nil
+}
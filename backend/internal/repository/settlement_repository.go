@@ -1,13 +1,60 @@
 package repository
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/expensesplit/backend/internal/database"
 	"github.com/expensesplit/backend/internal/models"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+var (
+	ErrSettlementNotFound = errors.New("settlement not found")
+	ErrSettlementReversed = errors.New("settlement has already been reversed")
+)
+
+// settlementReversalIndex is the unique index behind ErrSettlementReversed.
+const settlementReversalIndex = "idx_settlements_reverses"
+
+// settlementColumns lists the columns read by scanSettlement, in order.
+const settlementColumns = `id, team_id, from_user, to_user, amount, status, recorded_by,
+	COALESCE(dispute_reason, ''), resolved_at, reverses_id,
+	(SELECT r.id FROM settlements r WHERE r.reverses_id = settlements.id AND r.status <> 'cancelled' LIMIT 1),
+	split_id, created_at`
+
+func scanSettlement(row rowScanner) (*models.Settlement, error) {
+	settlement := &models.Settlement{}
+	var recordedBy, reversesID, reversedBy, splitID uuid.NullUUID
+	var resolvedAt sql.NullTime
+	err := row.Scan(&settlement.ID, &settlement.TeamID, &settlement.FromUser, &settlement.ToUser,
+		&settlement.Amount, &settlement.Status, &recordedBy, &settlement.DisputeReason, &resolvedAt,
+		&reversesID, &reversedBy, &splitID, &settlement.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if recordedBy.Valid {
+		settlement.RecordedBy = &recordedBy.UUID
+	}
+	if resolvedAt.Valid {
+		settlement.ResolvedAt = &resolvedAt.Time
+	}
+	if reversesID.Valid {
+		settlement.ReversesID = &reversesID.UUID
+	}
+	if reversedBy.Valid {
+		settlement.ReversedBy = &reversedBy.UUID
+	}
+	if splitID.Valid {
+		settlement.SplitID = &splitID.UUID
+	}
+	return settlement, nil
+}
+
 type SettlementRepository struct {
 	db *database.DB
 }
@@ -17,25 +64,96 @@ func NewSettlementRepository(db *database.DB) *SettlementRepository {
 }
 
 func (r *SettlementRepository) Create(settlement *models.Settlement) error {
+	return r.CreateTx(r.db, settlement)
+}
+
+// CreateTx inserts the settlement using q.
+func (r *SettlementRepository) CreateTx(q database.Querier, settlement *models.Settlement) error {
 	settlement.ID = uuid.New()
 	settlement.CreatedAt = time.Now()
 
 	query := `
-		INSERT INTO settlements (id, team_id, from_user, to_user, amount, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO settlements (id, team_id, from_user, to_user, amount, status, recorded_by, resolved_at,
+			reverses_id, split_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 	`
-	_, err := r.db.Exec(query, settlement.ID, settlement.TeamID, settlement.FromUser,
-		settlement.ToUser, settlement.Amount, settlement.CreatedAt)
+	_, err := q.Exec(query, settlement.ID, settlement.TeamID, settlement.FromUser,
+		settlement.ToUser, settlement.Amount, settlement.Status, settlement.RecordedBy,
+		settlement.ResolvedAt, settlement.ReversesID, settlement.SplitID, settlement.CreatedAt)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" && pqErr.Constraint == settlementReversalIndex {
+		return ErrSettlementReversed
+	}
 	return err
 }
 
+func (r *SettlementRepository) GetByID(id uuid.UUID) (*models.Settlement, error) {
+	return r.GetByIDTx(r.db, id)
+}
+
+// GetByIDTx reads the settlement using q.
+func (r *SettlementRepository) GetByIDTx(q database.Querier, id uuid.UUID) (*models.Settlement, error) {
+	query := `SELECT ` + settlementColumns + ` FROM settlements WHERE id = $1`
+	settlement, err := scanSettlement(q.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrSettlementNotFound
+	}
+	return settlement, err
+}
+
+// UpdateStatusTx moves the settlement from status from to to using q. An
+// empty disputeReason keeps the current one. It returns
+// ErrSettlementNotFound if the settlement is no longer in status from, so
+// that two concurrent changes can't both succeed.
+func (r *SettlementRepository) UpdateStatusTx(q database.Querier, id uuid.UUID, from, to models.SettlementStatus, disputeReason string) error {
+	query := `
+		UPDATE settlements SET status = $1, dispute_reason = COALESCE(NULLIF($2, ''), dispute_reason), resolved_at = $3
+		WHERE id = $4 AND status = $5
+	`
+	result, err := q.Exec(query, to, disputeReason, time.Now(), id, from)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrSettlementNotFound
+	}
+	return nil
+}
+
 func (r *SettlementRepository) GetByTeamID(teamID uuid.UUID) ([]models.Settlement, error) {
+	return r.GetByTeamIDTx(r.db, teamID)
+}
+
+// GetByTeamIDTx lists all of the team's settlements using q.
+func (r *SettlementRepository) GetByTeamIDTx(q database.Querier, teamID uuid.UUID) ([]models.Settlement, error) {
 	query := `
-		SELECT id, team_id, from_user, to_user, amount, created_at
+		SELECT ` + settlementColumns + `
 		FROM settlements WHERE team_id = $1
 		ORDER BY created_at DESC
 	`
-	rows, err := r.db.Query(query, teamID)
+	return r.queryTx(q, query, teamID)
+}
+
+// GetByStatus lists the team's settlements in the given status, oldest
+// first.
+func (r *SettlementRepository) GetByStatus(teamID uuid.UUID, status models.SettlementStatus) ([]models.Settlement, error) {
+	query := `
+		SELECT ` + settlementColumns + `
+		FROM settlements WHERE team_id = $1 AND status = $2
+		ORDER BY created_at
+	`
+	return r.query(query, teamID, status)
+}
+
+func (r *SettlementRepository) query(query string, args ...interface{}) ([]models.Settlement, error) {
+	return r.queryTx(r.db, query, args...)
+}
+
+func (r *SettlementRepository) queryTx(q database.Querier, query string, args ...interface{}) ([]models.Settlement, error) {
+	rows, err := q.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -43,39 +161,266 @@ func (r *SettlementRepository) GetByTeamID(teamID uuid.UUID) ([]models.Settlemen
 
 	var settlements []models.Settlement
 	for rows.Next() {
-		settlement := models.Settlement{}
-		err := rows.Scan(&settlement.ID, &settlement.TeamID, &settlement.FromUser,
-			&settlement.ToUser, &settlement.Amount, &settlement.CreatedAt)
+		settlement, err := scanSettlement(rows)
 		if err != nil {
 			return nil, err
 		}
-		settlements = append(settlements, settlement)
+		settlements = append(settlements, *settlement)
 	}
 	return settlements, nil
 }
 
+// SettlementFilter narrows a listing of a team's settlements. The zero value
+// matches every settlement.
+type SettlementFilter struct {
+	UserID      *uuid.UUID  // Paid or received by this member
+	OtherUserID *uuid.UUID  // With UserID, only between the two in either direction
+	From        models.Date // Recorded on or after
+	To          models.Date // Recorded on or before
+	Status      models.SettlementStatus
+}
+
+// where returns the WHERE clause for the filter. The team ID is always $1;
+// filter values are appended to args.
+func (f SettlementFilter) where(args []interface{}) (string, []interface{}) {
+	clause := "team_id = $1"
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		clause += " AND " + strings.ReplaceAll(condition, "$n", fmt.Sprintf("$%d", len(args)))
+	}
+
+	if f.UserID != nil {
+		add("(from_user = $n OR to_user = $n)", *f.UserID)
+		if f.OtherUserID != nil {
+			add("(from_user = $n OR to_user = $n)", *f.OtherUserID)
+		}
+	}
+	if !f.From.IsZero() {
+		add("created_at >= $n::date", f.From)
+	}
+	if !f.To.IsZero() {
+		add("created_at < $n::date + 1", f.To)
+	}
+	if f.Status != "" {
+		add("status = $n", f.Status)
+	}
+	return clause, args
+}
+
+// settlementKeys orders settlements newest first.
+var settlementKeys = keyset{
+	name:    "settlements",
+	columns: []string{"created_at", "id"},
+	types:   []string{"timestamp", "uuid"},
+}
+
+// ListByTeamID lists a page of the team's settlements matching filter,
+// newest first, with the total number of matching settlements and the
+// cursor of the next page.
+func (r *SettlementRepository) ListByTeamID(teamID uuid.UUID, filter SettlementFilter, page Page) ([]models.Settlement, int64, string, error) {
+	where, args := filter.where([]interface{}{teamID})
+
+	var total int64
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM settlements WHERE `+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	if page.Cursor != "" {
+		var after string
+		if after, args, err = settlementKeys.after(page.Cursor, false, args); err != nil {
+			return nil, 0, "", err
+		}
+		where += " AND " + after
+	}
+	window, args := page.window(args)
+
+	query := `
+		SELECT ` + settlementColumns + `
+		FROM settlements WHERE ` + where + `
+		ORDER BY ` + settlementKeys.orderBy(false) + `
+		` + window
+	settlements, err := r.query(query, args...)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	var next string
+	if len(settlements) > page.Limit {
+		settlements = settlements[:page.Limit]
+		last := settlements[page.Limit-1]
+		next = settlementKeys.cursor(cursorTime(last.CreatedAt), last.ID.String())
+	}
+	return settlements, total, next, nil
+}
+
 func (r *SettlementRepository) GetByUsers(teamID, fromUser, toUser uuid.UUID) ([]models.Settlement, error) {
 	query := `
-		SELECT id, team_id, from_user, to_user, amount, created_at
-		FROM settlements 
+		SELECT ` + settlementColumns + `
+		FROM settlements
 		WHERE team_id = $1 AND ((from_user = $2 AND to_user = $3) OR (from_user = $3 AND to_user = $2))
 		ORDER BY created_at DESC
 	`
-	rows, err := r.db.Query(query, teamID, fromUser, toUser)
+	return r.query(query, teamID, fromUser, toUser)
+}
+
+// SettlementCredit is the part of a confirmed settlement not yet applied to
+// any split.
+type SettlementCredit struct {
+	SettlementID uuid.UUID
+	SplitID      *uuid.UUID // The split the settlement was made for, if any
+	Amount       models.Money
+}
+
+// GetCreditsTx lists, oldest first, the confirmed settlements from fromUser
+// to toUser that still have money to apply to splits, using q. Reversals
+// and settlements that have been reversed have nothing to apply.
+func (r *SettlementRepository) GetCreditsTx(q database.Querier, teamID, fromUser, toUser uuid.UUID) ([]SettlementCredit, error) {
+	query := `
+		SELECT s.id, s.split_id,
+			s.amount - COALESCE((SELECT SUM(a.amount) FROM settlement_allocations a WHERE a.settlement_id = s.id), 0)
+		FROM settlements s
+		WHERE s.team_id = $1 AND s.from_user = $2 AND s.to_user = $3 AND s.status = 'confirmed'
+		AND s.reverses_id IS NULL
+		AND NOT EXISTS (SELECT 1 FROM settlements r WHERE r.reverses_id = s.id AND r.status = 'confirmed')
+		ORDER BY s.created_at, s.id
+	`
+	rows, err := q.Query(query, teamID, fromUser, toUser)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var credits []SettlementCredit
+	for rows.Next() {
+		var credit SettlementCredit
+		var splitID uuid.NullUUID
+		if err := rows.Scan(&credit.SettlementID, &splitID, &credit.Amount); err != nil {
+			return nil, err
+		}
+		if credit.Amount <= 0 {
+			continue
+		}
+		if splitID.Valid {
+			credit.SplitID = &splitID.UUID
+		}
+		credits = append(credits, credit)
+	}
+	return credits, nil
+}
+
+// GetAllocatedToTx sums what settlements to toUser have paid off on each of
+// the given splits, using q.
+func (r *SettlementRepository) GetAllocatedToTx(q database.Querier, splitIDs []uuid.UUID, toUser uuid.UUID) (map[uuid.UUID]models.Money, error) {
+	allocated := make(map[uuid.UUID]models.Money, len(splitIDs))
+	if len(splitIDs) == 0 {
+		return allocated, nil
+	}
+	query := `
+		SELECT a.split_id, SUM(a.amount)
+		FROM settlement_allocations a
+		INNER JOIN settlements s ON a.settlement_id = s.id
+		WHERE a.split_id = ANY($1::uuid[]) AND s.to_user = $2
+		GROUP BY a.split_id
+	`
+	rows, err := q.Query(query, pq.Array(uuidStrings(splitIDs)), toUser)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var settlements []models.Settlement
 	for rows.Next() {
-		settlement := models.Settlement{}
-		err := rows.Scan(&settlement.ID, &settlement.TeamID, &settlement.FromUser,
-			&settlement.ToUser, &settlement.Amount, &settlement.CreatedAt)
+		var splitID uuid.UUID
+		var amount models.Money
+		if err := rows.Scan(&splitID, &amount); err != nil {
+			return nil, err
+		}
+		allocated[splitID] = amount
+	}
+	return allocated, nil
+}
+
+// CreateAllocationTx applies amount of a settlement to a split using q.
+func (r *SettlementRepository) CreateAllocationTx(q database.Querier, allocation *models.SettlementAllocation) error {
+	query := `
+		INSERT INTO settlement_allocations (settlement_id, split_id, amount, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (settlement_id, split_id) DO UPDATE SET amount = settlement_allocations.amount + EXCLUDED.amount
+	`
+	_, err := q.Exec(query, allocation.SettlementID, allocation.SplitID, allocation.Amount, time.Now())
+	return err
+}
+
+// DeleteAllocationsBetweenTx takes back everything the settlements from
+// fromUser to toUser in the team paid off, using q.
+func (r *SettlementRepository) DeleteAllocationsBetweenTx(q database.Querier, teamID, fromUser, toUser uuid.UUID) error {
+	query := `
+		DELETE FROM settlement_allocations a
+		USING settlements s
+		WHERE a.settlement_id = s.id AND s.team_id = $1 AND s.from_user = $2 AND s.to_user = $3
+	`
+	_, err := q.Exec(query, teamID, fromUser, toUser)
+	return err
+}
+
+// DeleteAllocationsBetweenFromTx deletes what the settlements from fromUser
+// to toUser paid off on splits of expenses that come at or after the given
+// one in the order settlements pay them off, using q. Splits of expenses in
+// the trash count too.
+func (r *SettlementRepository) DeleteAllocationsBetweenFromTx(q database.Querier, teamID, fromUser, toUser uuid.UUID, from *models.Expense) error {
+	query := `
+		DELETE FROM settlement_allocations a
+		USING settlements s, expense_splits es, expenses e
+		WHERE a.settlement_id = s.id AND s.team_id = $1 AND s.from_user = $2 AND s.to_user = $3
+		AND a.split_id = es.id AND es.expense_id = e.id
+		AND (e.incurred_on, e.created_at) >= ($4, $5)
+	`
+	_, err := q.Exec(query, teamID, fromUser, toUser, from.IncurredOn, from.CreatedAt)
+	return err
+}
+
+// LockPairTx holds a lock on the settlements from fromUser to toUser in the
+// team until the transaction using q ends, so allocating them can't
+// interleave with another allocation between the same members.
+func (r *SettlementRepository) LockPairTx(q database.Querier, teamID, fromUser, toUser uuid.UUID) error {
+	_, err := q.Exec(`SELECT pg_advisory_xact_lock(hashtext($1::text || ':' || $2::text || ':' || $3::text))`,
+		teamID, fromUser, toUser)
+	return err
+}
+
+// GetAllocations lists the splits a settlement paid off.
+func (r *SettlementRepository) GetAllocations(settlementID uuid.UUID) ([]models.SettlementAllocation, error) {
+	query := `
+		SELECT a.settlement_id, a.split_id, es.expense_id, a.amount
+		FROM settlement_allocations a
+		INNER JOIN expense_splits es ON a.split_id = es.id
+		WHERE a.settlement_id = $1
+		ORDER BY a.created_at
+	`
+	rows, err := r.db.Query(query, settlementID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var allocations []models.SettlementAllocation
+	for rows.Next() {
+		var allocation models.SettlementAllocation
+		err := rows.Scan(&allocation.SettlementID, &allocation.SplitID, &allocation.ExpenseID, &allocation.Amount)
 		if err != nil {
 			return nil, err
 		}
-		settlements = append(settlements, settlement)
+		allocations = append(allocations, allocation)
 	}
-	return settlements, nil
+	return allocations, nil
+}
+
+// GetBySplitIDTx lists the settlements made for a split using q.
+func (r *SettlementRepository) GetBySplitIDTx(q database.Querier, splitID uuid.UUID) ([]models.Settlement, error) {
+	query := `
+		SELECT ` + settlementColumns + `
+		FROM settlements WHERE split_id = $1
+		ORDER BY created_at
+	`
+	return r.queryTx(q, query, splitID)
 }
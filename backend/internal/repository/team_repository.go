@@ -37,8 +37,9 @@ func (r *TeamRepository) Create(team *models.Team, creatorID uuid.UUID) error {
 	team.CreatedAt = time.Now()
 
 	// Create team
-	query := `INSERT INTO teams (id, name, created_by, created_at) VALUES ($1, $2, $3, $4)`
-	_, err = tx.Exec(query, team.ID, team.Name, team.CreatedBy, team.CreatedAt)
+	// A new team has no expenses, so its balances are complete from the start
+	query := `INSERT INTO teams (id, name, base_currency, balance_mode, created_by, created_at, balances_built_at) VALUES ($1, $2, $3, $4, $5, $6, $6)`
+	_, err = tx.Exec(query, team.ID, team.Name, team.BaseCurrency, team.BalanceMode, team.CreatedBy, team.CreatedAt)
 	if err != nil {
 		return err
 	}
@@ -50,13 +51,18 @@ func (r *TeamRepository) Create(team *models.Team, creatorID uuid.UUID) error {
 		return err
 	}
 
+	// Start with the default expense categories
+	if err := insertCategories(tx, team.ID, models.DefaultExpenseCategories); err != nil {
+		return err
+	}
+
 	return tx.Commit()
 }
 
 func (r *TeamRepository) GetByID(id uuid.UUID) (*models.Team, error) {
 	team := &models.Team{}
-	query := `SELECT id, name, created_by, created_at FROM teams WHERE id = $1`
-	err := r.db.QueryRow(query, id).Scan(&team.ID, &team.Name, &team.CreatedBy, &team.CreatedAt)
+	query := `SELECT id, name, base_currency, balance_mode, created_by, created_at FROM teams WHERE id = $1`
+	err := r.db.QueryRow(query, id).Scan(&team.ID, &team.Name, &team.BaseCurrency, &team.BalanceMode, &team.CreatedBy, &team.CreatedAt)
 	if err == sql.ErrNoRows {
 		return nil, ErrTeamNotFound
 	}
@@ -68,7 +74,7 @@ func (r *TeamRepository) GetByID(id uuid.UUID) (*models.Team, error) {
 
 func (r *TeamRepository) GetUserTeams(userID uuid.UUID) ([]*models.Team, error) {
 	query := `
-		SELECT t.id, t.name, t.created_by, t.created_at
+		SELECT t.id, t.name, t.base_currency, t.balance_mode, t.created_by, t.created_at
 		FROM teams t
 		INNER JOIN team_members tm ON t.id = tm.team_id
 		WHERE tm.user_id = $1
@@ -83,7 +89,7 @@ func (r *TeamRepository) GetUserTeams(userID uuid.UUID) ([]*models.Team, error)
 	var teams []*models.Team
 	for rows.Next() {
 		team := &models.Team{}
-		err := rows.Scan(&team.ID, &team.Name, &team.CreatedBy, &team.CreatedAt)
+		err := rows.Scan(&team.ID, &team.Name, &team.BaseCurrency, &team.BalanceMode, &team.CreatedBy, &team.CreatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -119,9 +125,16 @@ func (r *TeamRepository) GetTeamMembers(teamID uuid.UUID) ([]models.MemberDetail
 }
 
 func (r *TeamRepository) AddMember(teamID, userID uuid.UUID, role string) error {
+	return r.AddMemberTx(r.db, &models.TeamMember{TeamID: teamID, UserID: userID, Role: role})
+}
+
+// AddMemberTx adds the member to its team using q.
+func (r *TeamRepository) AddMemberTx(q database.Querier, member *models.TeamMember) error {
+	member.JoinedAt = time.Now()
+
 	// Check if already a member
 	var exists bool
-	err := r.db.QueryRow("SELECT EXISTS(SELECT 1 FROM team_members WHERE team_id = $1 AND user_id = $2)", teamID, userID).Scan(&exists)
+	err := q.QueryRow("SELECT EXISTS(SELECT 1 FROM team_members WHERE team_id = $1 AND user_id = $2)", member.TeamID, member.UserID).Scan(&exists)
 	if err != nil {
 		return err
 	}
@@ -130,14 +143,33 @@ func (r *TeamRepository) AddMember(teamID, userID uuid.UUID, role string) error
 	}
 
 	query := `INSERT INTO team_members (team_id, user_id, role, joined_at) VALUES ($1, $2, $3, $4)`
-	_, err = r.db.Exec(query, teamID, userID, role, time.Now())
+	_, err = q.Exec(query, member.TeamID, member.UserID, member.Role, member.JoinedAt)
 	return err
 }
 
+// GetMember returns the user's membership of the team.
+func (r *TeamRepository) GetMember(teamID, userID uuid.UUID) (*models.TeamMember, error) {
+	member := &models.TeamMember{}
+	query := `SELECT team_id, user_id, role, joined_at FROM team_members WHERE team_id = $1 AND user_id = $2`
+	err := r.db.QueryRow(query, teamID, userID).Scan(&member.TeamID, &member.UserID, &member.Role, &member.JoinedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotTeamMember
+	}
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
 func (r *TeamRepository) RemoveMember(teamID, userID uuid.UUID) error {
+	return r.RemoveMemberTx(r.db, teamID, userID)
+}
+
+// RemoveMemberTx removes the user from the team using q.
+func (r *TeamRepository) RemoveMemberTx(q database.Querier, teamID, userID uuid.UUID) error {
 	// Check if user is the owner
 	var createdBy uuid.UUID
-	err := r.db.QueryRow("SELECT created_by FROM teams WHERE id = $1", teamID).Scan(&createdBy)
+	err := q.QueryRow("SELECT created_by FROM teams WHERE id = $1", teamID).Scan(&createdBy)
 	if err != nil {
 		return err
 	}
@@ -146,7 +178,7 @@ func (r *TeamRepository) RemoveMember(teamID, userID uuid.UUID) error {
 	}
 
 	query := `DELETE FROM team_members WHERE team_id = $1 AND user_id = $2`
-	result, err := r.db.Exec(query, teamID, userID)
+	result, err := q.Exec(query, teamID, userID)
 	if err != nil {
 		return err
 	}
@@ -195,8 +227,13 @@ func (r *TeamRepository) UpdateMemberRole(teamID, userID uuid.UUID, role string)
 }
 
 func (r *TeamRepository) Update(team *models.Team) error {
-	query := `UPDATE teams SET name = $1 WHERE id = $2`
-	result, err := r.db.Exec(query, team.Name, team.ID)
+	return r.UpdateTx(r.db, team)
+}
+
+// UpdateTx writes the team's editable fields using q.
+func (r *TeamRepository) UpdateTx(q database.Querier, team *models.Team) error {
+	query := `UPDATE teams SET name = $1, balance_mode = $2 WHERE id = $3`
+	result, err := q.Exec(query, team.Name, team.BalanceMode, team.ID)
 	if err != nil {
 		return err
 	}
@@ -210,8 +247,17 @@ func (r *TeamRepository) Update(team *models.Team) error {
 	return nil
 }
 
+// Delete removes the team with everything in it, including the revisions
+// of its expenses, which are kept apart from them once purged.
 func (r *TeamRepository) Delete(teamID uuid.UUID) error {
-	query := `DELETE FROM teams WHERE id = $1`
+	query := `
+		WITH revisions AS (
+			DELETE FROM expense_revisions WHERE expense_id IN (
+				SELECT id FROM expenses WHERE team_id = $1
+				UNION ALL SELECT expense_id FROM purged_expenses WHERE team_id = $1
+			)
+		)
+		DELETE FROM teams WHERE id = $1`
 	result, err := r.db.Exec(query, teamID)
 	if err != nil {
 		return err
@@ -8,6 +8,7 @@ import (
 	"github.com/expensesplit/backend/internal/database"
 	"github.com/expensesplit/backend/internal/models"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 var (
@@ -64,6 +65,34 @@ func (r *UserRepository) GetByID(id uuid.UUID) (*models.User, error) {
 	return user, nil
 }
 
+// GetByIDs loads several users in one query, keyed by ID. Unknown IDs are
+// left out.
+func (r *UserRepository) GetByIDs(ids []uuid.UUID) (map[uuid.UUID]*models.User, error) {
+	users := make(map[uuid.UUID]*models.User, len(ids))
+	if len(ids) == 0 {
+		return users, nil
+	}
+	query := `
+		SELECT id, email, password_hash, name, created_at, updated_at
+		FROM users WHERE id = ANY($1::uuid[])
+	`
+	rows, err := r.db.Query(query, pq.Array(uuidStrings(ids)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user := &models.User{}
+		err := rows.Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Name, &user.CreatedAt, &user.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		users[user.ID] = user
+	}
+	return users, nil
+}
+
 func (r *UserRepository) GetByEmail(email string) (*models.User, error) {
 	user := &models.User{}
 	query := `
@@ -1,26 +1,33 @@
 package services
 
 import (
+	"github.com/expensesplit/backend/internal/database"
 	"github.com/expensesplit/backend/internal/models"
 	"github.com/expensesplit/backend/internal/repository"
 	"github.com/google/uuid"
 )
 
 type ApprovalService struct {
+	db           *database.DB
 	approvalRepo *repository.ApprovalRepository
 	expenseRepo  *repository.ExpenseRepository
 	teamRepo     *repository.TeamRepository
+	auditRepo    *repository.AuditRepository
 }
 
 func NewApprovalService(
+	db *database.DB,
 	approvalRepo *repository.ApprovalRepository,
 	expenseRepo *repository.ExpenseRepository,
 	teamRepo *repository.TeamRepository,
+	auditRepo *repository.AuditRepository,
 ) *ApprovalService {
 	return &ApprovalService{
+		db:           db,
 		approvalRepo: approvalRepo,
 		expenseRepo:  expenseRepo,
 		teamRepo:     teamRepo,
+		auditRepo:    auditRepo,
 	}
 }
 
@@ -35,10 +42,41 @@ func (s *ApprovalService) CreateApproval(expenseID uuid.UUID) (*models.Approval,
 	return approval, nil
 }
 
-func (s *ApprovalService) UpdateApprovalStatus(approvalID, userID uuid.UUID, status models.ApprovalStatus, comment string) error {
-	return s.approvalRepo.UpdateStatus(approvalID, status, userID, comment)
+// UpdateApprovalStatus records userID's decision on an approval of one of
+// the team's expenses.
+func (s *ApprovalService) UpdateApprovalStatus(teamID, approvalID, userID uuid.UUID, status models.ApprovalStatus, comment string, meta models.RequestMeta) error {
+	before, err := s.approvalRepo.GetByID(approvalID)
+	if err != nil {
+		return err
+	}
+	expense, err := s.expenseRepo.GetByID(before.ExpenseID)
+	if err == repository.ErrExpenseNotFound || (err == nil && expense.TeamID != teamID) {
+		return repository.ErrApprovalNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.db.WithTx(func(tx *database.Tx) error {
+		if err := s.approvalRepo.UpdateStatusTx(tx, approvalID, status, userID, comment); err != nil {
+			return err
+		}
+		after, err := s.approvalRepo.GetByIDTx(tx, approvalID)
+		if err != nil {
+			return err
+		}
+		event := models.AuditEvent{
+			TeamID:      teamID,
+			ActorID:     userID,
+			Action:      models.AuditApprovalUpdated,
+			EntityType:  models.AuditEntityApproval,
+			EntityID:    approvalID,
+			RequestMeta: meta,
+		}
+		return recordAudit(s.auditRepo, tx, event, before, after)
+	})
 }
 
-func (s *ApprovalService) GetTeamApprovals(teamID uuid.UUID) ([]models.Approval, error) {
-	return s.approvalRepo.GetAllByTeamID(teamID)
+func (s *ApprovalService) GetTeamApprovals(teamID uuid.UUID, page repository.Page) ([]models.Approval, int64, string, error) {
+	return s.approvalRepo.GetAllByTeamID(teamID, page)
 }
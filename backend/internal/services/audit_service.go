@@ -0,0 +1,40 @@
+package services
+
+import (
+	"encoding/json"
+
+	"github.com/expensesplit/backend/internal/database"
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/expensesplit/backend/internal/repository"
+	"github.com/google/uuid"
+)
+
+type AuditService struct {
+	auditRepo *repository.AuditRepository
+}
+
+func NewAuditService(auditRepo *repository.AuditRepository) *AuditService {
+	return &AuditService{auditRepo: auditRepo}
+}
+
+func (s *AuditService) GetTeamAudit(teamID uuid.UUID, filter repository.AuditFilter, page repository.Page) ([]models.AuditEvent, int64, string, error) {
+	return s.auditRepo.GetByTeamID(teamID, filter, page)
+}
+
+// recordAudit appends event to the audit log using q, which must be the
+// transaction making the change so that the change and its record commit
+// together. before and after are stored as JSON; nil leaves a state empty.
+func recordAudit(auditRepo *repository.AuditRepository, q database.Querier, event models.AuditEvent, before, after interface{}) error {
+	var err error
+	if before != nil {
+		if event.Before, err = json.Marshal(before); err != nil {
+			return err
+		}
+	}
+	if after != nil {
+		if event.After, err = json.Marshal(after); err != nil {
+			return err
+		}
+	}
+	return auditRepo.CreateTx(q, &event)
+}
@@ -1,140 +1,201 @@
 package services
 
 import (
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/expensesplit/backend/internal/database"
 	"github.com/expensesplit/backend/internal/models"
 	"github.com/expensesplit/backend/internal/repository"
 	"github.com/google/uuid"
 )
 
+var (
+	ErrDisputeReasonRequired  = errors.New("a reason is required to dispute a settlement")
+	ErrSettlementResolved     = errors.New("settlement is already confirmed or cancelled")
+	ErrSettlementDisputed     = errors.New("settlement is already disputed")
+	ErrSettlementNotConfirmed = errors.New("only confirmed settlements can be reversed, cancel a pending one instead")
+	ErrSettlementIsReversal   = errors.New("a reversal can't itself be reversed")
+)
+
 type BalanceService struct {
+	db             *database.DB
 	expenseRepo    *repository.ExpenseRepository
 	teamRepo       *repository.TeamRepository
 	userRepo       *repository.UserRepository
 	settlementRepo *repository.SettlementRepository
+	balanceRepo    *repository.BalanceRepository
+	snapshotRepo   *repository.BalanceSnapshotRepository
+	revisionRepo   *repository.ExpenseRevisionRepository
+	auditRepo      *repository.AuditRepository
+	allocator      splitAllocator
 }
 
 func NewBalanceService(
+	db *database.DB,
 	expenseRepo *repository.ExpenseRepository,
 	teamRepo *repository.TeamRepository,
 	userRepo *repository.UserRepository,
 	settlementRepo *repository.SettlementRepository,
+	balanceRepo *repository.BalanceRepository,
+	snapshotRepo *repository.BalanceSnapshotRepository,
+	revisionRepo *repository.ExpenseRevisionRepository,
+	auditRepo *repository.AuditRepository,
 ) *BalanceService {
 	return &BalanceService{
+		db:             db,
 		expenseRepo:    expenseRepo,
 		teamRepo:       teamRepo,
 		userRepo:       userRepo,
 		settlementRepo: settlementRepo,
+		balanceRepo:    balanceRepo,
+		snapshotRepo:   snapshotRepo,
+		revisionRepo:   revisionRepo,
+		auditRepo:      auditRepo,
+		allocator:      splitAllocator{expenseRepo: expenseRepo, settlementRepo: settlementRepo},
 	}
 }
 
-// CalculateBalances calculates who owes whom in a team
-func (s *BalanceService) CalculateBalances(teamID uuid.UUID) (*models.TeamBalanceSummary, error) {
+// CalculateBalances calculates who owes whom in a team. With asOf set, it
+// calculates who owed whom at that moment instead: expenses incurred on or
+// before its day count as they stood then, settlements confirmed by then
+// count, and settlements recorded but not yet resolved by then are pending.
+func (s *BalanceService) CalculateBalances(teamID uuid.UUID, asOf *time.Time) (*models.TeamBalanceSummary, error) {
 	team, err := s.teamRepo.GetByID(teamID)
 	if err != nil {
 		return nil, err
 	}
 
-	members, err := s.teamRepo.GetTeamMembers(teamID)
+	if asOf == nil {
+		// Get the stored balances between users
+		stored, err := s.balanceRepo.GetByTeamID(teamID)
+		if err != nil {
+			return nil, err
+		}
+		pending, err := s.settlementRepo.GetByStatus(teamID, models.SettlementStatusPending)
+		if err != nil {
+			return nil, err
+		}
+		return s.summarizeBalances(team, stored, pending)
+	}
+
+	settlements, err := s.settlementRepo.GetByTeamID(teamID)
 	if err != nil {
 		return nil, err
 	}
-
-	// Get all expenses for the team
-	expenses, _, err := s.expenseRepo.GetByTeamID(teamID, 10000, 0) // Get all expenses
+	computed, err := s.computeBalances(teamID, settlements, asOf)
 	if err != nil {
 		return nil, err
 	}
+	var pending []models.Settlement
+	for _, settlement := range settlements {
+		if pendingAt(settlement, *asOf) {
+			pending = append(pending, settlement)
+		}
+	}
+	summary, err := s.summarizeBalances(team, computed.balances(), pending)
+	if err != nil {
+		return nil, err
+	}
+	summary.AsOf = asOf
+	return summary, nil
+}
 
-	// Get all settlements
-	settlements, err := s.settlementRepo.GetByTeamID(teamID)
+// summarizeBalances builds the balance summary of a team from what its
+// members owe each other.
+func (s *BalanceService) summarizeBalances(team *models.Team, stored []models.Balance, pending []models.Settlement) (*models.TeamBalanceSummary, error) {
+	members, err := s.teamRepo.GetTeamMembers(team.ID)
 	if err != nil {
 		return nil, err
 	}
 
-	// Calculate net balances between users
 	// balanceMap[fromUser][toUser] = amount (positive means fromUser owes toUser)
-	balanceMap := make(map[uuid.UUID]map[uuid.UUID]float64)
+	balanceMap := make(map[uuid.UUID]map[uuid.UUID]models.Money)
 
 	// Initialize balance map for all members
 	for _, member := range members {
-		balanceMap[member.UserID] = make(map[uuid.UUID]float64)
+		balanceMap[member.UserID] = make(map[uuid.UUID]models.Money)
 	}
-
-	// Process expenses
-	for _, expense := range expenses {
-		splits, err := s.expenseRepo.GetSplitsByExpenseID(expense.ID)
-		if err != nil {
-			return nil, err
-		}
-
-		for _, split := range splits {
-			if split.UserID != expense.PaidBy && !split.IsSettled {
-				// This user owes the payer
-				if balanceMap[split.UserID] == nil {
-					balanceMap[split.UserID] = make(map[uuid.UUID]float64)
-				}
-				balanceMap[split.UserID][expense.PaidBy] += split.Amount
-			}
+	for _, balance := range stored {
+		if balanceMap[balance.FromUser] == nil {
+			balanceMap[balance.FromUser] = make(map[uuid.UUID]models.Money)
 		}
+		balanceMap[balance.FromUser][balance.ToUser] = balance.Amount
 	}
 
-	// Process settlements (reduce balances)
-	for _, settlement := range settlements {
-		if balanceMap[settlement.FromUser] != nil {
-			balanceMap[settlement.FromUser][settlement.ToUser] -= settlement.Amount
+	pairwise, transfers := s.suggestTransfers(team.BalanceMode, balanceMap)
+
+	// Load members and former members who still owe or are owed money
+	userIDs := make([]uuid.UUID, 0, len(balanceMap))
+	for userID := range balanceMap {
+		userIDs = append(userIDs, userID)
+	}
+	for _, balance := range stored {
+		userIDs = append(userIDs, balance.ToUser)
+	}
+	for _, settlement := range pending {
+		userIDs = append(userIDs, settlement.FromUser, settlement.ToUser)
+	}
+	users, err := s.userRepo.GetByIDs(userIDs)
+	if err != nil {
+		return nil, err
+	}
+	lookup := func(userID uuid.UUID) (models.UserResponse, bool) {
+		user, ok := users[userID]
+		if !ok {
+			return models.UserResponse{}, false
 		}
+		return user.ToResponse(), true
 	}
 
-	// Simplify balances (net out mutual debts)
-	simplifiedBalances := s.simplifyBalances(balanceMap)
-
 	// Build response
-	var balances []models.BalanceResponse
 	memberSummaries := make(map[uuid.UUID]*models.UserBalanceSummary)
 
 	// Initialize member summaries
 	for _, member := range members {
-		user, err := s.userRepo.GetByID(member.UserID)
-		if err != nil {
+		user, ok := lookup(member.UserID)
+		if !ok {
 			continue
 		}
 		memberSummaries[member.UserID] = &models.UserBalanceSummary{
-			User:       user.ToResponse(),
+			User:       user,
 			TotalOwed:  0,
 			TotalOwing: 0,
 			NetBalance: 0,
 		}
 	}
-
-	// Build balance responses and update summaries
-	for fromUserID, toUsers := range simplifiedBalances {
-		for toUserID, amount := range toUsers {
-			if amount > 0.01 { // Only include non-zero balances
-				fromUser, err := s.userRepo.GetByID(fromUserID)
-				if err != nil {
-					continue
-				}
-				toUser, err := s.userRepo.GetByID(toUserID)
-				if err != nil {
-					continue
-				}
-
-				balances = append(balances, models.BalanceResponse{
-					FromUser: fromUser.ToResponse(),
-					ToUser:   toUser.ToResponse(),
-					Amount:   amount,
-				})
-
-				// Update summaries
-				if summary, ok := memberSummaries[fromUserID]; ok {
-					summary.TotalOwed += amount
-					summary.NetBalance -= amount
-				}
-				if summary, ok := memberSummaries[toUserID]; ok {
-					summary.TotalOwing += amount
-					summary.NetBalance += amount
-				}
+	responses := func(transfers []transfer) []models.BalanceResponse {
+		var balances []models.BalanceResponse
+		for _, t := range transfers {
+			fromUser, ok := lookup(t.from)
+			if !ok {
+				continue
+			}
+			toUser, ok := lookup(t.to)
+			if !ok {
+				continue
 			}
+			balances = append(balances, models.BalanceResponse{
+				FromUser: fromUser,
+				ToUser:   toUser,
+				Amount:   t.amount,
+			})
+		}
+		return balances
+	}
+
+	// Update summaries from what each member is asked to pay or receive
+	for _, t := range transfers {
+		if summary, ok := memberSummaries[t.from]; ok {
+			summary.TotalOwed += t.amount
+			summary.NetBalance -= t.amount
+		}
+		if summary, ok := memberSummaries[t.to]; ok {
+			summary.TotalOwing += t.amount
+			summary.NetBalance += t.amount
 		}
 	}
 
@@ -144,63 +205,649 @@ func (s *BalanceService) CalculateBalances(teamID uuid.UUID) (*models.TeamBalanc
 		memberSummarySlice = append(memberSummarySlice, *summary)
 	}
 
+	pendingSettlements := []models.PendingSettlement{}
+	for _, settlement := range pending {
+		fromUser, ok := lookup(settlement.FromUser)
+		if !ok {
+			continue
+		}
+		toUser, ok := lookup(settlement.ToUser)
+		if !ok {
+			continue
+		}
+		pendingSettlements = append(pendingSettlements, models.PendingSettlement{
+			ID:        settlement.ID,
+			FromUser:  fromUser,
+			ToUser:    toUser,
+			Amount:    settlement.Amount,
+			CreatedAt: settlement.CreatedAt,
+		})
+	}
+
 	return &models.TeamBalanceSummary{
-		TeamID:   teamID,
-		TeamName: team.Name,
-		Balances: balances,
-		Members:  memberSummarySlice,
+		TeamID:      team.ID,
+		TeamName:    team.Name,
+		Currency:    team.BaseCurrency,
+		BalanceMode: team.BalanceMode,
+		Balances:    responses(pairwise),
+		Transfers:   responses(transfers),
+		Members:     memberSummarySlice,
+
+		PendingSettlements: pendingSettlements,
 	}, nil
 }
 
-// simplifyBalances nets out mutual debts
-func (s *BalanceService) simplifyBalances(balanceMap map[uuid.UUID]map[uuid.UUID]float64) map[uuid.UUID]map[uuid.UUID]float64 {
-	simplified := make(map[uuid.UUID]map[uuid.UUID]float64)
+// suggestTransfers returns the debts between each pair of members, with
+// mutual debts netted out, and the transfers suggested to settle them.
+// Suggested transfers settle the debts directly, or settle everyone's net
+// position with as few transfers as practical in simplified mode. Both are
+// worked out from the same netted debts, so they leave every member with
+// the same net position.
+func (s *BalanceService) suggestTransfers(mode models.BalanceMode, balanceMap map[uuid.UUID]map[uuid.UUID]models.Money) (pairwise, transfers []transfer) {
+	debts := s.simplifyBalances(balanceMap)
+	pairwise = debtsToTransfers(debts)
+	if mode == models.BalanceModeSimplified {
+		return pairwise, minimizeTransfers(netPositions(debts))
+	}
+	return pairwise, pairwise
+}
 
+// simplifyBalances nets out mutual debts. A negative balance, left by a
+// member paying back more than they owed, counts as a debt the other way.
+func (s *BalanceService) simplifyBalances(balanceMap map[uuid.UUID]map[uuid.UUID]models.Money) map[uuid.UUID]map[uuid.UUID]models.Money {
+	net := make(balanceChanges)
 	for fromUser, toUsers := range balanceMap {
 		for toUser, amount := range toUsers {
-			if amount <= 0 {
+			if fromUser == toUser {
 				continue
 			}
+			net[balanceKey{from: fromUser, to: toUser}] += amount
+			net[balanceKey{from: toUser, to: fromUser}] -= amount
+		}
+	}
 
-			// Check if there's a reverse debt
-			reverseAmount := float64(0)
-			if balanceMap[toUser] != nil {
-				reverseAmount = balanceMap[toUser][fromUser]
+	simplified := make(map[uuid.UUID]map[uuid.UUID]models.Money)
+	for key, amount := range net {
+		if amount <= 0 {
+			continue
+		}
+		if simplified[key.from] == nil {
+			simplified[key.from] = make(map[uuid.UUID]models.Money)
+		}
+		simplified[key.from][key.to] = amount
+	}
+	return simplified
+}
+
+// transfer is a payment of amount from one member to another.
+type transfer struct {
+	from, to uuid.UUID
+	amount   models.Money
+}
+
+func debtsToTransfers(debts map[uuid.UUID]map[uuid.UUID]models.Money) []transfer {
+	var transfers []transfer
+	for fromUser, toUsers := range debts {
+		for toUser, amount := range toUsers {
+			if amount > 0 { // Only include non-zero balances
+				transfers = append(transfers, transfer{from: fromUser, to: toUser, amount: amount})
 			}
+		}
+	}
+	return transfers
+}
 
-			netAmount := amount - reverseAmount
-			if netAmount > 0 {
-				if simplified[fromUser] == nil {
-					simplified[fromUser] = make(map[uuid.UUID]float64)
-				}
-				simplified[fromUser][toUser] = netAmount
-			} else if netAmount < 0 {
-				if simplified[toUser] == nil {
-					simplified[toUser] = make(map[uuid.UUID]float64)
-				}
-				simplified[toUser][fromUser] = -netAmount
+// netPositions returns what each member is owed in total minus what they
+// owe; positive for creditors, negative for debtors.
+func netPositions(balanceMap map[uuid.UUID]map[uuid.UUID]models.Money) map[uuid.UUID]models.Money {
+	net := make(map[uuid.UUID]models.Money)
+	for fromUser, toUsers := range balanceMap {
+		for toUser, amount := range toUsers {
+			net[fromUser] -= amount
+			net[toUser] += amount
+		}
+	}
+	return net
+}
+
+// minimizeTransfers settles net positions greedily: the largest debtor pays
+// the largest creditor as much as either needs, until everyone is even. Each
+// transfer evens out at least one member, so n members need at most n-1
+// transfers. Ties are broken by user ID to keep suggestions stable.
+func minimizeTransfers(net map[uuid.UUID]models.Money) []transfer {
+	type position struct {
+		userID uuid.UUID
+		amount models.Money
+	}
+	var creditors, debtors []position
+	for userID, amount := range net {
+		if amount > 0 {
+			creditors = append(creditors, position{userID, amount})
+		} else if amount < 0 {
+			debtors = append(debtors, position{userID, -amount})
+		}
+	}
+	largestFirst := func(positions []position) {
+		sort.Slice(positions, func(i, j int) bool {
+			if positions[i].amount != positions[j].amount {
+				return positions[i].amount > positions[j].amount
 			}
+			return positions[i].userID.String() < positions[j].userID.String()
+		})
+	}
+
+	var transfers []transfer
+	for len(creditors) > 0 && len(debtors) > 0 {
+		largestFirst(creditors)
+		largestFirst(debtors)
+		creditor, debtor := &creditors[0], &debtors[0]
+
+		amount := creditor.amount
+		if debtor.amount < amount {
+			amount = debtor.amount
+		}
+		transfers = append(transfers, transfer{from: debtor.userID, to: creditor.userID, amount: amount})
+
+		creditor.amount -= amount
+		debtor.amount -= amount
+		if creditor.amount == 0 {
+			creditors = creditors[1:]
+		}
+		if debtor.amount == 0 {
+			debtors = debtors[1:]
 		}
 	}
+	return transfers
+}
 
-	return simplified
+// balanceKey identifies what one member owes another.
+type balanceKey struct {
+	from, to uuid.UUID
+}
+
+// balanceChanges collects changes to a team's balances so that they can be
+// written together.
+type balanceChanges map[balanceKey]models.Money
+
+// addExpense adds what the splits of an expense owe its payers, or removes
+// it when sign is -1. Each share is owed to the payers in proportion to
+// what they paid. Settled splits count too: the settlements that paid them
+// off reduce the balances themselves.
+func (c balanceChanges) addExpense(payers []models.ExpensePayer, splits []models.ExpenseSplit, sign models.Money) error {
+	weights := make([]int64, len(payers))
+	for i, payer := range payers {
+		weights[i] = payer.Amount.Cents()
+	}
+
+	for _, split := range splits {
+		owed, err := split.Amount.Allocate(weights)
+		if err != nil {
+			return err
+		}
+		for i, payer := range payers {
+			if payer.UserID == split.UserID || owed[i] == 0 {
+				continue
+			}
+			// This user owes the payer
+			c[balanceKey{from: split.UserID, to: payer.UserID}] += sign * owed[i]
+		}
+	}
+	return nil
+}
+
+// addSettlement reduces what the payer of a settlement owes its receiver.
+func (c balanceChanges) addSettlement(settlement models.Settlement) {
+	c[balanceKey{from: settlement.FromUser, to: settlement.ToUser}] -= settlement.Amount
+}
+
+// balances lists the changes that aren't zero as balances.
+func (c balanceChanges) balances() []models.Balance {
+	var balances []models.Balance
+	for key, amount := range c {
+		if amount != 0 {
+			balances = append(balances, models.Balance{FromUser: key.from, ToUser: key.to, Amount: amount})
+		}
+	}
+	return balances
+}
+
+// confirmedAt returns when a confirmed settlement was confirmed. Settlements
+// from before confirmation were confirmed when they were recorded.
+func confirmedAt(settlement models.Settlement) time.Time {
+	if settlement.ResolvedAt != nil {
+		return *settlement.ResolvedAt
+	}
+	return settlement.CreatedAt
+}
+
+// pendingAt reports whether a settlement had been recorded but not yet
+// confirmed, disputed or cancelled at asOf.
+func pendingAt(settlement models.Settlement, asOf time.Time) bool {
+	if settlement.CreatedAt.After(asOf) || settlement.RecordedBy == nil {
+		return false
+	}
+	return settlement.ResolvedAt == nil || settlement.ResolvedAt.After(asOf)
+}
+
+// computeBalances works out the team's balances from all of its expenses
+// and the given settlements of the team. With asOf set, expenses count as
+// they stood then (see expensesAsOf) and only settlements confirmed by
+// then count.
+func (s *BalanceService) computeBalances(teamID uuid.UUID, settlements []models.Settlement, asOf *time.Time) (balanceChanges, error) {
+	var expenses []models.ExpenseSnapshot
+	var err error
+	if asOf != nil {
+		expenses, err = s.expensesAsOf(teamID, *asOf)
+	} else {
+		expenses, err = s.currentExpensesTx(s.db, teamID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tallyBalances(expenses, settlements, asOf)
+}
+
+// tallyBalances adds up what the expenses and the confirmed settlements
+// leave each member owing, counting only settlements confirmed by asOf if
+// it is set.
+func tallyBalances(expenses []models.ExpenseSnapshot, settlements []models.Settlement, asOf *time.Time) (balanceChanges, error) {
+	computed := make(balanceChanges)
+	for _, expense := range expenses {
+		if err := computed.addExpense(expense.Payers, expense.Splits, 1); err != nil {
+			return nil, err
+		}
+	}
+	for _, settlement := range settlements {
+		if settlement.Status != models.SettlementStatusConfirmed {
+			continue
+		}
+		if asOf != nil && confirmedAt(settlement).After(*asOf) {
+			continue
+		}
+		computed.addSettlement(settlement)
+	}
+	return computed, nil
+}
+
+// currentExpensesTx loads the team's expenses outside the trash with their
+// payers and splits using q.
+func (s *BalanceService) currentExpensesTx(q database.Querier, teamID uuid.UUID) ([]models.ExpenseSnapshot, error) {
+	expenses, err := s.expenseRepo.GetAllByTeamIDTx(q, teamID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uuid.UUID, len(expenses))
+	for i, expense := range expenses {
+		ids[i] = expense.ID
+	}
+	payers, err := s.expenseRepo.GetPayersByExpenseIDsTx(q, ids)
+	if err != nil {
+		return nil, err
+	}
+	splits, err := s.expenseRepo.GetSplitsByExpenseIDsTx(q, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]models.ExpenseSnapshot, len(expenses))
+	for i, expense := range expenses {
+		states[i] = models.ExpenseSnapshot{Expense: *expense, Payers: payers[expense.ID], Splits: splits[expense.ID]}
+	}
+	return states, nil
+}
+
+// applyTx writes the changes to the team's balances using q. Balances are
+// written in a fixed order so concurrent transactions can't deadlock, under
+// the team's write lock so that they can't interleave with a rebuild.
+func (c balanceChanges) applyTx(balanceRepo *repository.BalanceRepository, q database.Querier, teamID uuid.UUID) error {
+	if err := balanceRepo.LockForWriteTx(q, teamID); err != nil {
+		return err
+	}
+	keys := make([]balanceKey, 0, len(c))
+	for key, amount := range c {
+		if amount != 0 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].from != keys[j].from {
+			return keys[i].from.String() < keys[j].from.String()
+		}
+		return keys[i].to.String() < keys[j].to.String()
+	})
+
+	for _, key := range keys {
+		if err := balanceRepo.AddTx(q, teamID, key.from, key.to, c[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BalanceDrift is a stored balance that differs from the one computed from
+// the team's expenses and settlements.
+type BalanceDrift struct {
+	TeamID   uuid.UUID
+	FromUser uuid.UUID
+	ToUser   uuid.UUID
+	Stored   models.Money
+	Computed models.Money
+}
+
+// RebuildBalances recomputes the team's balances from all of its expenses
+// and settlements, replaces the stored ones and returns where they differed.
+// It reads and replaces them in one transaction holding the team's rebuild
+// lock, so no change to the balances can land in between.
+func (s *BalanceService) RebuildBalances(teamID uuid.UUID) ([]BalanceDrift, error) {
+	var drift []BalanceDrift
+	err := s.db.WithTx(func(tx *database.Tx) error {
+		if err := s.balanceRepo.LockForRebuildTx(tx, teamID); err != nil {
+			return err
+		}
+		settlements, err := s.settlementRepo.GetByTeamIDTx(tx, teamID)
+		if err != nil {
+			return err
+		}
+		expenses, err := s.currentExpensesTx(tx, teamID)
+		if err != nil {
+			return err
+		}
+		computed, err := tallyBalances(expenses, settlements, nil)
+		if err != nil {
+			return err
+		}
+
+		stored, err := s.balanceRepo.GetByTeamIDTx(tx, teamID)
+		if err != nil {
+			return err
+		}
+		seen := make(map[balanceKey]bool)
+		for _, balance := range stored {
+			key := balanceKey{from: balance.FromUser, to: balance.ToUser}
+			seen[key] = true
+			if computed[key] != balance.Amount {
+				drift = append(drift, BalanceDrift{TeamID: teamID, FromUser: key.from, ToUser: key.to,
+					Stored: balance.Amount, Computed: computed[key]})
+			}
+		}
+		balances := computed.balances()
+		for _, balance := range balances {
+			if !seen[balanceKey{from: balance.FromUser, to: balance.ToUser}] {
+				drift = append(drift, BalanceDrift{TeamID: teamID, FromUser: balance.FromUser, ToUser: balance.ToUser,
+					Computed: balance.Amount})
+			}
+		}
+
+		return s.balanceRepo.ReplaceTx(tx, teamID, balances)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return drift, nil
+}
+
+// BuildMissingBalances builds the balances of teams that existed before
+// balances were stored.
+func (s *BalanceService) BuildMissingBalances() error {
+	teamIDs, err := s.balanceRepo.GetUnbuiltTeamIDs()
+	if err != nil {
+		return err
+	}
+	for _, teamID := range teamIDs {
+		if _, err := s.RebuildBalances(teamID); err != nil {
+			return err
+		}
+	}
+	if len(teamIDs) > 0 {
+		log.Printf("Built balances of %d teams", len(teamIDs))
+	}
+	return nil
 }
 
-// RecordSettlement records a settlement between two users
-func (s *BalanceService) RecordSettlement(teamID uuid.UUID, req *models.SettlementRequest) error {
+// RecordSettlement records a settlement between two users. A payment
+// recorded by its recipient is confirmed right away; one recorded by anyone
+// else waits for the recipient to confirm it.
+func (s *BalanceService) RecordSettlement(teamID uuid.UUID, req *models.SettlementRequest, actorID uuid.UUID, meta models.RequestMeta) (*models.Settlement, error) {
 	settlement := &models.Settlement{
 		TeamID:   teamID,
 		FromUser: req.FromUser,
 		ToUser:   req.ToUser,
 		Amount:   req.Amount,
 	}
+	err := s.db.WithTx(func(tx *database.Tx) error {
+		return s.recordSettlementTx(tx, settlement, actorID, models.AuditSettlementRecorded, meta)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return settlement, nil
+}
+
+// recordSettlementTx inserts settlement as recorded by actorID using q,
+// confirming it right away if actorID is its recipient.
+func (s *BalanceService) recordSettlementTx(q database.Querier, settlement *models.Settlement, actorID uuid.UUID, action models.AuditAction, meta models.RequestMeta) error {
+	settlement.Status = models.SettlementStatusPending
+	settlement.RecordedBy = &actorID
+	if actorID == settlement.ToUser {
+		now := time.Now()
+		settlement.Status = models.SettlementStatusConfirmed
+		settlement.ResolvedAt = &now
+	}
+
+	if err := s.settlementRepo.CreateTx(q, settlement); err != nil {
+		return err
+	}
+	if settlement.Status == models.SettlementStatusConfirmed {
+		if err := s.applySettlementTx(q, settlement); err != nil {
+			return err
+		}
+	}
+	event := models.AuditEvent{
+		TeamID:      settlement.TeamID,
+		ActorID:     actorID,
+		Action:      action,
+		EntityType:  models.AuditEntitySettlement,
+		EntityID:    settlement.ID,
+		RequestMeta: meta,
+	}
+	return recordAudit(s.auditRepo, q, event, nil, settlement)
+}
+
+// GetSettlement gets a settlement of the team.
+func (s *BalanceService) GetSettlement(teamID, settlementID uuid.UUID) (*models.Settlement, error) {
+	settlement, err := s.settlementRepo.GetByID(settlementID)
+	if err != nil {
+		return nil, err
+	}
+	if settlement.TeamID != teamID {
+		return nil, repository.ErrSettlementNotFound
+	}
+	if settlement.Allocations, err = s.settlementRepo.GetAllocations(settlementID); err != nil {
+		return nil, err
+	}
+	return settlement, nil
+}
+
+// ReverseSettlement undoes a confirmed settlement by recording the same
+// amount paid back the other way, so the original stays in the history.
+// Either party can reverse it. Like any payment, the reversal is confirmed
+// right away when the original payer records it and otherwise waits for
+// them to confirm it.
+func (s *BalanceService) ReverseSettlement(teamID, settlementID, actorID uuid.UUID, meta models.RequestMeta) (*models.Settlement, error) {
+	original, err := s.reversibleSettlement(teamID, settlementID, actorID)
+	if err != nil {
+		return nil, err
+	}
+
+	var reversal *models.Settlement
+	err = s.db.WithTx(func(tx *database.Tx) error {
+		reversal, err = s.reverseSettlementTx(tx, original, actorID, meta)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reversal, nil
+}
+
+// CorrectSettlement replaces a confirmed settlement entered with a mistake:
+// the original is reversed and the corrected payment recorded in its place,
+// in one go.
+func (s *BalanceService) CorrectSettlement(teamID, settlementID uuid.UUID, req *models.SettlementRequest, actorID uuid.UUID, meta models.RequestMeta) (*models.SettlementCorrection, error) {
+	original, err := s.reversibleSettlement(teamID, settlementID, actorID)
+	if err != nil {
+		return nil, err
+	}
+
+	correction := &models.SettlementCorrection{
+		Settlement: &models.Settlement{
+			TeamID:   teamID,
+			FromUser: req.FromUser,
+			ToUser:   req.ToUser,
+			Amount:   req.Amount,
+		},
+	}
+	err = s.db.WithTx(func(tx *database.Tx) error {
+		if correction.Reversal, err = s.reverseSettlementTx(tx, original, actorID, meta); err != nil {
+			return err
+		}
+		return s.recordSettlementTx(tx, correction.Settlement, actorID, models.AuditSettlementRecorded, meta)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return correction, nil
+}
+
+// reversibleSettlement gets a settlement of the team that actorID may
+// reverse.
+func (s *BalanceService) reversibleSettlement(teamID, settlementID, actorID uuid.UUID) (*models.Settlement, error) {
+	settlement, err := s.GetSettlement(teamID, settlementID)
+	if err != nil {
+		return nil, err
+	}
+	if actorID != settlement.FromUser && actorID != settlement.ToUser {
+		return nil, ErrNotAuthorized
+	}
+	switch {
+	case settlement.Status != models.SettlementStatusConfirmed:
+		return nil, ErrSettlementNotConfirmed
+	case settlement.ReversesID != nil:
+		return nil, ErrSettlementIsReversal
+	case settlement.ReversedBy != nil:
+		return nil, repository.ErrSettlementReversed
+	}
+	return settlement, nil
+}
+
+func (s *BalanceService) reverseSettlementTx(q database.Querier, original *models.Settlement, actorID uuid.UUID, meta models.RequestMeta) (*models.Settlement, error) {
+	reversal := &models.Settlement{
+		TeamID:     original.TeamID,
+		FromUser:   original.ToUser,
+		ToUser:     original.FromUser,
+		Amount:     original.Amount,
+		ReversesID: &original.ID,
+	}
+	if err := s.recordSettlementTx(q, reversal, actorID, models.AuditSettlementReversed, meta); err != nil {
+		return nil, err
+	}
+	return reversal, nil
+}
+
+// ConfirmSettlement is the recipient agreeing that they received a payment,
+// which then counts towards the balances. Disputed payments can still be
+// confirmed.
+func (s *BalanceService) ConfirmSettlement(teamID, settlementID, actorID uuid.UUID, meta models.RequestMeta) (*models.Settlement, error) {
+	return s.changeSettlementStatus(teamID, settlementID, actorID, models.SettlementStatusConfirmed, "", meta)
+}
+
+// DisputeSettlement is the recipient saying they did not receive a payment.
+func (s *BalanceService) DisputeSettlement(teamID, settlementID, actorID uuid.UUID, reason string, meta models.RequestMeta) (*models.Settlement, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrDisputeReasonRequired
+	}
+	return s.changeSettlementStatus(teamID, settlementID, actorID, models.SettlementStatusDisputed, reason, meta)
+}
+
+// CancelSettlement withdraws a payment that has not been confirmed. Only the
+// payer can cancel it.
+func (s *BalanceService) CancelSettlement(teamID, settlementID, actorID uuid.UUID, meta models.RequestMeta) (*models.Settlement, error) {
+	return s.changeSettlementStatus(teamID, settlementID, actorID, models.SettlementStatusCancelled, "", meta)
+}
+
+func (s *BalanceService) changeSettlementStatus(teamID, settlementID, actorID uuid.UUID, status models.SettlementStatus, reason string, meta models.RequestMeta) (*models.Settlement, error) {
+	before, err := s.settlementRepo.GetByID(settlementID)
+	if err != nil {
+		return nil, err
+	}
+	if before.TeamID != teamID {
+		return nil, repository.ErrSettlementNotFound
+	}
+
+	// The recipient confirms or disputes, the payer cancels
+	party := before.ToUser
+	if status == models.SettlementStatusCancelled {
+		party = before.FromUser
+	}
+	if actorID != party {
+		return nil, ErrNotAuthorized
+	}
+
+	switch before.Status {
+	case models.SettlementStatusConfirmed, models.SettlementStatusCancelled:
+		return nil, ErrSettlementResolved
+	case models.SettlementStatusDisputed:
+		if status == models.SettlementStatusDisputed {
+			return nil, ErrSettlementDisputed
+		}
+	}
+
+	action := map[models.SettlementStatus]models.AuditAction{
+		models.SettlementStatusConfirmed: models.AuditSettlementConfirmed,
+		models.SettlementStatusDisputed:  models.AuditSettlementDisputed,
+		models.SettlementStatusCancelled: models.AuditSettlementCancelled,
+	}[status]
+
+	var after *models.Settlement
+	err = s.db.WithTx(func(tx *database.Tx) error {
+		if err := s.settlementRepo.UpdateStatusTx(tx, settlementID, before.Status, status, reason); err != nil {
+			return err
+		}
+		if status == models.SettlementStatusConfirmed {
+			if err := s.applySettlementTx(tx, before); err != nil {
+				return err
+			}
+		}
+		var err error
+		if after, err = s.settlementRepo.GetByIDTx(tx, settlementID); err != nil {
+			return err
+		}
+		event := models.AuditEvent{
+			TeamID:      teamID,
+			ActorID:     actorID,
+			Action:      action,
+			EntityType:  models.AuditEntitySettlement,
+			EntityID:    settlementID,
+			RequestMeta: meta,
+		}
+		return recordAudit(s.auditRepo, tx, event, before, after)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return after, nil
+}
 
-	return s.settlementRepo.Create(settlement)
+// GetSettlements lists a page of the team's settlements matching filter,
+// newest first
+func (s *BalanceService) GetSettlements(teamID uuid.UUID, filter repository.SettlementFilter, page repository.Page) ([]models.Settlement, int64, string, error) {
+	return s.settlementRepo.ListByTeamID(teamID, filter, page)
 }
 
 // GetUserBalance gets the balance summary for a specific user in a team
 func (s *BalanceService) GetUserBalance(teamID, userID uuid.UUID) (*models.UserBalanceSummary, error) {
-	teamSummary, err := s.CalculateBalances(teamID)
+	teamSummary, err := s.CalculateBalances(teamID, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestSuggestTransfersAgreeOnOverpaidPairs(t *testing.T) {
+	alice, bob, carol := uuid.New(), uuid.New(), uuid.New()
+	// Alice paid Bob back 30.00 more than she owed him, and Carol owes
+	// Alice 10.00.
+	balanceMap := map[uuid.UUID]map[uuid.UUID]models.Money{
+		alice: {bob: -3000},
+		bob:   {},
+		carol: {alice: 1000},
+	}
+	want := map[uuid.UUID]models.Money{alice: 4000, bob: -3000, carol: -1000}
+
+	sums := func(transfers []transfer) map[uuid.UUID]models.Money {
+		net := make(map[uuid.UUID]models.Money)
+		for _, t := range transfers {
+			net[t.from] -= t.amount
+			net[t.to] += t.amount
+		}
+		return net
+	}
+
+	s := &BalanceService{}
+	for _, mode := range []models.BalanceMode{models.BalanceModePairwise, models.BalanceModeSimplified} {
+		pairwise, transfers := s.suggestTransfers(mode, balanceMap)
+		for view, got := range map[string]map[uuid.UUID]models.Money{
+			"balances":  sums(pairwise),
+			"transfers": sums(transfers),
+		} {
+			for userID, amount := range want {
+				if got[userID] != amount {
+					t.Errorf("%s %s: net position of %s is %s, want %s", mode, view, userID, got[userID], amount)
+				}
+			}
+		}
+	}
+}
+
+func TestHaveHistory(t *testing.T) {
+	env := newTestEnv(t)
+	alice, bob, carol := env.newUser(t, "Alice"), env.newUser(t, "Bob"), env.newUser(t, "Carol")
+	teamID := env.newTeam(t, alice, bob, carol)
+	env.newExpense(t, teamID, alice, 6000, alice, bob)
+
+	for _, tt := range []struct {
+		name        string
+		user, other uuid.UUID
+		want        bool
+	}{
+		{"payer and debtor", alice, bob, true},
+		{"debtor and payer", bob, alice, true},
+		{"no shared expense", alice, carol, false},
+	} {
+		shared, err := env.balances.HaveHistory(teamID, tt.user, tt.other)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if shared != tt.want {
+			t.Errorf("%s: HaveHistory = %v, want %v", tt.name, shared, tt.want)
+		}
+	}
+}
+
+func TestRebuildBalancesWhileExpensesChange(t *testing.T) {
+	env := newTestEnv(t)
+	alice, bob := env.newUser(t, "Alice"), env.newUser(t, "Bob")
+	teamID := env.newTeam(t, alice, bob)
+
+	const writers = 10
+	var wg sync.WaitGroup
+	errs := make([]error, 2*writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = env.expenses.CreateExpense(teamID, alice, &models.ExpenseCreateRequest{
+				Amount:      1000,
+				Description: "Test expense",
+				SplitType:   models.SplitTypeEqual,
+				SplitWith:   []uuid.UUID{alice, bob},
+			}, models.RequestMeta{})
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[writers+i] = env.balances.RebuildBalances(teamID)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	drift, err := env.balances.RebuildBalances(teamID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drift) > 0 {
+		t.Errorf("balances drifted while being rebuilt: %+v", drift)
+	}
+}
@@ -0,0 +1,245 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/expensesplit/backend/internal/database"
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/expensesplit/backend/internal/repository"
+	"github.com/google/uuid"
+)
+
+var ErrAsOfInFuture = errors.New("as_of can't be in the future")
+
+// ClosePeriod keeps the team's balances as of the end of a period, now by
+// default, as a snapshot that later changes don't affect. A period closed
+// late still shows expenses as they stood at its end. Only admins can close
+// a period.
+func (s *BalanceService) ClosePeriod(teamID uuid.UUID, req *models.PeriodCloseRequest, actorID uuid.UUID, meta models.RequestMeta) (*models.BalanceSnapshotResponse, error) {
+	isAdmin, err := s.teamRepo.IsAdmin(teamID, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if !isAdmin {
+		return nil, ErrNotAuthorized
+	}
+
+	asOf := time.Now()
+	if req.AsOf != nil {
+		if req.AsOf.After(asOf) {
+			return nil, ErrAsOfInFuture
+		}
+		asOf = *req.AsOf
+	}
+
+	team, err := s.teamRepo.GetByID(teamID)
+	if err != nil {
+		return nil, err
+	}
+	settlements, err := s.settlementRepo.GetByTeamID(teamID)
+	if err != nil {
+		return nil, err
+	}
+	computed, err := s.computeBalances(teamID, settlements, &asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &models.BalanceSnapshot{
+		TeamID:      teamID,
+		Label:       req.Label,
+		AsOf:        asOf,
+		Currency:    team.BaseCurrency,
+		BalanceMode: team.BalanceMode,
+		ClosedBy:    actorID,
+		Balances:    computed.balances(),
+	}
+	err = s.db.WithTx(func(tx *database.Tx) error {
+		if err := s.snapshotRepo.CreateTx(tx, snapshot); err != nil {
+			return err
+		}
+		event := models.AuditEvent{
+			TeamID:      teamID,
+			ActorID:     actorID,
+			Action:      models.AuditBalancesClosed,
+			EntityType:  models.AuditEntitySnapshot,
+			EntityID:    snapshot.ID,
+			RequestMeta: meta,
+		}
+		return recordAudit(s.auditRepo, tx, event, nil, snapshot)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.snapshotResponse(team, snapshot)
+}
+
+// GetSnapshots lists the team's balance snapshots, latest period first.
+func (s *BalanceService) GetSnapshots(teamID uuid.UUID) ([]models.BalanceSnapshotResponse, error) {
+	snapshots, err := s.snapshotRepo.GetByTeamID(teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs := make([]uuid.UUID, len(snapshots))
+	for i, snapshot := range snapshots {
+		userIDs[i] = snapshot.ClosedBy
+	}
+	users, err := s.userRepo.GetByIDs(userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]models.BalanceSnapshotResponse, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		closedBy, ok := users[snapshot.ClosedBy]
+		if !ok {
+			return nil, repository.ErrUserNotFound
+		}
+		responses = append(responses, models.BalanceSnapshotResponse{
+			ID:        snapshot.ID,
+			Label:     snapshot.Label,
+			AsOf:      snapshot.AsOf,
+			ClosedBy:  closedBy.ToResponse(),
+			CreatedAt: snapshot.CreatedAt,
+		})
+	}
+	return responses, nil
+}
+
+// GetSnapshot gets a balance snapshot of the team with its balance summary.
+func (s *BalanceService) GetSnapshot(teamID, snapshotID uuid.UUID) (*models.BalanceSnapshotResponse, error) {
+	snapshot, err := s.snapshotRepo.GetByID(snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.TeamID != teamID {
+		return nil, repository.ErrSnapshotNotFound
+	}
+	team, err := s.teamRepo.GetByID(teamID)
+	if err != nil {
+		return nil, err
+	}
+	return s.snapshotResponse(team, snapshot)
+}
+
+// snapshotResponse summarizes the balances of a snapshot as they were
+// shown when it was taken, in the currency and balance mode of the time.
+func (s *BalanceService) snapshotResponse(team *models.Team, snapshot *models.BalanceSnapshot) (*models.BalanceSnapshotResponse, error) {
+	closedBy, err := s.userRepo.GetByID(snapshot.ClosedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	then := *team
+	then.BaseCurrency = snapshot.Currency
+	then.BalanceMode = snapshot.BalanceMode
+	summary, err := s.summarizeBalances(&then, snapshot.Balances, nil)
+	if err != nil {
+		return nil, err
+	}
+	summary.AsOf = &snapshot.AsOf
+
+	return &models.BalanceSnapshotResponse{
+		ID:        snapshot.ID,
+		Label:     snapshot.Label,
+		AsOf:      snapshot.AsOf,
+		ClosedBy:  closedBy.ToResponse(),
+		CreatedAt: snapshot.CreatedAt,
+		Summary:   summary,
+	}, nil
+}
+
+// expensesAsOf returns the team's expenses incurred on or before the day of
+// asOf as they stood at asOf, for balances as of then. Each expense is taken
+// in its latest revision made by asOf, or as first entered if it was
+// entered later. Expenses that were in the trash at asOf are left out, even
+// if restored since, while ones deleted later count, also once they have
+// been purged from the trash: their revisions outlive them.
+func (s *BalanceService) expensesAsOf(teamID uuid.UUID, asOf time.Time) ([]models.ExpenseSnapshot, error) {
+	expenses, err := s.expenseRepo.GetAllByTeamIDWithTrash(teamID)
+	if err != nil {
+		return nil, err
+	}
+	purged, err := s.expenseRepo.GetPurgedDeletedAfter(teamID, asOf)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uuid.UUID, 0, len(expenses)+len(purged))
+	for _, expense := range expenses {
+		ids = append(ids, expense.ID)
+	}
+	for id := range purged {
+		ids = append(ids, id)
+	}
+	revisions, err := s.revisionRepo.GetAsOf(ids, asOf)
+	if err != nil {
+		return nil, err
+	}
+	trashActions := []models.AuditAction{models.AuditExpenseDeleted, models.AuditExpenseRestored}
+	lastActions, err := s.auditRepo.GetLastActions(teamID, models.AuditEntityExpense, trashActions, asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	// Expenses without revisions haven't changed since revisions were kept
+	var unrevised []uuid.UUID
+	for _, expense := range expenses {
+		if _, ok := revisions[expense.ID]; !ok {
+			unrevised = append(unrevised, expense.ID)
+		}
+	}
+	payers, err := s.expenseRepo.GetPayersByExpenseIDs(unrevised)
+	if err != nil {
+		return nil, err
+	}
+	splits, err := s.expenseRepo.GetSplitsByExpenseIDs(unrevised)
+	if err != nil {
+		return nil, err
+	}
+
+	// Purged expenses are only left in their revisions, which were all
+	// kept by the time they were purged
+	for id, deletedAt := range purged {
+		revision, ok := revisions[id]
+		if !ok {
+			continue
+		}
+		deletedAt := deletedAt
+		expense := revision.Snapshot.Expense
+		expense.DeletedAt = &deletedAt
+		expenses = append(expenses, &expense)
+	}
+
+	day := models.NewDate(asOf).Time
+	var states []models.ExpenseSnapshot
+	for _, expense := range expenses {
+		if inTrashAt(expense, lastActions[expense.ID], asOf) {
+			continue
+		}
+		state := models.ExpenseSnapshot{Expense: *expense, Payers: payers[expense.ID], Splits: splits[expense.ID]}
+		if revision, ok := revisions[expense.ID]; ok {
+			state = revision.Snapshot
+		}
+		if state.Expense.IncurredOn.After(day) {
+			continue
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// inTrashAt reports whether the expense was in the trash at asOf, given the
+// last time it was deleted or restored by then.
+func inTrashAt(expense *models.Expense, lastAction models.AuditAction, asOf time.Time) bool {
+	switch lastAction {
+	case models.AuditExpenseDeleted:
+		return true
+	case models.AuditExpenseRestored:
+		return false
+	}
+	// Deleted before the audit log was kept
+	return expense.DeletedAt != nil && !expense.DeletedAt.After(asOf)
+}
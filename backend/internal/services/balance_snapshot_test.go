@@ -0,0 +1,91 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/expensesplit/backend/internal/models"
+)
+
+func TestBalancesAsOfUseExpensesAsTheyStood(t *testing.T) {
+	env := newTestEnv(t)
+	alice, bob := env.newUser(t, "Alice"), env.newUser(t, "Bob")
+	teamID := env.newTeam(t, alice, bob)
+	edited := env.newExpense(t, teamID, alice, 10000, alice, bob)
+	deleted := env.newExpense(t, teamID, alice, 6000, alice, bob)
+
+	time.Sleep(10 * time.Millisecond)
+	asOf := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	amount := models.Money(20000)
+	if _, err := env.expenses.UpdateExpense(edited.ID, &models.ExpenseUpdateRequest{Amount: &amount}, alice, models.RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.expenses.DeleteExpense(deleted.ID, alice, models.RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := env.balances.CalculateBalances(teamID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := owes(current, bob, alice); got != 10000 {
+		t.Errorf("Bob owes %s now, want 100.00", got)
+	}
+
+	past, err := env.balances.CalculateBalances(teamID, &asOf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := owes(past, bob, alice); got != 8000 {
+		t.Errorf("Bob owed %s as of before the edit and delete, want 80.00", got)
+	}
+
+	snapshot, err := env.balances.ClosePeriod(teamID, &models.PeriodCloseRequest{AsOf: &asOf}, alice, models.RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := owes(snapshot.Summary, bob, alice); got != 8000 {
+		t.Errorf("Bob owes %s in the late period close, want 80.00", got)
+	}
+}
+
+func TestBalancesAsOfOutlivePurges(t *testing.T) {
+	env := newTestEnv(t)
+	alice, bob := env.newUser(t, "Alice"), env.newUser(t, "Bob")
+	teamID := env.newTeam(t, alice, bob)
+	expense := env.newExpense(t, teamID, alice, 10000, alice, bob)
+
+	amount := models.Money(6000)
+	if _, err := env.expenses.UpdateExpense(expense.ID, &models.ExpenseUpdateRequest{Amount: &amount}, alice, models.RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	asOf := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	if err := env.expenses.DeleteExpense(expense.ID, alice, models.RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	before, err := env.balances.CalculateBalances(teamID, &asOf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := env.expenses.PurgeTrash(-time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	after, err := env.balances.CalculateBalances(teamID, &asOf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := owes(before, bob, alice); got != 3000 {
+		t.Errorf("Bob owed %s as of before the delete, want 30.00", got)
+	}
+	if got := owes(after, bob, alice); got != 3000 {
+		t.Errorf("Bob owed %s as of before the delete once it was purged, want 30.00", got)
+	}
+}
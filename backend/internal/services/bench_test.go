@@ -0,0 +1,134 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/expensesplit/backend/internal/repository"
+	"github.com/google/uuid"
+)
+
+// BenchmarkRequests runs the service calls behind the heaviest requests
+// against a team with a few hundred expenses and reports how many
+// statements each of them runs, including those inside transactions.
+func BenchmarkRequests(b *testing.B) {
+	env := newTestEnv(b)
+	alice, bob, carol := env.newUser(b, "Alice"), env.newUser(b, "Bob"), env.newUser(b, "Carol")
+	teamID := env.newTeam(b, alice, bob, carol)
+	var expense *models.ExpenseResponse
+	for i := 0; i < 300; i++ {
+		expense = env.newExpense(b, teamID, alice, 3000, alice, bob, carol)
+	}
+
+	amount := models.Money(3000)
+	requests := []struct {
+		name string
+		run  func() error
+	}{
+		{"ListExpenses", func() error {
+			_, _, _, err := env.expenses.GetTeamExpenses(teamID, repository.ExpenseFilter{}, repository.Page{Limit: 20})
+			return err
+		}},
+		{"GetExpense", func() error {
+			_, err := env.expenses.GetExpenseByID(expense.ID)
+			return err
+		}},
+		{"ExportExpenses", func() error {
+			if _, err := env.teams.GetTeamWithMembers(teamID); err != nil {
+				return err
+			}
+			_, err := env.expenses.GetExpensesForExport(teamID, repository.ExpenseFilter{})
+			return err
+		}},
+		{"TeamBalances", func() error {
+			_, err := env.balances.CalculateBalances(teamID, nil)
+			return err
+		}},
+		{"CreateExpense", func() error {
+			_, err := env.expenses.CreateExpense(teamID, alice, &models.ExpenseCreateRequest{
+				Amount:    1500,
+				SplitType: models.SplitTypeEqual,
+				SplitWith: []uuid.UUID{alice, bob, carol},
+			}, models.RequestMeta{})
+			return err
+		}},
+		{"UpdateExpense", func() error {
+			amount++
+			_, err := env.expenses.UpdateExpense(expense.ID, &models.ExpenseUpdateRequest{Amount: &amount}, alice, models.RequestMeta{})
+			return err
+		}},
+		{"RecordSettlement", func() error {
+			_, err := env.balances.RecordSettlement(teamID, &models.SettlementRequest{FromUser: bob, ToUser: alice, Amount: 1}, alice, models.RequestMeta{})
+			return err
+		}},
+	}
+
+	for _, request := range requests {
+		b.Run(request.name, func(b *testing.B) {
+			queries := env.db.QueryCount()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := request.run(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(env.db.QueryCount()-queries)/float64(b.N), "queries/op")
+		})
+	}
+}
+
+// BenchmarkExpenseChangesWithLongHistory changes the latest expense of a
+// team with a long history that settlements have mostly paid off, where
+// only the splits from the changed expense on are paid off again.
+func BenchmarkExpenseChangesWithLongHistory(b *testing.B) {
+	env := newTestEnv(b)
+	alice, bob, carol := env.newUser(b, "Alice"), env.newUser(b, "Bob"), env.newUser(b, "Carol")
+	teamID := env.newTeam(b, alice, bob, carol)
+	const history = 1000
+	var expense *models.ExpenseResponse
+	for i := 0; i < history; i++ {
+		expense = env.newExpense(b, teamID, alice, 3000, alice, bob, carol)
+	}
+	payment := &models.SettlementRequest{FromUser: bob, ToUser: alice, Amount: (history - 10) * 1000}
+	if _, err := env.balances.RecordSettlement(teamID, payment, alice, models.RequestMeta{}); err != nil {
+		b.Fatal(err)
+	}
+
+	amount := models.Money(3000)
+	requests := []struct {
+		name string
+		run  func() error
+	}{
+		{"CreateExpense", func() error {
+			_, err := env.expenses.CreateExpense(teamID, alice, &models.ExpenseCreateRequest{
+				Amount:    1500,
+				SplitType: models.SplitTypeEqual,
+				SplitWith: []uuid.UUID{alice, bob, carol},
+			}, models.RequestMeta{})
+			return err
+		}},
+		{"UpdateExpense", func() error {
+			amount++
+			_, err := env.expenses.UpdateExpense(expense.ID, &models.ExpenseUpdateRequest{Amount: &amount}, alice, models.RequestMeta{})
+			return err
+		}},
+		{"UpdateDescription", func() error {
+			description := "Renamed"
+			_, err := env.expenses.UpdateExpense(expense.ID, &models.ExpenseUpdateRequest{Description: &description}, alice, models.RequestMeta{})
+			return err
+		}},
+	}
+
+	for _, request := range requests {
+		b.Run(request.name, func(b *testing.B) {
+			queries := env.db.QueryCount()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := request.run(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(env.db.QueryCount()-queries)/float64(b.N), "queries/op")
+		})
+	}
+}
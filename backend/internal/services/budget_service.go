@@ -0,0 +1,378 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/expensesplit/backend/internal/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidBudgetPeriod = errors.New("invalid budget period")
+	ErrInvalidBudget       = errors.New("budget amount must be greater than 0 and warn_percent between 1 and 100")
+	ErrInvalidBudgetDates  = errors.New("end_date must not be before start_date and is required for custom periods")
+	ErrInvalidBudgetMember = errors.New("budget member is not a member of this team")
+)
+
+type BudgetService struct {
+	budgetRepo   *repository.BudgetRepository
+	teamRepo     *repository.TeamRepository
+	categoryRepo *repository.CategoryRepository
+}
+
+func NewBudgetService(budgetRepo *repository.BudgetRepository, teamRepo *repository.TeamRepository, categoryRepo *repository.CategoryRepository) *BudgetService {
+	return &BudgetService{
+		budgetRepo:   budgetRepo,
+		teamRepo:     teamRepo,
+		categoryRepo: categoryRepo,
+	}
+}
+
+func (s *BudgetService) GetTeamBudgets(teamID uuid.UUID) ([]*models.Budget, error) {
+	return s.budgetRepo.GetByTeamID(teamID)
+}
+
+func (s *BudgetService) CreateBudget(teamID uuid.UUID, req *models.BudgetRequest, requesterID uuid.UUID) (*models.Budget, error) {
+	if err := s.requireAdmin(teamID, requesterID); err != nil {
+		return nil, err
+	}
+
+	budget := &models.Budget{
+		TeamID:    teamID,
+		CreatedBy: requesterID,
+	}
+	if err := s.applyBudgetRequest(budget, req); err != nil {
+		return nil, err
+	}
+	if err := s.budgetRepo.Create(budget); err != nil {
+		return nil, err
+	}
+	return budget, nil
+}
+
+func (s *BudgetService) UpdateBudget(teamID, id uuid.UUID, req *models.BudgetRequest, requesterID uuid.UUID) (*models.Budget, error) {
+	if err := s.requireAdmin(teamID, requesterID); err != nil {
+		return nil, err
+	}
+
+	budget, err := s.getTeamBudget(teamID, id)
+	if err != nil {
+		return nil, err
+	}
+	if req.StartDate == nil {
+		req.StartDate = &budget.StartDate
+	}
+	if err := s.applyBudgetRequest(budget, req); err != nil {
+		return nil, err
+	}
+	if err := s.budgetRepo.Update(budget); err != nil {
+		return nil, err
+	}
+	return budget, nil
+}
+
+func (s *BudgetService) DeleteBudget(teamID, id, requesterID uuid.UUID) error {
+	if err := s.requireAdmin(teamID, requesterID); err != nil {
+		return err
+	}
+	if _, err := s.getTeamBudget(teamID, id); err != nil {
+		return err
+	}
+	return s.budgetRepo.Delete(id)
+}
+
+func (s *BudgetService) GetEvents(teamID uuid.UUID, limit int) ([]models.BudgetEvent, error) {
+	return s.budgetRepo.GetEvents(teamID, limit)
+}
+
+// applyBudgetRequest validates req and copies it onto budget.
+func (s *BudgetService) applyBudgetRequest(budget *models.Budget, req *models.BudgetRequest) error {
+	switch req.Period {
+	case models.BudgetPeriodWeekly, models.BudgetPeriodMonthly, models.BudgetPeriodQuarterly,
+		models.BudgetPeriodYearly, models.BudgetPeriodCustom:
+	default:
+		return ErrInvalidBudgetPeriod
+	}
+
+	warnPercent := req.WarnPercent
+	if warnPercent == 0 {
+		warnPercent = models.DefaultWarnPercent
+	}
+	if req.Amount <= 0 || warnPercent < 1 || warnPercent > 100 {
+		return ErrInvalidBudget
+	}
+
+	startDate := models.Today()
+	if req.StartDate != nil && !req.StartDate.IsZero() {
+		startDate = *req.StartDate
+	}
+	endDate := req.EndDate
+	if endDate != nil && endDate.IsZero() {
+		endDate = nil
+	}
+	if endDate != nil && endDate.Before(startDate.Time) {
+		return ErrInvalidBudgetDates
+	}
+	if req.Period == models.BudgetPeriodCustom && endDate == nil {
+		return ErrInvalidBudgetDates
+	}
+
+	if req.CategoryID != nil {
+		category, err := s.categoryRepo.GetByID(*req.CategoryID)
+		if err == repository.ErrCategoryNotFound || (err == nil && category.TeamID != budget.TeamID) {
+			return ErrUnknownCategory
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if req.UserID != nil {
+		isMember, err := s.teamRepo.IsMember(budget.TeamID, *req.UserID)
+		if err != nil {
+			return err
+		}
+		if !isMember {
+			return ErrInvalidBudgetMember
+		}
+	}
+
+	budget.CategoryID = req.CategoryID
+	budget.UserID = req.UserID
+	budget.Amount = req.Amount
+	budget.Period = req.Period
+	budget.StartDate = startDate
+	budget.EndDate = endDate
+	budget.WarnPercent = warnPercent
+	return nil
+}
+
+// GetStatus reports spending against every budget of the team that applies
+// on date, and where spending will end up by the end of each period at the
+// rate so far.
+func (s *BudgetService) GetStatus(teamID uuid.UUID, date models.Date) (*models.BudgetStatusResponse, error) {
+	team, err := s.teamRepo.GetByID(teamID)
+	if err != nil {
+		return nil, err
+	}
+	budgets, err := s.budgetRepo.GetByTeamID(teamID)
+	if err != nil {
+		return nil, err
+	}
+	categories, err := s.categoryRepo.GetByTeamID(teamID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.BudgetStatusResponse{
+		TeamID:   teamID,
+		Currency: team.BaseCurrency,
+		Date:     date,
+		Budgets:  []models.BudgetStatus{},
+	}
+	for _, budget := range budgets {
+		if !budget.Applies(date) {
+			continue
+		}
+		start, end := budget.PeriodContaining(date)
+		category, names := categoryScope(categories, budget.CategoryID)
+		spent, err := s.budgetRepo.GetSpent(teamID, names, budget.UserID, start, end)
+		if err != nil {
+			return nil, err
+		}
+
+		// Project the daily rate so far over the whole period
+		totalDays := daysBetween(start, end) + 1
+		elapsedDays := daysBetween(start, date) + 1
+		projected := spent
+		if elapsedDays < totalDays {
+			projected = models.Money(int64(spent) * int64(totalDays) / int64(elapsedDays))
+		}
+
+		response.Budgets = append(response.Budgets, models.BudgetStatus{
+			Budget:        *budget,
+			Category:      category,
+			PeriodStart:   start,
+			PeriodEnd:     end,
+			Spent:         spent,
+			Remaining:     budget.Amount - spent,
+			PercentUsed:   float64(spent) / float64(budget.Amount) * 100,
+			Projected:     projected,
+			Status:        budgetLevel(budget, spent),
+			ProjectedOver: projected > budget.Amount,
+		})
+	}
+	return response, nil
+}
+
+// CheckExpense compares the budgets the new expense counts towards before
+// and after it was added. Every threshold the expense crosses is recorded as
+// a budget event and returned as a warning. The expense and its splits must
+// already be saved.
+func (s *BudgetService) CheckExpense(expense *models.Expense, splits []models.ExpenseSplit) ([]models.BudgetWarning, error) {
+	budgets, err := s.budgetRepo.GetByTeamID(expense.TeamID)
+	if err != nil || len(budgets) == 0 {
+		return nil, err
+	}
+	categories, err := s.categoryRepo.GetByTeamID(expense.TeamID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []models.BudgetWarning
+	for _, budget := range budgets {
+		if !budget.Applies(expense.IncurredOn) {
+			continue
+		}
+		category, names := categoryScope(categories, budget.CategoryID)
+		if names != nil && !containsName(names, expense.Category) {
+			continue
+		}
+
+		added := expense.Amount
+		if budget.UserID != nil {
+			added = 0
+			for _, split := range splits {
+				if split.UserID == *budget.UserID {
+					added = split.Amount
+				}
+			}
+		}
+		if added <= 0 {
+			continue
+		}
+
+		start, end := budget.PeriodContaining(expense.IncurredOn)
+		spent, err := s.budgetRepo.GetSpent(expense.TeamID, names, budget.UserID, start, end)
+		if err != nil {
+			return nil, err
+		}
+		before := budgetLevel(budget, spent-added)
+		after := budgetLevel(budget, spent)
+		if after == before {
+			continue
+		}
+
+		event := &models.BudgetEvent{
+			BudgetID:    budget.ID,
+			TeamID:      expense.TeamID,
+			ExpenseID:   &expense.ID,
+			Level:       after,
+			PeriodStart: start,
+			Spent:       spent,
+			Amount:      budget.Amount,
+		}
+		if _, err := s.budgetRepo.RecordEvent(event); err != nil {
+			return nil, err
+		}
+
+		warnings = append(warnings, models.BudgetWarning{
+			BudgetID:    budget.ID,
+			Level:       after,
+			Category:    category,
+			UserID:      budget.UserID,
+			Spent:       spent,
+			Amount:      budget.Amount,
+			PeriodStart: start,
+			PeriodEnd:   end,
+			Message:     budgetWarningMessage(budget, category, after, spent),
+		})
+	}
+	return warnings, nil
+}
+
+func (s *BudgetService) requireAdmin(teamID, userID uuid.UUID) error {
+	isAdmin, err := s.teamRepo.IsAdmin(teamID, userID)
+	if err != nil {
+		return err
+	}
+	if !isAdmin {
+		return ErrNotAuthorized
+	}
+	return nil
+}
+
+func (s *BudgetService) getTeamBudget(teamID, id uuid.UUID) (*models.Budget, error) {
+	budget, err := s.budgetRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if budget.TeamID != teamID {
+		return nil, repository.ErrBudgetNotFound
+	}
+	return budget, nil
+}
+
+// budgetLevel returns the status of budget once spent has been spent.
+func budgetLevel(budget *models.Budget, spent models.Money) models.BudgetStatusLevel {
+	switch {
+	case spent > budget.Amount:
+		return models.BudgetStatusExceeded
+	case int64(spent)*100 >= int64(budget.Amount)*int64(budget.WarnPercent):
+		return models.BudgetStatusWarning
+	default:
+		return models.BudgetStatusOK
+	}
+}
+
+// categoryScope returns the name of the budget's category and the lowercased
+// names of it and all its subcategories. Both are empty for budgets that
+// cover every category.
+func categoryScope(categories []*models.Category, categoryID *uuid.UUID) (string, []string) {
+	if categoryID == nil {
+		return "", nil
+	}
+
+	var name string
+	names := []string{}
+	inScope := map[uuid.UUID]bool{*categoryID: true}
+	// Walk down one level at a time until no new subcategories turn up
+	for changed := true; changed; {
+		changed = false
+		for _, category := range categories {
+			if inScope[category.ID] || category.ParentID == nil || !inScope[*category.ParentID] {
+				continue
+			}
+			inScope[category.ID] = true
+			changed = true
+		}
+	}
+	for _, category := range categories {
+		if !inScope[category.ID] {
+			continue
+		}
+		if category.ID == *categoryID {
+			name = category.Name
+		}
+		names = append(names, strings.ToLower(category.Name))
+	}
+	return name, names
+}
+
+func containsName(names []string, name string) bool {
+	name = strings.ToLower(name)
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func daysBetween(from, to models.Date) int {
+	return int(to.Sub(from.Time).Hours() / 24)
+}
+
+func budgetWarningMessage(budget *models.Budget, category string, level models.BudgetStatusLevel, spent models.Money) string {
+	scope := "Team"
+	if category != "" {
+		scope = category
+	}
+	if level == models.BudgetStatusExceeded {
+		return fmt.Sprintf("%s budget exceeded: %s spent of %s", scope, spent.String(), budget.Amount.String())
+	}
+	return fmt.Sprintf("%s budget at %d%%: %s spent of %s", scope, int64(spent)*100/int64(budget.Amount),
+		spent.String(), budget.Amount.String())
+}
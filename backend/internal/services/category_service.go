@@ -0,0 +1,239 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/expensesplit/backend/internal/database"
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/expensesplit/backend/internal/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrCategoryNameRequired  = errors.New("category name is required")
+	ErrInvalidCategoryParent = errors.New("parent must be another active category of the same team and cannot be one of its subcategories")
+	ErrCategoryInUse         = errors.New("category is used by expenses or budgets or has subcategories, archive it instead")
+	ErrUnknownCategory       = errors.New("category does not exist in this team")
+	ErrCategoryArchived      = errors.New("category is archived")
+)
+
+type CategoryService struct {
+	db           *database.DB
+	categoryRepo *repository.CategoryRepository
+	teamRepo     *repository.TeamRepository
+	expenseRepo  *repository.ExpenseRepository
+	recorder     expenseRecorder
+}
+
+func NewCategoryService(
+	db *database.DB,
+	categoryRepo *repository.CategoryRepository,
+	teamRepo *repository.TeamRepository,
+	expenseRepo *repository.ExpenseRepository,
+	revisionRepo *repository.ExpenseRevisionRepository,
+	auditRepo *repository.AuditRepository,
+) *CategoryService {
+	return &CategoryService{
+		db:           db,
+		categoryRepo: categoryRepo,
+		teamRepo:     teamRepo,
+		expenseRepo:  expenseRepo,
+		recorder:     expenseRecorder{expenseRepo: expenseRepo, revisionRepo: revisionRepo, auditRepo: auditRepo},
+	}
+}
+
+func (s *CategoryService) GetTeamCategories(teamID uuid.UUID, includeArchived bool) ([]*models.Category, error) {
+	return s.categoryRepo.GetByTeamID(teamID, includeArchived)
+}
+
+func (s *CategoryService) CreateCategory(teamID uuid.UUID, req *models.CategoryCreateRequest, requesterID uuid.UUID) (*models.Category, error) {
+	if err := s.requireAdmin(teamID, requesterID); err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, ErrCategoryNameRequired
+	}
+
+	category := &models.Category{
+		TeamID: teamID,
+		Name:   name,
+	}
+	if req.ParentID != nil {
+		if err := s.checkParent(category, *req.ParentID); err != nil {
+			return nil, err
+		}
+		category.ParentID = req.ParentID
+	}
+
+	if err := s.categoryRepo.Create(category); err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+// UpdateCategory changes a category. A new name is given to the team's
+// expenses in the category as well, each recorded as an edit by the
+// requester in its revision history and the audit log.
+func (s *CategoryService) UpdateCategory(teamID, id uuid.UUID, req *models.CategoryUpdateRequest, requesterID uuid.UUID, meta models.RequestMeta) (*models.Category, error) {
+	if err := s.requireAdmin(teamID, requesterID); err != nil {
+		return nil, err
+	}
+
+	category, err := s.getTeamCategory(teamID, id)
+	if err != nil {
+		return nil, err
+	}
+	oldName := category.Name
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return nil, ErrCategoryNameRequired
+		}
+		category.Name = name
+	}
+	if req.RemoveParent {
+		category.ParentID = nil
+	} else if req.ParentID != nil {
+		if err := s.checkParent(category, *req.ParentID); err != nil {
+			return nil, err
+		}
+		category.ParentID = req.ParentID
+	}
+	if req.Archived != nil {
+		category.Archived = *req.Archived
+	}
+
+	err = s.db.WithTx(func(tx *database.Tx) error {
+		if err := s.categoryRepo.UpdateTx(tx, category, oldName); err != nil {
+			return err
+		}
+		if category.Name == oldName {
+			return nil
+		}
+		return s.renameExpensesTx(tx, category, oldName, requesterID, meta)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+// renameExpensesTx moves the team's expenses from oldName to the category's
+// current name using q, recording each change.
+func (s *CategoryService) renameExpensesTx(q database.Querier, category *models.Category, oldName string, actorID uuid.UUID, meta models.RequestMeta) error {
+	expenses, err := s.expenseRepo.GetByCategoryForUpdateTx(q, category.TeamID, oldName)
+	if err != nil {
+		return err
+	}
+	reason := fmt.Sprintf("Category %q renamed to %q", oldName, category.Name)
+	for _, expense := range expenses {
+		before, err := s.recorder.loadStateTx(q, expense)
+		if err != nil {
+			return err
+		}
+		expense.Category = category.Name
+		if err := s.expenseRepo.SetCategoryTx(q, expense); err != nil {
+			return err
+		}
+		after := *before
+		after.Expense = *expense
+		if err := s.recorder.recordRevision(q, before, &after, actorID, reason); err != nil {
+			return err
+		}
+		if err := s.recorder.recordAudit(q, expense, actorID, models.AuditExpenseUpdated, before, &after, meta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteCategory removes a category that nothing refers to. Categories that
+// are in use can only be archived.
+func (s *CategoryService) DeleteCategory(teamID, id, requesterID uuid.UUID) error {
+	if err := s.requireAdmin(teamID, requesterID); err != nil {
+		return err
+	}
+
+	category, err := s.getTeamCategory(teamID, id)
+	if err != nil {
+		return err
+	}
+	inUse, err := s.categoryRepo.IsInUse(category)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return ErrCategoryInUse
+	}
+	return s.categoryRepo.Delete(id)
+}
+
+// ResolveCategory returns the canonical name of the team's category called
+// name, which must not be archived. An empty name is left uncategorized.
+func (s *CategoryService) ResolveCategory(teamID uuid.UUID, name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil
+	}
+	category, err := s.categoryRepo.GetByName(teamID, name)
+	if err == repository.ErrCategoryNotFound {
+		return "", ErrUnknownCategory
+	}
+	if err != nil {
+		return "", err
+	}
+	if category.Archived {
+		return "", ErrCategoryArchived
+	}
+	return category.Name, nil
+}
+
+func (s *CategoryService) requireAdmin(teamID, userID uuid.UUID) error {
+	isAdmin, err := s.teamRepo.IsAdmin(teamID, userID)
+	if err != nil {
+		return err
+	}
+	if !isAdmin {
+		return ErrNotAuthorized
+	}
+	return nil
+}
+
+func (s *CategoryService) getTeamCategory(teamID, id uuid.UUID) (*models.Category, error) {
+	category, err := s.categoryRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if category.TeamID != teamID {
+		return nil, repository.ErrCategoryNotFound
+	}
+	return category, nil
+}
+
+// checkParent makes sure parentID can be the parent of category: an active
+// category of the same team that is neither category itself nor one of its
+// descendants.
+func (s *CategoryService) checkParent(category *models.Category, parentID uuid.UUID) error {
+	for id := &parentID; id != nil; {
+		if *id == category.ID {
+			return ErrInvalidCategoryParent
+		}
+		ancestor, err := s.categoryRepo.GetByID(*id)
+		if err == repository.ErrCategoryNotFound {
+			return ErrInvalidCategoryParent
+		}
+		if err != nil {
+			return err
+		}
+		if ancestor.TeamID != category.TeamID || (*id == parentID && ancestor.Archived) {
+			return ErrInvalidCategoryParent
+		}
+		id = ancestor.ParentID
+	}
+	return nil
+}
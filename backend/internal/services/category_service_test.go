@@ -0,0 +1,58 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestRenameCategoryRecordsExpenseHistory(t *testing.T) {
+	env := newTestEnv(t)
+	alice, bob := env.newUser(t, "Alice"), env.newUser(t, "Bob")
+	teamID := env.newTeam(t, alice, bob)
+
+	expense, err := env.expenses.CreateExpense(teamID, bob, &models.ExpenseCreateRequest{
+		Amount:      5000,
+		Description: "Train tickets",
+		Category:    "Travel",
+		SplitType:   models.SplitTypeEqual,
+		SplitWith:   []uuid.UUID{alice, bob},
+	}, models.RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	categories, err := env.categories.GetTeamCategories(teamID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var travel *models.Category
+	for _, category := range categories {
+		if category.Name == "Travel" {
+			travel = category
+		}
+	}
+	if travel == nil {
+		t.Fatal("team has no Travel category")
+	}
+
+	name := "Trips"
+	_, err = env.categories.UpdateCategory(teamID, travel.ID, &models.CategoryUpdateRequest{Name: &name}, alice, models.RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := env.expenses.GetExpenseHistory(teamID, expense.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := history[len(history)-1]
+	if latest.EditedBy.ID != alice || latest.Snapshot.Expense.Category != "Trips" {
+		t.Errorf("latest revision is by %s with category %q, want Alice's rename to Trips",
+			latest.EditedBy.Name, latest.Snapshot.Expense.Category)
+	}
+	if len(latest.Changes) != 1 || latest.Changes[0].Field != "category" {
+		t.Errorf("rename changed %v, want only the category", latest.Changes)
+	}
+}
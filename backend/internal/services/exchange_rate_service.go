@@ -0,0 +1,275 @@
+package services
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/expensesplit/backend/internal/repository"
+)
+
+// ECB reference rates are quoted as units of foreign currency per euro.
+const (
+	ecbBaseCurrency = "EUR"
+	ecbSource       = "ecb"
+)
+
+var (
+	ErrUnsupportedRateFile = errors.New("unsupported rate file format, expected .csv or .xml")
+	ErrEmptyRateFile       = errors.New("rate file contains no rates")
+)
+
+type ExchangeRateService struct {
+	rateRepo *repository.ExchangeRateRepository
+}
+
+func NewExchangeRateService(rateRepo *repository.ExchangeRateRepository) *ExchangeRateService {
+	return &ExchangeRateService{rateRepo: rateRepo}
+}
+
+// ImportFile loads an ECB reference rate file (CSV or XML, daily or
+// historical) from disk and stores its rates. It returns the number of
+// rates imported.
+func (s *ExchangeRateService) ImportFile(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var rates []models.ExchangeRate
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		rates, err = parseECBCSV(f)
+	case ".xml":
+		rates, err = parseECBXML(f)
+	default:
+		return 0, ErrUnsupportedRateFile
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(rates) == 0 {
+		return 0, ErrEmptyRateFile
+	}
+
+	return s.rateRepo.Upsert(rates)
+}
+
+// GetRate returns how many units of `to` one unit of `from` buys on the
+// given date, using the latest rate published on or before that date.
+// Pairs that are not stored directly are derived through the euro.
+func (s *ExchangeRateService) GetRate(from, to string, date time.Time) (models.Rate, error) {
+	if from == to {
+		return models.RateOne, nil
+	}
+
+	if rate, err := s.rateRepo.GetEffective(from, to, date); err == nil {
+		return rate.Rate, nil
+	} else if err != repository.ErrRateNotFound {
+		return 0, err
+	}
+
+	if rate, err := s.rateRepo.GetEffective(to, from, date); err == nil {
+		return models.RateOne.Per(rate.Rate)
+	} else if err != repository.ErrRateNotFound {
+		return 0, err
+	}
+
+	fromRate, err := s.euroRate(from, date)
+	if err != nil {
+		return 0, err
+	}
+	toRate, err := s.euroRate(to, date)
+	if err != nil {
+		return 0, err
+	}
+	return toRate.Per(fromRate)
+}
+
+// euroRate returns the number of units of currency per euro.
+func (s *ExchangeRateService) euroRate(currency string, date time.Time) (models.Rate, error) {
+	if currency == ecbBaseCurrency {
+		return models.RateOne, nil
+	}
+	rate, err := s.rateRepo.GetEffective(ecbBaseCurrency, currency, date)
+	if err != nil {
+		return 0, err
+	}
+	return rate.Rate, nil
+}
+
+// GetRates lists the rates of every known currency against base on the
+// given date.
+func (s *ExchangeRateService) GetRates(base string, date time.Time) (*models.RatesResponse, error) {
+	euroRates, err := s.rateRepo.GetEffectiveForBase(ecbBaseCurrency, date)
+	if err != nil {
+		return nil, err
+	}
+
+	// Units of each currency per euro, including the euro itself
+	perEuro := map[string]models.Rate{ecbBaseCurrency: models.RateOne}
+	effective := map[string]time.Time{}
+	for _, rate := range euroRates {
+		perEuro[rate.QuoteCurrency] = rate.Rate
+		effective[rate.QuoteCurrency] = rate.EffectiveDate
+	}
+
+	baseRate, ok := perEuro[base]
+	if !ok {
+		return nil, repository.ErrRateNotFound
+	}
+
+	response := &models.RatesResponse{
+		Base:  base,
+		Date:  date.Format("2006-01-02"),
+		Rates: []models.RateQuote{},
+	}
+	for currency, rate := range perEuro {
+		if currency == base {
+			continue
+		}
+		// A cross rate is only as current as the older of its two legs;
+		// the euro leg has no row and never limits it.
+		effectiveDate := effective[currency]
+		if baseDate, ok := effective[base]; ok && (effectiveDate.IsZero() || baseDate.Before(effectiveDate)) {
+			effectiveDate = baseDate
+		}
+		crossRate, err := rate.Per(baseRate)
+		if err != nil {
+			return nil, err
+		}
+		response.Rates = append(response.Rates, models.RateQuote{
+			Currency:      currency,
+			Rate:          crossRate,
+			EffectiveDate: effectiveDate.Format("2006-01-02"),
+		})
+	}
+	sort.Slice(response.Rates, func(i, j int) bool {
+		return response.Rates[i].Currency < response.Rates[j].Currency
+	})
+
+	return response, nil
+}
+
+// parseECBDate accepts both the ISO dates used in the historical files and
+// the "02 January 2006" form used in the daily CSV.
+func parseECBDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse("02 January 2006", value)
+}
+
+// parseECBCSV parses eurofxref.csv / eurofxref-hist.csv: a "Date" column
+// followed by one column per currency, with "N/A" for missing values.
+func parseECBCSV(r io.Reader) ([]models.ExchangeRate, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rate file header: %w", err)
+	}
+	if len(header) == 0 || !strings.EqualFold(strings.TrimSpace(header[0]), "Date") {
+		return nil, errors.New("rate file header must start with a Date column")
+	}
+
+	var rates []models.ExchangeRate
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) == 0 || strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+
+		date, err := parseECBDate(record[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q in rate file", record[0])
+		}
+
+		for i := 1; i < len(record) && i < len(header); i++ {
+			currency, err := models.NormalizeCurrency(header[i])
+			if err != nil {
+				continue // Trailing empty column in ECB files
+			}
+			value := strings.TrimSpace(record[i])
+			if value == "" || value == "N/A" {
+				continue
+			}
+			rate, err := models.NewRateFromString(value)
+			if err != nil || rate <= 0 {
+				return nil, fmt.Errorf("invalid rate %q for %s on %s", value, currency, record[0])
+			}
+			rates = append(rates, models.ExchangeRate{
+				BaseCurrency:  ecbBaseCurrency,
+				QuoteCurrency: currency,
+				EffectiveDate: date,
+				Rate:          rate,
+				Source:        ecbSource,
+			})
+		}
+	}
+	return rates, nil
+}
+
+type ecbEnvelope struct {
+	Cube struct {
+		Days []struct {
+			Time  string `xml:"time,attr"`
+			Rates []struct {
+				Currency string `xml:"currency,attr"`
+				Rate     string `xml:"rate,attr"`
+			} `xml:"Cube"`
+		} `xml:"Cube"`
+	} `xml:"Cube"`
+}
+
+// parseECBXML parses eurofxref-daily.xml / eurofxref-hist.xml.
+func parseECBXML(r io.Reader) ([]models.ExchangeRate, error) {
+	var envelope ecbEnvelope
+	if err := xml.NewDecoder(r).Decode(&envelope); err != nil {
+		return nil, fmt.Errorf("failed to parse rate file: %w", err)
+	}
+
+	var rates []models.ExchangeRate
+	for _, day := range envelope.Cube.Days {
+		date, err := parseECBDate(day.Time)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q in rate file", day.Time)
+		}
+		for _, entry := range day.Rates {
+			currency, err := models.NormalizeCurrency(entry.Currency)
+			if err != nil {
+				return nil, fmt.Errorf("invalid currency %q in rate file", entry.Currency)
+			}
+			rate, err := models.NewRateFromString(entry.Rate)
+			if err != nil || rate <= 0 {
+				return nil, fmt.Errorf("invalid rate %q for %s on %s", entry.Rate, currency, day.Time)
+			}
+			rates = append(rates, models.ExchangeRate{
+				BaseCurrency:  ecbBaseCurrency,
+				QuoteCurrency: currency,
+				EffectiveDate: date,
+				Rate:          rate,
+				Source:        ecbSource,
+			})
+		}
+	}
+	return rates, nil
+}
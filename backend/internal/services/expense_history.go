@@ -0,0 +1,353 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/expensesplit/backend/internal/database"
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/expensesplit/backend/internal/repository"
+	"github.com/google/uuid"
+)
+
+// expenseRecorder keeps the revision history and audit trail of expenses.
+// Expenses are changed by other services too, e.g. when their category is
+// renamed, and those changes are recorded through it as well.
+type expenseRecorder struct {
+	expenseRepo  *repository.ExpenseRepository
+	revisionRepo *repository.ExpenseRevisionRepository
+	auditRepo    *repository.AuditRepository
+}
+
+// recordRevision keeps after as the next revision of the expense using q.
+// before is the state the change started from, nil for new expenses.
+// Expenses entered before revisions were kept get their prior state as
+// their first revision, and changes that leave everything as it was are
+// not kept.
+func (s expenseRecorder) recordRevision(q database.Querier, before, after *models.ExpenseSnapshot, editorID uuid.UUID, reason string) error {
+	if before != nil {
+		if err := s.keepInitialRevision(q, before); err != nil {
+			return err
+		}
+		if len(diffSnapshots(before, after)) == 0 {
+			return nil
+		}
+	}
+
+	return s.revisionRepo.CreateTx(q, &models.ExpenseRevision{
+		ExpenseID: after.Expense.ID,
+		EditedBy:  editorID,
+		Reason:    reason,
+		Snapshot:  *after,
+	})
+}
+
+// keepInitialRevision keeps state as the first revision of an expense
+// entered before revisions were kept, using q. Expenses that already have
+// revisions are left alone.
+func (s expenseRecorder) keepInitialRevision(q database.Querier, state *models.ExpenseSnapshot) error {
+	latest, err := s.revisionRepo.LatestTx(q, state.Expense.ID)
+	if err != nil || latest > 0 {
+		return err
+	}
+	return s.revisionRepo.CreateTx(q, &models.ExpenseRevision{
+		ExpenseID: state.Expense.ID,
+		EditedBy:  state.Expense.PaidBy,
+		Snapshot:  *state,
+		CreatedAt: state.Expense.UpdatedAt,
+	})
+}
+
+// loadStateTx loads the current state of expense using q. The
+// expense itself is copied so that later changes to it don't affect the
+// state.
+func (s expenseRecorder) loadStateTx(q database.Querier, expense *models.Expense) (*models.ExpenseSnapshot, error) {
+	state := &models.ExpenseSnapshot{Expense: *expense}
+	var err error
+	if state.Payers, err = s.expenseRepo.GetPayersByExpenseIDTx(q, expense.ID); err != nil {
+		return nil, err
+	}
+	if state.Splits, err = s.expenseRepo.GetSplitsByExpenseIDTx(q, expense.ID); err != nil {
+		return nil, err
+	}
+	if expense.SplitType == models.SplitTypeItemized {
+		if state.Items, err = s.expenseRepo.GetItemsByExpenseIDTx(q, expense.ID); err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
+}
+
+func (s expenseRecorder) recordAudit(q database.Querier, expense *models.Expense, actorID uuid.UUID, action models.AuditAction, before, after *models.ExpenseSnapshot, meta models.RequestMeta) error {
+	event := models.AuditEvent{
+		TeamID:      expense.TeamID,
+		ActorID:     actorID,
+		Action:      action,
+		EntityType:  models.AuditEntityExpense,
+		EntityID:    expense.ID,
+		RequestMeta: meta,
+	}
+	// Keep absent states empty rather than encoding a nil pointer as null
+	var beforeState, afterState interface{}
+	if before != nil {
+		beforeState = before
+	}
+	if after != nil {
+		afterState = after
+	}
+	return recordAudit(s.auditRepo, q, event, beforeState, afterState)
+}
+
+// GetExpenseHistory lists the revisions of an expense of the team, oldest
+// first, each with its changes from the revision before.
+func (s *ExpenseService) GetExpenseHistory(teamID, id uuid.UUID) ([]*models.ExpenseRevisionResponse, error) {
+	expense, err := s.expenseRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if expense.TeamID != teamID {
+		return nil, repository.ErrExpenseNotFound
+	}
+
+	revisions, err := s.revisionRepo.GetByExpenseID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	editorIDs := make([]uuid.UUID, len(revisions))
+	for i, revision := range revisions {
+		editorIDs[i] = revision.EditedBy
+	}
+	editors, err := s.userRepo.GetByIDs(editorIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]*models.ExpenseRevisionResponse, 0, len(revisions))
+	for i := range revisions {
+		revision := &revisions[i]
+		editor, ok := editors[revision.EditedBy]
+		if !ok {
+			return nil, repository.ErrUserNotFound
+		}
+
+		changes := []models.FieldChange{}
+		if i > 0 {
+			changes = diffSnapshots(&revisions[i-1].Snapshot, &revision.Snapshot)
+		}
+		responses = append(responses, &models.ExpenseRevisionResponse{
+			Revision:  revision.Revision,
+			EditedBy:  editor.ToResponse(),
+			Reason:    revision.Reason,
+			Changes:   changes,
+			Snapshot:  revision.Snapshot,
+			CreatedAt: revision.CreatedAt,
+		})
+	}
+	return responses, nil
+}
+
+// RevertExpense restores the amounts, details, payers, splits and items an
+// expense had at an earlier revision. The revert is kept as a new revision,
+// so it can itself be reverted. As with any update, settlements are applied
+// again to what the splits now owe.
+func (s *ExpenseService) RevertExpense(id uuid.UUID, number int, reason string, requesterID uuid.UUID, meta models.RequestMeta) (*models.ExpenseResponse, error) {
+	if reason == "" {
+		reason = fmt.Sprintf("Reverted to revision %d", number)
+	}
+
+	err := s.db.WithTx(func(tx *database.Tx) error {
+		expense, err := s.expenseRepo.GetForUpdateTx(tx, id, false)
+		if err != nil {
+			return err
+		}
+
+		// Only the payer can revert the expense
+		if expense.PaidBy != requesterID {
+			return ErrNotAuthorized
+		}
+
+		target, err := s.revisionRepo.Get(id, number)
+		if err != nil {
+			return err
+		}
+		before, err := s.recorder.loadStateTx(tx, expense)
+		if err != nil {
+			return err
+		}
+
+		old := target.Snapshot.Expense
+		if !strings.EqualFold(old.Category, expense.Category) {
+			expense.Category, err = s.categoryService.ResolveCategory(expense.TeamID, old.Category)
+			if err != nil {
+				return err
+			}
+		}
+		expense.Amount = old.Amount
+		expense.OriginalAmount = old.OriginalAmount
+		expense.Tax = old.Tax
+		expense.ServiceCharge = old.ServiceCharge
+		expense.Tip = old.Tip
+		expense.Description = old.Description
+		expense.SplitType = old.SplitType
+		expense.IncurredOn = old.IncurredOn
+
+		payers := append([]models.ExpensePayer(nil), target.Snapshot.Payers...)
+		splits := make([]models.ExpenseSplit, len(target.Snapshot.Splits))
+		for i, split := range target.Snapshot.Splits {
+			split.ID = uuid.Nil
+			splits[i] = split
+		}
+		items := append([]models.ExpenseItem(nil), target.Snapshot.Items...)
+
+		payersChanged := !samePayers(before.Payers, payers)
+		moneyChanged := reconcileSplits(before.Splits, splits) || expense.Amount != before.Expense.Amount || payersChanged
+
+		after := &models.ExpenseSnapshot{Expense: *expense, Payers: payers, Splits: splits, Items: items}
+		if err := s.saveExpenseTx(tx, after, moneyChanged); err != nil {
+			return err
+		}
+		if moneyChanged {
+			if err := s.updateBalancesTx(tx, before, after); err != nil {
+				return err
+			}
+		}
+		if err := s.recorder.recordRevision(tx, before, after, requesterID, reason); err != nil {
+			return err
+		}
+		return s.recorder.recordAudit(tx, expense, requesterID, models.AuditExpenseReverted, before, after, meta)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetExpenseByID(id)
+}
+
+// diffSnapshots lists the fields that differ between two versions of an
+// expense. Settlement state, receipts and timestamps are not edits and are
+// ignored.
+func diffSnapshots(old, new *models.ExpenseSnapshot) []models.FieldChange {
+	changes := []models.FieldChange{}
+	add := func(field string, oldValue, newValue interface{}) {
+		changes = append(changes, models.FieldChange{Field: field, Old: oldValue, New: newValue})
+	}
+
+	a, b := old.Expense, new.Expense
+	if a.Amount != b.Amount {
+		add("amount", a.Amount, b.Amount)
+	}
+	if a.OriginalAmount != b.OriginalAmount {
+		add("original_amount", a.OriginalAmount, b.OriginalAmount)
+	}
+	if a.Tax != b.Tax {
+		add("tax", a.Tax, b.Tax)
+	}
+	if a.ServiceCharge != b.ServiceCharge {
+		add("service_charge", a.ServiceCharge, b.ServiceCharge)
+	}
+	if a.Tip != b.Tip {
+		add("tip", a.Tip, b.Tip)
+	}
+	if a.Description != b.Description {
+		add("description", a.Description, b.Description)
+	}
+	if a.Category != b.Category {
+		add("category", a.Category, b.Category)
+	}
+	if a.SplitType != b.SplitType {
+		add("split_type", a.SplitType, b.SplitType)
+	}
+	if !a.IncurredOn.Equal(b.IncurredOn.Time) {
+		add("incurred_on", a.IncurredOn, b.IncurredOn)
+	}
+
+	diffMembers("payers", payerAmounts(old.Payers), payerAmounts(new.Payers), add)
+	diffMembers("splits", splitAmounts(old.Splits), splitAmounts(new.Splits), add)
+
+	if !sameItems(old.Items, new.Items) {
+		add("items", itemEntries(old.Items), itemEntries(new.Items))
+	}
+	return changes
+}
+
+// memberAmount is what one member paid or owes on an expense.
+type memberAmount struct {
+	UserID uuid.UUID
+	Amount models.Money
+}
+
+func payerAmounts(payers []models.ExpensePayer) []memberAmount {
+	amounts := make([]memberAmount, len(payers))
+	for i, payer := range payers {
+		amounts[i] = memberAmount{UserID: payer.UserID, Amount: payer.Amount}
+	}
+	return amounts
+}
+
+func splitAmounts(splits []models.ExpenseSplit) []memberAmount {
+	amounts := make([]memberAmount, len(splits))
+	for i, split := range splits {
+		amounts[i] = memberAmount{UserID: split.UserID, Amount: split.Amount}
+	}
+	return amounts
+}
+
+// diffMembers compares the amounts of two lists of members, reporting
+// changed, removed and added members under "<field>.<user id>".
+func diffMembers(field string, old, new []memberAmount, add func(string, interface{}, interface{})) {
+	oldByUser := make(map[uuid.UUID]models.Money, len(old))
+	for _, member := range old {
+		oldByUser[member.UserID] = member.Amount
+	}
+	newByUser := make(map[uuid.UUID]models.Money, len(new))
+	for _, member := range new {
+		newByUser[member.UserID] = member.Amount
+	}
+
+	for _, member := range old {
+		amount, ok := newByUser[member.UserID]
+		if !ok {
+			add(field+"."+member.UserID.String(), member.Amount, nil)
+		} else if amount != member.Amount {
+			add(field+"."+member.UserID.String(), member.Amount, amount)
+		}
+	}
+	for _, member := range new {
+		if _, ok := oldByUser[member.UserID]; !ok {
+			add(field+"."+member.UserID.String(), nil, member.Amount)
+		}
+	}
+}
+
+// itemEntries strips receipt items down to what an edit can change, since
+// items get new IDs every time they are saved.
+func itemEntries(items []models.ExpenseItem) []models.ExpenseItemEntry {
+	entries := make([]models.ExpenseItemEntry, len(items))
+	for i, item := range items {
+		entries[i] = models.ExpenseItemEntry{
+			Description: item.Description,
+			Amount:      item.Amount,
+			AssignedTo:  item.AssignedTo,
+		}
+	}
+	return entries
+}
+
+func sameItems(a, b []models.ExpenseItem) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Description != b[i].Description || a[i].Amount != b[i].Amount ||
+			len(a[i].AssignedTo) != len(b[i].AssignedTo) {
+			return false
+		}
+		for j := range a[i].AssignedTo {
+			if a[i].AssignedTo[j] != b[i].AssignedTo[j] {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -2,75 +2,190 @@ package services
 
 import (
 	"errors"
+	"log"
+	"math"
+	"strings"
+	"time"
 
+	"github.com/expensesplit/backend/internal/database"
 	"github.com/expensesplit/backend/internal/models"
 	"github.com/expensesplit/backend/internal/repository"
 	"github.com/google/uuid"
 )
 
 var (
-	ErrAmountRequired     = errors.New("amount is required and must be greater than 0")
-	ErrSplitWithRequired  = errors.New("at least one user to split with is required")
-	ErrInvalidSplitType   = errors.New("invalid split type")
-	ErrInvalidCustomSplit = errors.New("custom split amounts must equal total amount")
+	ErrAmountRequired        = errors.New("amount is required and must be greater than 0")
+	ErrSplitWithRequired     = errors.New("at least one user to split with is required")
+	ErrInvalidSplitType      = errors.New("invalid split type")
+	ErrInvalidCustomSplit    = errors.New("custom split amounts must equal total amount")
+	ErrInvalidPercentSplit   = errors.New("percentages must add up to 100")
+	ErrInvalidShareSplit     = errors.New("shares must be whole numbers of at least 1")
+	ErrInvalidSplit          = errors.New("split amounts must not be negative")
+	ErrInvalidItemizedSplit  = errors.New("itemized expenses need items with a non-negative amount assigned to distinct members")
+	ErrItemizedTotalMismatch = errors.New("amount must equal the sum of the items plus tax, service charge and tip")
+	ErrInvalidPayers         = errors.New("payer amounts must be positive, name each member once and add up to the total amount")
+	ErrExchangeRateRequired  = errors.New("no exchange rate available for this currency, please provide exchange_rate")
+	ErrAmountTooLarge        = errors.New("amount is too large to convert to the base currency")
 )
 
 type ExpenseService struct {
+	db           *database.DB
 	expenseRepo  *repository.ExpenseRepository
 	teamRepo     *repository.TeamRepository
 	userRepo     *repository.UserRepository
 	approvalRepo *repository.ApprovalRepository
+	auditRepo    *repository.AuditRepository
+	revisionRepo *repository.ExpenseRevisionRepository
+	balanceRepo  *repository.BalanceRepository
+	rateService  *ExchangeRateService
+	allocator    splitAllocator
+	recorder     expenseRecorder
+
+	categoryService *CategoryService
+	budgetService   *BudgetService
 }
 
 func NewExpenseService(
+	db *database.DB,
 	expenseRepo *repository.ExpenseRepository,
 	teamRepo *repository.TeamRepository,
 	userRepo *repository.UserRepository,
 	approvalRepo *repository.ApprovalRepository,
+	auditRepo *repository.AuditRepository,
+	revisionRepo *repository.ExpenseRevisionRepository,
+	balanceRepo *repository.BalanceRepository,
+	settlementRepo *repository.SettlementRepository,
+	rateService *ExchangeRateService,
+	categoryService *CategoryService,
+	budgetService *BudgetService,
 ) *ExpenseService {
 	return &ExpenseService{
+		db:           db,
 		expenseRepo:  expenseRepo,
 		teamRepo:     teamRepo,
 		userRepo:     userRepo,
 		approvalRepo: approvalRepo,
+		auditRepo:    auditRepo,
+		revisionRepo: revisionRepo,
+		balanceRepo:  balanceRepo,
+		rateService:  rateService,
+		allocator:    splitAllocator{expenseRepo: expenseRepo, settlementRepo: settlementRepo},
+		recorder:     expenseRecorder{expenseRepo: expenseRepo, revisionRepo: revisionRepo, auditRepo: auditRepo},
+
+		categoryService: categoryService,
+		budgetService:   budgetService,
 	}
 }
 
-func (s *ExpenseService) CreateExpense(teamID, paidBy uuid.UUID, req *models.ExpenseCreateRequest) (*models.ExpenseResponse, error) {
+func (s *ExpenseService) CreateExpense(teamID, paidBy uuid.UUID, req *models.ExpenseCreateRequest, meta models.RequestMeta) (*models.ExpenseResponse, error) {
+	// Validate split type
+	if req.SplitType == "" {
+		req.SplitType = models.SplitTypeEqual
+	}
+	if !isValidSplitType(req.SplitType) {
+		return nil, ErrInvalidSplitType
+	}
+
+	// Itemized expenses may leave the total to be derived from the receipt,
+	// and take their participants from the item assignments
+	var items []models.ExpenseItem
+	if req.SplitType == models.SplitTypeItemized {
+		items = itemsFromRequest(req.Items)
+		if req.Amount == 0 {
+			req.Amount = itemizedTotal(items, req.Tax, req.ServiceCharge, req.Tip)
+		}
+	}
+
 	// Validate input
 	if req.Amount <= 0 {
 		return nil, ErrAmountRequired
 	}
-	if len(req.SplitWith) == 0 {
+	if len(req.SplitWith) == 0 && req.SplitType != models.SplitTypeItemized {
 		return nil, ErrSplitWithRequired
 	}
 
-	// Validate split type
-	if req.SplitType == "" {
-		req.SplitType = models.SplitTypeEqual
+	category, err := s.categoryService.ResolveCategory(teamID, req.Category)
+	if err != nil {
+		return nil, err
 	}
-	if req.SplitType != models.SplitTypeEqual && req.SplitType != models.SplitTypeCustom && req.SplitType != models.SplitTypePercent {
-		return nil, ErrInvalidSplitType
+
+	// Resolve currency and the rate into the team's base currency
+	team, err := s.teamRepo.GetByID(teamID)
+	if err != nil {
+		return nil, err
+	}
+	currency := team.BaseCurrency
+	if req.Currency != "" {
+		currency, err = models.NormalizeCurrency(req.Currency)
+		if err != nil {
+			return nil, err
+		}
+	}
+	incurredOn := models.Today()
+	if req.IncurredOn != nil && !req.IncurredOn.IsZero() {
+		incurredOn = *req.IncurredOn
+	}
+	exchangeRate := models.RateOne
+	if currency != team.BaseCurrency {
+		exchangeRate, err = s.resolveExchangeRate(currency, team.BaseCurrency, req.ExchangeRate, incurredOn.Time)
+		if err != nil {
+			return nil, err
+		}
+	}
+	amount, err := req.Amount.Convert(exchangeRate)
+	if err != nil {
+		return nil, ErrAmountTooLarge
 	}
 
 	// Create expense
 	expense := &models.Expense{
-		TeamID:      teamID,
-		PaidBy:      paidBy,
-		Amount:      req.Amount,
-		Description: req.Description,
-		Category:    req.Category,
-		SplitType:   req.SplitType,
+		TeamID:         teamID,
+		PaidBy:         paidBy,
+		Amount:         amount,
+		Currency:       currency,
+		OriginalAmount: req.Amount,
+		ExchangeRate:   exchangeRate,
+		Tax:            req.Tax,
+		ServiceCharge:  req.ServiceCharge,
+		Tip:            req.Tip,
+		Description:    req.Description,
+		Category:       category,
+		SplitType:      req.SplitType,
+		IncurredOn:     incurredOn,
+
+		RecurringExpenseID: req.RecurringExpenseID,
+		OccurrenceDate:     req.OccurrenceDate,
+	}
+
+	payers, err := buildPayers(req.Payers, paidBy, expense)
+	if err != nil {
+		return nil, err
 	}
 
-	// Calculate splits
+	// Calculate splits in the original currency, then convert them
 	splits, err := s.calculateSplits(expense, req)
 	if err != nil {
 		return nil, err
 	}
+	if err := convertSplits(splits, expense.Amount); err != nil {
+		return nil, err
+	}
 
-	// Save expense and splits
-	if err := s.expenseRepo.Create(expense, splits); err != nil {
+	// Save expense, payers, splits and receipt items
+	err = s.db.WithTx(func(tx *database.Tx) error {
+		if err := s.expenseRepo.CreateTx(tx, expense, payers, splits, items); err != nil {
+			return err
+		}
+		after := &models.ExpenseSnapshot{Expense: *expense, Payers: payers, Splits: splits, Items: items}
+		if err := s.updateBalancesTx(tx, nil, after); err != nil {
+			return err
+		}
+		if err := s.recorder.recordRevision(tx, nil, after, paidBy, ""); err != nil {
+			return err
+		}
+		return s.recorder.recordAudit(tx, expense, paidBy, models.AuditExpenseCreated, nil, after, meta)
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -84,9 +199,79 @@ func (s *ExpenseService) CreateExpense(teamID, paidBy uuid.UUID, req *models.Exp
 		// In a real app, you might want to use a transaction
 	}
 
-	return s.GetExpenseByID(expense.ID)
+	response, err := s.GetExpenseByID(expense.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Warn about budgets the expense pushes past a threshold. A failed check
+	// doesn't fail expense creation
+	if warnings, err := s.budgetService.CheckExpense(expense, splits); err == nil {
+		response.BudgetWarnings = warnings
+	}
+	return response, nil
+}
+
+func isValidSplitType(splitType models.SplitType) bool {
+	switch splitType {
+	case models.SplitTypeEqual, models.SplitTypeCustom, models.SplitTypePercent,
+		models.SplitTypeShares, models.SplitTypeItemized:
+		return true
+	}
+	return false
+}
+
+// buildPayers turns the requested payer contributions, given in the expense
+// currency, into base currency amounts that add up exactly to
+// expense.Amount. Without entries the member recording the expense paid it
+// in full.
+func buildPayers(entries []models.PayerEntry, defaultPayer uuid.UUID, expense *models.Expense) ([]models.ExpensePayer, error) {
+	if len(entries) == 0 {
+		return []models.ExpensePayer{{UserID: defaultPayer, Amount: expense.Amount}}, nil
+	}
+
+	seen := make(map[uuid.UUID]bool)
+	weights := make([]int64, len(entries))
+	var total models.Money
+	for i, entry := range entries {
+		if entry.Amount <= 0 || seen[entry.UserID] {
+			return nil, ErrInvalidPayers
+		}
+		seen[entry.UserID] = true
+		weights[i] = entry.Amount.Cents()
+		total += entry.Amount
+	}
+	if total != expense.OriginalAmount {
+		return nil, ErrInvalidPayers
+	}
+
+	amounts, err := expense.Amount.Allocate(weights)
+	if err != nil {
+		return nil, ErrInvalidPayers
+	}
+	payers := make([]models.ExpensePayer, len(entries))
+	for i, entry := range entries {
+		payers[i] = models.ExpensePayer{UserID: entry.UserID, Amount: amounts[i]}
+	}
+	return payers, nil
+}
+
+// resolveExchangeRate returns the explicit rate if one was given, otherwise
+// the stored rate effective on the expense date.
+func (s *ExpenseService) resolveExchangeRate(from, to string, explicit models.Rate, date time.Time) (models.Rate, error) {
+	if explicit > 0 {
+		return explicit, nil
+	}
+	rate, err := s.rateService.GetRate(from, to, date)
+	if err == repository.ErrRateNotFound {
+		return 0, ErrExchangeRateRequired
+	}
+	return rate, err
 }
 
+// calculateSplits derives the per-user shares of an expense. Shares are
+// computed in whole cents and always add up exactly to expense.OriginalAmount; any
+// leftover cents are assigned as described in models.Money.Allocate.
 func (s *ExpenseService) calculateSplits(expense *models.Expense, req *models.ExpenseCreateRequest) ([]models.ExpenseSplit, error) {
 	var splits []models.ExpenseSplit
 
@@ -94,62 +279,219 @@ func (s *ExpenseService) calculateSplits(expense *models.Expense, req *models.Ex
 	case models.SplitTypeEqual:
 		// Equal split among all users (including the payer)
 		numUsers := len(req.SplitWith)
-		splitAmount := expense.Amount / float64(numUsers)
+		amounts := expense.OriginalAmount.AllocateEqually(numUsers)
 		splitPercent := 100.0 / float64(numUsers)
 
-		for _, userID := range req.SplitWith {
+		for i, userID := range req.SplitWith {
 			splits = append(splits, models.ExpenseSplit{
-				UserID:    userID,
-				Amount:    splitAmount,
-				Percent:   splitPercent,
-				IsSettled: userID == expense.PaidBy, // Payer's share is already settled
+				UserID:  userID,
+				Amount:  amounts[i],
+				Percent: splitPercent,
 			})
 		}
 
 	case models.SplitTypeCustom:
 		// Custom amount split
-		var totalCustom float64
+		var totalCustom models.Money
 		for _, entry := range req.CustomSplit {
+			if entry.Amount < 0 {
+				return nil, ErrInvalidCustomSplit
+			}
 			totalCustom += entry.Amount
 		}
-		if totalCustom != expense.Amount {
+		if totalCustom != expense.OriginalAmount {
 			return nil, ErrInvalidCustomSplit
 		}
 
 		for _, entry := range req.CustomSplit {
-			percent := (entry.Amount / expense.Amount) * 100
+			percent := entry.Amount.Float64() / expense.OriginalAmount.Float64() * 100
 			splits = append(splits, models.ExpenseSplit{
-				UserID:    entry.UserID,
-				Amount:    entry.Amount,
-				Percent:   percent,
-				IsSettled: entry.UserID == expense.PaidBy,
+				UserID:  entry.UserID,
+				Amount:  entry.Amount,
+				Percent: percent,
 			})
 		}
 
 	case models.SplitTypePercent:
-		// Percentage split
-		var totalPercent float64
-		for _, entry := range req.CustomSplit {
-			totalPercent += entry.Percent
+		// Percentage split, accepted with up to two decimals (basis points)
+		weights := make([]int64, len(req.CustomSplit))
+		var totalBasisPoints int64
+		for i, entry := range req.CustomSplit {
+			if entry.Percent < 0 {
+				return nil, ErrInvalidPercentSplit
+			}
+			weights[i] = int64(math.Round(entry.Percent * 100))
+			totalBasisPoints += weights[i]
 		}
-		if totalPercent != 100 {
-			return nil, errors.New("percentages must add up to 100")
+		if totalBasisPoints != 10000 {
+			return nil, ErrInvalidPercentSplit
 		}
 
-		for _, entry := range req.CustomSplit {
-			amount := (entry.Percent / 100) * expense.Amount
+		amounts, err := expense.OriginalAmount.Allocate(weights)
+		if err != nil {
+			return nil, ErrInvalidPercentSplit
+		}
+		for i, entry := range req.CustomSplit {
+			splits = append(splits, models.ExpenseSplit{
+				UserID:  entry.UserID,
+				Amount:  amounts[i],
+				Percent: entry.Percent,
+			})
+		}
+
+	case models.SplitTypeShares:
+		// Weighted split, e.g. 2 shares for a couple and 1 for a single
+		weights := make([]int64, len(req.CustomSplit))
+		for i, entry := range req.CustomSplit {
+			if entry.Shares < 1 {
+				return nil, ErrInvalidShareSplit
+			}
+			weights[i] = entry.Shares
+		}
+		if len(weights) == 0 {
+			return nil, ErrInvalidShareSplit
+		}
+
+		for i, entry := range req.CustomSplit {
 			splits = append(splits, models.ExpenseSplit{
-				UserID:    entry.UserID,
-				Amount:    amount,
-				Percent:   entry.Percent,
-				IsSettled: entry.UserID == expense.PaidBy,
+				UserID: entry.UserID,
+				Shares: weights[i],
 			})
 		}
+		if err := applyShares(splits, expense.OriginalAmount); err != nil {
+			return nil, err
+		}
+
+	case models.SplitTypeItemized:
+		return calculateItemizedSplits(expense, itemsFromRequest(req.Items))
 	}
 
 	return splits, nil
 }
 
+func itemsFromRequest(entries []models.ExpenseItemEntry) []models.ExpenseItem {
+	items := make([]models.ExpenseItem, len(entries))
+	for i, entry := range entries {
+		items[i] = models.ExpenseItem{
+			Position:    i,
+			Description: entry.Description,
+			Amount:      entry.Amount,
+			AssignedTo:  entry.AssignedTo,
+		}
+	}
+	return items
+}
+
+// itemizedTotal is the receipt total: all items plus tax, service and tip.
+func itemizedTotal(items []models.ExpenseItem, tax, serviceCharge, tip models.Money) models.Money {
+	total := tax + serviceCharge + tip
+	for _, item := range items {
+		total += item.Amount
+	}
+	return total
+}
+
+// calculateItemizedSplits divides each item equally between the members it
+// is assigned to, then allocates tax, service charge and tip in proportion
+// to each member's item subtotal. Splits are ordered by the first item each
+// member is assigned to.
+func calculateItemizedSplits(expense *models.Expense, items []models.ExpenseItem) ([]models.ExpenseSplit, error) {
+	if len(items) == 0 {
+		return nil, ErrInvalidItemizedSplit
+	}
+	if expense.Tax < 0 || expense.ServiceCharge < 0 || expense.Tip < 0 {
+		return nil, ErrInvalidItemizedSplit
+	}
+
+	var members []uuid.UUID
+	subtotals := make(map[uuid.UUID]models.Money)
+	var itemsTotal models.Money
+	for _, item := range items {
+		if item.Amount < 0 || len(item.AssignedTo) == 0 {
+			return nil, ErrInvalidItemizedSplit
+		}
+		seen := make(map[uuid.UUID]bool)
+		shares := item.Amount.AllocateEqually(len(item.AssignedTo))
+		for i, userID := range item.AssignedTo {
+			if seen[userID] {
+				return nil, ErrInvalidItemizedSplit
+			}
+			seen[userID] = true
+			if _, ok := subtotals[userID]; !ok {
+				members = append(members, userID)
+			}
+			subtotals[userID] += shares[i]
+		}
+		itemsTotal += item.Amount
+	}
+	if itemsTotal <= 0 {
+		return nil, ErrInvalidItemizedSplit
+	}
+	if itemizedTotal(items, expense.Tax, expense.ServiceCharge, expense.Tip) != expense.OriginalAmount {
+		return nil, ErrItemizedTotalMismatch
+	}
+
+	weights := make([]int64, len(members))
+	for i, userID := range members {
+		weights[i] = subtotals[userID].Cents()
+	}
+	extras, err := (expense.Tax + expense.ServiceCharge + expense.Tip).Allocate(weights)
+	if err != nil {
+		return nil, ErrInvalidItemizedSplit
+	}
+
+	splits := make([]models.ExpenseSplit, len(members))
+	for i, userID := range members {
+		amount := subtotals[userID] + extras[i]
+		splits[i] = models.ExpenseSplit{
+			UserID:  userID,
+			Amount:  amount,
+			Percent: amount.Float64() / expense.OriginalAmount.Float64() * 100,
+		}
+	}
+	return splits, nil
+}
+
+// applyShares sets split amounts and percentages from their stored share
+// weights, so a changed total can be re-divided without the original request.
+func applyShares(splits []models.ExpenseSplit, amount models.Money) error {
+	weights := make([]int64, len(splits))
+	var totalShares int64
+	for i, split := range splits {
+		if split.Shares < 1 {
+			return ErrInvalidShareSplit
+		}
+		weights[i] = split.Shares
+		totalShares += split.Shares
+	}
+	amounts, err := amount.Allocate(weights)
+	if err != nil {
+		return ErrInvalidShareSplit
+	}
+	for i := range splits {
+		splits[i].Amount = amounts[i]
+		splits[i].Percent = float64(splits[i].Shares) / float64(totalShares) * 100
+	}
+	return nil
+}
+
+// convertSplits rescales split amounts from the expense's original currency
+// so that they add up exactly to baseAmount, keeping their proportions.
+func convertSplits(splits []models.ExpenseSplit, baseAmount models.Money) error {
+	weights := make([]int64, len(splits))
+	for i, split := range splits {
+		weights[i] = split.Amount.Cents()
+	}
+	amounts, err := baseAmount.Allocate(weights)
+	if err != nil {
+		return ErrInvalidSplit
+	}
+	for i := range splits {
+		splits[i].Amount = amounts[i]
+	}
+	return nil
+}
+
 func (s *ExpenseService) GetExpenseByID(id uuid.UUID) (*models.ExpenseResponse, error) {
 	expense, err := s.expenseRepo.GetByID(id)
 	if err != nil {
@@ -160,133 +502,586 @@ func (s *ExpenseService) GetExpenseByID(id uuid.UUID) (*models.ExpenseResponse,
 }
 
 func (s *ExpenseService) buildExpenseResponse(expense *models.Expense) (*models.ExpenseResponse, error) {
-	// Get payer info
-	payer, err := s.userRepo.GetByID(expense.PaidBy)
+	responses, err := s.buildExpenseResponses([]*models.Expense{expense})
+	if err != nil {
+		return nil, err
+	}
+	return responses[0], nil
+}
+
+// buildExpenseResponses builds the responses of several expenses, loading
+// their payers, splits, items, approvals and users with one query each.
+func (s *ExpenseService) buildExpenseResponses(expenses []*models.Expense) ([]*models.ExpenseResponse, error) {
+	ids := make([]uuid.UUID, len(expenses))
+	var itemizedIDs []uuid.UUID
+	for i, expense := range expenses {
+		ids[i] = expense.ID
+		if expense.SplitType == models.SplitTypeItemized {
+			itemizedIDs = append(itemizedIDs, expense.ID)
+		}
+	}
+
+	// Get payer contributions, splits and receipt items
+	payersByExpense, err := s.expenseRepo.GetPayersByExpenseIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	splitsByExpense, err := s.expenseRepo.GetSplitsByExpenseIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	itemsByExpense, err := s.expenseRepo.GetItemsByExpenseIDs(itemizedIDs)
 	if err != nil {
 		return nil, err
 	}
 
-	// Get splits
-	splits, err := s.expenseRepo.GetSplitsByExpenseID(expense.ID)
+	// Get approval statuses
+	approvals, err := s.approvalRepo.GetByExpenseIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get everyone who recorded, paid or shares an expense
+	var userIDs []uuid.UUID
+	for _, expense := range expenses {
+		userIDs = append(userIDs, expense.PaidBy)
+		for _, p := range payersByExpense[expense.ID] {
+			userIDs = append(userIDs, p.UserID)
+		}
+		for _, split := range splitsByExpense[expense.ID] {
+			userIDs = append(userIDs, split.UserID)
+		}
+	}
+	users, err := s.userRepo.GetByIDs(userIDs)
 	if err != nil {
 		return nil, err
 	}
+	user := func(id uuid.UUID) (models.UserResponse, error) {
+		u, ok := users[id]
+		if !ok {
+			return models.UserResponse{}, repository.ErrUserNotFound
+		}
+		return u.ToResponse(), nil
+	}
 
-	// Build split details
-	var splitDetails []models.ExpenseSplitDetail
-	for _, split := range splits {
-		user, err := s.userRepo.GetByID(split.UserID)
+	responses := make([]*models.ExpenseResponse, 0, len(expenses))
+	for _, expense := range expenses {
+		payer, err := user(expense.PaidBy)
 		if err != nil {
 			return nil, err
 		}
-		splitDetails = append(splitDetails, models.ExpenseSplitDetail{
-			ID:        split.ID,
-			User:      user.ToResponse(),
-			Amount:    split.Amount,
-			Percent:   split.Percent,
-			IsSettled: split.IsSettled,
+
+		payers := payersByExpense[expense.ID]
+		payerDetails := make([]models.ExpensePayerDetail, 0, len(payers))
+		for _, p := range payers {
+			u, err := user(p.UserID)
+			if err != nil {
+				return nil, err
+			}
+			payerDetails = append(payerDetails, models.ExpensePayerDetail{
+				User:   u,
+				Amount: p.Amount,
+			})
+		}
+
+		// Build split details
+		splits := splitsByExpense[expense.ID]
+		if err := markSettled(payers, splits); err != nil {
+			return nil, err
+		}
+		var splitDetails []models.ExpenseSplitDetail
+		for _, split := range splits {
+			u, err := user(split.UserID)
+			if err != nil {
+				return nil, err
+			}
+			splitDetails = append(splitDetails, models.ExpenseSplitDetail{
+				ID:            split.ID,
+				User:          u,
+				Amount:        split.Amount,
+				Percent:       split.Percent,
+				Shares:        split.Shares,
+				IsSettled:     split.IsSettled,
+				SettledAmount: split.SettledAmount,
+			})
+		}
+
+		status := models.ApprovalStatusPending
+		if approval, ok := approvals[expense.ID]; ok {
+			status = approval.Status
+		}
+
+		responses = append(responses, &models.ExpenseResponse{
+			ID:             expense.ID,
+			TeamID:         expense.TeamID,
+			PaidBy:         payer,
+			Payers:         payerDetails,
+			Amount:         expense.Amount,
+			Currency:       expense.Currency,
+			OriginalAmount: expense.OriginalAmount,
+			ExchangeRate:   expense.ExchangeRate,
+			Tax:            expense.Tax,
+			ServiceCharge:  expense.ServiceCharge,
+			Tip:            expense.Tip,
+			Description:    expense.Description,
+			Category:       expense.Category,
+			ReceiptURL:     expense.ReceiptURL,
+			SplitType:      expense.SplitType,
+			Splits:         splitDetails,
+			Items:          itemsByExpense[expense.ID],
+			ApprovalStatus: status,
+			IncurredOn:     expense.IncurredOn,
+			CreatedAt:      expense.CreatedAt,
+
+			RecurringExpenseID: expense.RecurringExpenseID,
+			DeletedAt:          expense.DeletedAt,
+			DeletedBy:          expense.DeletedBy,
 		})
 	}
+	return responses, nil
+}
 
-	// Get approval status
-	approval, err := s.approvalRepo.GetByExpenseID(expense.ID)
-	status := models.ApprovalStatusPending
-	if err == nil && approval != nil {
-		status = approval.Status
-	}
+// exportPageSize is how many expenses an export loads at a time.
+const exportPageSize = 1000
 
-	return &models.ExpenseResponse{
-		ID:             expense.ID,
-		TeamID:         expense.TeamID,
-		PaidBy:         payer.ToResponse(),
-		Amount:         expense.Amount,
-		Description:    expense.Description,
-		Category:       expense.Category,
-		ReceiptURL:     expense.ReceiptURL,
-		SplitType:      expense.SplitType,
-		Splits:         splitDetails,
-		ApprovalStatus: status,
-		CreatedAt:      expense.CreatedAt,
-	}, nil
+// GetExpensesForExport returns all of the team's expenses matching filter
+// for an export. They are loaded a page at a time so that large teams
+// don't load every split and payer in one query.
+func (s *ExpenseService) GetExpensesForExport(teamID uuid.UUID, filter repository.ExpenseFilter) ([]*models.ExpenseResponse, error) {
+	var expenses []*models.ExpenseResponse
+	page := repository.Page{Limit: exportPageSize}
+	for {
+		batch, _, next, err := s.GetTeamExpenses(teamID, filter, page)
+		if err != nil {
+			return nil, err
+		}
+		expenses = append(expenses, batch...)
+		if next == "" {
+			return expenses, nil
+		}
+		page.Cursor = next
+	}
 }
 
-func (s *ExpenseService) GetTeamExpenses(teamID uuid.UUID, page, perPage int) ([]*models.ExpenseResponse, int64, error) {
-	if page < 1 {
-		page = 1
+// GetTeamExpenses returns a page of the team's expenses matching filter,
+// the number of matching expenses and the cursor of the next page.
+func (s *ExpenseService) GetTeamExpenses(teamID uuid.UUID, filter repository.ExpenseFilter, page repository.Page) ([]*models.ExpenseResponse, int64, string, error) {
+	if page.Limit < 1 {
+		page.Limit = 20
 	}
-	if perPage < 1 {
-		perPage = 20
+
+	expenses, total, next, err := s.expenseRepo.GetByTeamID(teamID, filter, page)
+	if err != nil {
+		return nil, 0, "", err
 	}
-	offset := (page - 1) * perPage
 
-	expenses, total, err := s.expenseRepo.GetByTeamID(teamID, perPage, offset)
+	responses, err := s.buildExpenseResponses(expenses)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, "", err
 	}
 
-	var responses []*models.ExpenseResponse
-	for _, expense := range expenses {
-		response, err := s.buildExpenseResponse(expense)
+	return responses, total, next, nil
+}
+
+func (s *ExpenseService) UpdateExpense(id uuid.UUID, req *models.ExpenseUpdateRequest, requesterID uuid.UUID, meta models.RequestMeta) (*models.ExpenseResponse, error) {
+	err := s.db.WithTx(func(tx *database.Tx) error {
+		// Balances move from the state locked here, so concurrent changes
+		// to the expense are applied one after the other
+		expense, err := s.expenseRepo.GetForUpdateTx(tx, id, false)
+		if err != nil {
+			return err
+		}
+
+		// Only the payer can update the expense
+		if expense.PaidBy != requesterID {
+			return ErrNotAuthorized
+		}
+
+		before, err := s.recorder.loadStateTx(tx, expense)
+		if err != nil {
+			return err
+		}
+		after, moneyChanged, err := s.updatedState(before, req)
 		if err != nil {
-			return nil, 0, err
+			return err
 		}
-		responses = append(responses, response)
+
+		if changesSplits(req) {
+			if err := s.saveExpenseTx(tx, after, moneyChanged); err != nil {
+				return err
+			}
+			// Balances and settlements only move with what is owed
+			if moneyChanged {
+				if err := s.updateBalancesTx(tx, before, after); err != nil {
+					return err
+				}
+			}
+		} else if err := s.expenseRepo.UpdateTx(tx, &after.Expense); err != nil {
+			return err
+		}
+		if err := s.recorder.recordRevision(tx, before, after, requesterID, req.Reason); err != nil {
+			return err
+		}
+		return s.recorder.recordAudit(tx, &after.Expense, requesterID, models.AuditExpenseUpdated, before, after, meta)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return responses, total, nil
+	return s.GetExpenseByID(id)
 }
 
-func (s *ExpenseService) UpdateExpense(id uuid.UUID, req *models.ExpenseUpdateRequest, requesterID uuid.UUID) (*models.ExpenseResponse, error) {
-	expense, err := s.expenseRepo.GetByID(id)
+// updatedState applies an update request to the before state of an
+// expense. moneyChanged reports whether what anyone paid or owes changed.
+func (s *ExpenseService) updatedState(before *models.ExpenseSnapshot, req *models.ExpenseUpdateRequest) (*models.ExpenseSnapshot, bool, error) {
+	expense := before.Expense
+	var err error
+	if req.Description != nil {
+		expense.Description = *req.Description
+	}
+	if req.Category != nil && !strings.EqualFold(*req.Category, expense.Category) {
+		expense.Category, err = s.categoryService.ResolveCategory(expense.TeamID, *req.Category)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	if req.IncurredOn != nil && !req.IncurredOn.IsZero() {
+		expense.IncurredOn = *req.IncurredOn
+	}
+
+	if !changesSplits(req) {
+		return &models.ExpenseSnapshot{Expense: expense, Payers: before.Payers, Splits: before.Splits, Items: before.Items}, false, nil
+	}
+
+	oldPayers, oldSplits, oldItems := before.Payers, before.Splits, before.Items
+
+	splitReq := splitRequestForUpdate(&expense, oldSplits, oldItems, req)
+	if !isValidSplitType(splitReq.SplitType) {
+		return nil, false, ErrInvalidSplitType
+	}
+	var items []models.ExpenseItem
+	if splitReq.SplitType == models.SplitTypeItemized {
+		items = itemsFromRequest(splitReq.Items)
+		if req.Amount == nil {
+			splitReq.Amount = itemizedTotal(items, splitReq.Tax, splitReq.ServiceCharge, splitReq.Tip)
+		}
+	}
+	if splitReq.Amount <= 0 {
+		return nil, false, ErrAmountRequired
+	}
+	if len(splitReq.SplitWith) == 0 && splitReq.SplitType != models.SplitTypeItemized {
+		return nil, false, ErrSplitWithRequired
+	}
+
+	// The amount is given in the expense's original currency and is
+	// converted with the rate stored when the expense was created.
+	oldAmount := expense.Amount
+	expense.OriginalAmount = splitReq.Amount
+	amount, err := splitReq.Amount.Convert(expense.ExchangeRate)
 	if err != nil {
-		return nil, err
+		return nil, false, ErrAmountTooLarge
+	}
+	expense.Amount = amount
+	expense.SplitType = splitReq.SplitType
+	expense.Tax = splitReq.Tax
+	expense.ServiceCharge = splitReq.ServiceCharge
+	expense.Tip = splitReq.Tip
+
+	payers, err := payersForUpdate(oldPayers, req.Payers, &expense, oldAmount)
+	if err != nil {
+		return nil, false, err
+	}
+	payersChanged := !samePayers(oldPayers, payers)
+
+	splits, err := s.calculateSplits(&expense, splitReq)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := convertSplits(splits, expense.Amount); err != nil {
+		return nil, false, err
 	}
+	moneyChanged := reconcileSplits(oldSplits, splits) || expense.Amount != oldAmount || payersChanged
 
-	// Only the payer can update the expense
-	if expense.PaidBy != requesterID {
-		return nil, ErrNotAuthorized
+	return &models.ExpenseSnapshot{Expense: expense, Payers: payers, Splits: splits, Items: items}, moneyChanged, nil
+}
+
+// updateBalancesTx moves the team's balances from what the expense owed in
+// its before state to what it owes after, using q, and applies the
+// settlements between the members involved to their splits again. before
+// is nil for new and restored expenses, after for deleted ones.
+func (s *ExpenseService) updateBalancesTx(q database.Querier, before, after *models.ExpenseSnapshot) error {
+	changes := make(balanceChanges)
+	var teamID uuid.UUID
+	if before != nil {
+		if err := changes.addExpense(before.Payers, before.Splits, -1); err != nil {
+			return err
+		}
+		teamID = before.Expense.TeamID
+	}
+	if after != nil {
+		if err := changes.addExpense(after.Payers, after.Splits, 1); err != nil {
+			return err
+		}
+		teamID = after.Expense.TeamID
+	}
+	if err := changes.applyTx(s.balanceRepo, q, teamID); err != nil {
+		return err
 	}
+	return s.allocator.reallocateExpenseTx(q, before, after)
+}
 
+// saveExpenseTx writes the expense with its payers, splits and items using
+// q. A changed amount or split needs to be approved again.
+func (s *ExpenseService) saveExpenseTx(q database.Querier, state *models.ExpenseSnapshot, moneyChanged bool) error {
+	expense := &state.Expense
+	if err := s.expenseRepo.UpdateTx(q, expense); err != nil {
+		return err
+	}
+	if err := s.expenseRepo.ReplacePayersTx(q, expense.ID, state.Payers); err != nil {
+		return err
+	}
+	if err := s.expenseRepo.ReplaceSplitsTx(q, expense.ID, state.Splits); err != nil {
+		return err
+	}
+	if err := s.expenseRepo.ReplaceItemsTx(q, expense.ID, state.Items); err != nil {
+		return err
+	}
+	if moneyChanged {
+		return s.approvalRepo.ResetToPendingTx(q, expense.ID)
+	}
+	return nil
+}
+
+// changesSplits reports whether an update touches anything that affects how
+// the expense is divided.
+func changesSplits(req *models.ExpenseUpdateRequest) bool {
+	return req.Amount != nil || req.Payers != nil || req.SplitType != nil || req.SplitWith != nil || req.CustomSplit != nil ||
+		req.Items != nil || req.Tax != nil || req.ServiceCharge != nil || req.Tip != nil
+}
+
+// splitRequestForUpdate merges an update into the expense's current split
+// configuration, giving a request calculateSplits can recompute from.
+// Participants, percentages, share weights and items are taken from the
+// stored splits when the update doesn't replace them.
+func splitRequestForUpdate(expense *models.Expense, splits []models.ExpenseSplit, items []models.ExpenseItem, req *models.ExpenseUpdateRequest) *models.ExpenseCreateRequest {
+	splitReq := &models.ExpenseCreateRequest{
+		Amount:      expense.OriginalAmount,
+		SplitType:   expense.SplitType,
+		SplitWith:   req.SplitWith,
+		CustomSplit: req.CustomSplit,
+		Items:       req.Items,
+	}
 	if req.Amount != nil {
-		expense.Amount = *req.Amount
+		splitReq.Amount = *req.Amount
 	}
-	if req.Description != nil {
-		expense.Description = *req.Description
+	if req.SplitType != nil {
+		splitReq.SplitType = *req.SplitType
 	}
-	if req.Category != nil {
-		expense.Category = *req.Category
+
+	if splitReq.SplitWith == nil {
+		for _, split := range splits {
+			splitReq.SplitWith = append(splitReq.SplitWith, split.UserID)
+		}
+	}
+	if splitReq.CustomSplit == nil && splitReq.SplitType == expense.SplitType {
+		for _, split := range splits {
+			switch expense.SplitType {
+			case models.SplitTypePercent:
+				splitReq.CustomSplit = append(splitReq.CustomSplit, models.CustomSplitEntry{UserID: split.UserID, Percent: split.Percent})
+			case models.SplitTypeShares:
+				splitReq.CustomSplit = append(splitReq.CustomSplit, models.CustomSplitEntry{UserID: split.UserID, Shares: split.Shares})
+			}
+		}
 	}
 
-	if err := s.expenseRepo.Update(expense); err != nil {
-		return nil, err
+	if splitReq.SplitType == models.SplitTypeItemized {
+		if splitReq.Items == nil {
+			for _, item := range items {
+				splitReq.Items = append(splitReq.Items, models.ExpenseItemEntry{
+					Description: item.Description,
+					Amount:      item.Amount,
+					AssignedTo:  item.AssignedTo,
+				})
+			}
+		}
+		splitReq.Tax = pickMoney(req.Tax, expense.Tax)
+		splitReq.ServiceCharge = pickMoney(req.ServiceCharge, expense.ServiceCharge)
+		splitReq.Tip = pickMoney(req.Tip, expense.Tip)
+	}
+	return splitReq
+}
+
+func pickMoney(update *models.Money, current models.Money) models.Money {
+	if update != nil {
+		return *update
 	}
+	return current
+}
 
-	return s.GetExpenseByID(id)
+// payersForUpdate returns the payer contributions after an update. A sole
+// payer keeps paying the full amount; several payers must be given again if
+// the amount changed.
+func payersForUpdate(oldPayers []models.ExpensePayer, entries []models.PayerEntry, expense *models.Expense, oldAmount models.Money) ([]models.ExpensePayer, error) {
+	if entries != nil {
+		return buildPayers(entries, expense.PaidBy, expense)
+	}
+	if len(oldPayers) == 1 {
+		return []models.ExpensePayer{{UserID: oldPayers[0].UserID, Amount: expense.Amount}}, nil
+	}
+	if expense.Amount != oldAmount {
+		return nil, ErrInvalidPayers
+	}
+	return oldPayers, nil
 }
 
-func (s *ExpenseService) DeleteExpense(id uuid.UUID, requesterID uuid.UUID) error {
-	expense, err := s.expenseRepo.GetByID(id)
-	if err != nil {
-		return err
+func samePayers(a, b []models.ExpensePayer) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].UserID != b[i].UserID || a[i].Amount != b[i].Amount {
+			return false
+		}
 	}
+	return true
+}
 
-	// Only the payer can delete the expense
-	if expense.PaidBy != requesterID {
-		return ErrNotAuthorized
+// reconcileSplits matches recomputed splits to the existing ones by user so
+// they keep their IDs, and the settlements applied to them. It reports
+// whether any participant or amount changed.
+func reconcileSplits(oldSplits, newSplits []models.ExpenseSplit) bool {
+	byUser := make(map[uuid.UUID]models.ExpenseSplit, len(oldSplits))
+	for _, split := range oldSplits {
+		byUser[split.UserID] = split
 	}
 
-	return s.expenseRepo.Delete(id)
+	changed := len(oldSplits) != len(newSplits)
+	for i := range newSplits {
+		old, ok := byUser[newSplits[i].UserID]
+		if !ok {
+			changed = true
+			continue
+		}
+		newSplits[i].ID = old.ID
+		if old.Amount != newSplits[i].Amount {
+			changed = true
+		}
+	}
+	return changed
 }
 
-func (s *ExpenseService) UpdateReceiptURL(id uuid.UUID, receiptURL string) error {
-	expense, err := s.expenseRepo.GetByID(id)
+func (s *ExpenseService) DeleteExpense(id uuid.UUID, requesterID uuid.UUID, meta models.RequestMeta) error {
+	return s.db.WithTx(func(tx *database.Tx) error {
+		expense, err := s.expenseRepo.GetForUpdateTx(tx, id, false)
+		if err != nil {
+			return err
+		}
+
+		// Only the payer can delete the expense
+		if expense.PaidBy != requesterID {
+			return ErrNotAuthorized
+		}
+
+		before, err := s.recorder.loadStateTx(tx, expense)
+		if err != nil {
+			return err
+		}
+		if err := s.expenseRepo.DeleteTx(tx, id, requesterID); err != nil {
+			return err
+		}
+		if err := s.updateBalancesTx(tx, before, nil); err != nil {
+			return err
+		}
+		return s.recorder.recordAudit(tx, expense, requesterID, models.AuditExpenseDeleted, before, nil, meta)
+	})
+}
+
+// RestoreExpense takes an expense back out of the trash.
+func (s *ExpenseService) RestoreExpense(id uuid.UUID, requesterID uuid.UUID, meta models.RequestMeta) (*models.ExpenseResponse, error) {
+	err := s.db.WithTx(func(tx *database.Tx) error {
+		expense, err := s.expenseRepo.GetForUpdateTx(tx, id, true)
+		if err != nil {
+			return err
+		}
+
+		// Only the payer can restore the expense
+		if expense.PaidBy != requesterID {
+			return ErrNotAuthorized
+		}
+
+		after, err := s.recorder.loadStateTx(tx, expense)
+		if err != nil {
+			return err
+		}
+		after.Expense.DeletedAt = nil
+		after.Expense.DeletedBy = nil
+		if err := s.expenseRepo.RestoreTx(tx, id); err != nil {
+			return err
+		}
+		if err := s.updateBalancesTx(tx, nil, after); err != nil {
+			return err
+		}
+		return s.recorder.recordAudit(tx, expense, requesterID, models.AuditExpenseRestored, nil, after, meta)
+	})
 	if err != nil {
+		return nil, err
+	}
+	return s.GetExpenseByID(id)
+}
+
+// PurgeTrash permanently removes expenses that have been in the trash for
+// longer than retention. Their revisions are kept, with expenses entered
+// before revisions were kept getting their last state as one, so balances
+// as of before they were deleted still count them.
+func (s *ExpenseService) PurgeTrash(retention time.Duration) (int64, error) {
+	var purged int64
+	err := s.db.WithTx(func(tx *database.Tx) error {
+		expenses, err := s.expenseRepo.GetDeletedBeforeForUpdateTx(tx, time.Now().Add(-retention))
+		if err != nil {
+			return err
+		}
+		ids := make([]uuid.UUID, len(expenses))
+		for i, expense := range expenses {
+			state, err := s.recorder.loadStateTx(tx, expense)
+			if err != nil {
+				return err
+			}
+			if err := s.recorder.keepInitialRevision(tx, state); err != nil {
+				return err
+			}
+			ids[i] = expense.ID
+		}
+		purged, err = s.expenseRepo.PurgeTx(tx, ids)
 		return err
+	})
+	return purged, err
+}
+
+// StartTrashPurger purges the trash right away and then once every interval.
+// It never returns, so run it in its own goroutine.
+func (s *ExpenseService) StartTrashPurger(retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := s.PurgeTrash(retention)
+		if err != nil {
+			log.Printf("Trash purge failed: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d expenses from the trash", purged)
+		}
+		<-ticker.C
 	}
-	expense.ReceiptURL = receiptURL
-	return s.expenseRepo.Update(expense)
 }
 
-func (s *ExpenseService) MarkSplitAsSettled(splitID uuid.UUID) error {
-	return s.expenseRepo.MarkSplitAsSettled(splitID)
+func (s *ExpenseService) UpdateReceiptURL(id uuid.UUID, receiptURL string) error {
+	return s.db.WithTx(func(tx *database.Tx) error {
+		// Locked so a concurrent edit isn't overwritten with the old amounts
+		expense, err := s.expenseRepo.GetForUpdateTx(tx, id, false)
+		if err != nil {
+			return err
+		}
+		expense.ReceiptURL = receiptURL
+		return s.expenseRepo.UpdateTx(tx, expense)
+	})
 }
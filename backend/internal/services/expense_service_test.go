@@ -0,0 +1,70 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestCalculateSplitsRejectsNegativeEntries(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+	tests := []struct {
+		name  string
+		req   models.ExpenseCreateRequest
+		error error
+	}{
+		{
+			name: "negative percent",
+			req: models.ExpenseCreateRequest{
+				SplitType:   models.SplitTypePercent,
+				CustomSplit: []models.CustomSplitEntry{{UserID: a, Percent: -50}, {UserID: b, Percent: 150}},
+			},
+			error: ErrInvalidPercentSplit,
+		},
+		{
+			name: "negative shares",
+			req: models.ExpenseCreateRequest{
+				SplitType:   models.SplitTypeShares,
+				CustomSplit: []models.CustomSplitEntry{{UserID: a, Shares: -1}, {UserID: b, Shares: 2}},
+			},
+			error: ErrInvalidShareSplit,
+		},
+		{
+			name: "negative custom amount",
+			req: models.ExpenseCreateRequest{
+				SplitType:   models.SplitTypeCustom,
+				CustomSplit: []models.CustomSplitEntry{{UserID: a, Amount: -5000}, {UserID: b, Amount: 15000}},
+			},
+			error: ErrInvalidCustomSplit,
+		},
+	}
+
+	s := &ExpenseService{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expense := &models.Expense{Amount: 10000, OriginalAmount: 10000}
+			splits, err := s.calculateSplits(expense, &tt.req)
+			if err != tt.error {
+				t.Fatalf("calculateSplits() = %v, %v, want error %v", splits, err, tt.error)
+			}
+		})
+	}
+}
+
+func TestCalculateSplitsPercent(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+	req := &models.ExpenseCreateRequest{
+		SplitType:   models.SplitTypePercent,
+		CustomSplit: []models.CustomSplitEntry{{UserID: a, Percent: 33.33}, {UserID: b, Percent: 66.67}},
+	}
+	expense := &models.Expense{Amount: 10000, OriginalAmount: 10000}
+
+	splits, err := (&ExpenseService{}).calculateSplits(expense, req)
+	if err != nil {
+		t.Fatalf("calculateSplits() returned %v", err)
+	}
+	if len(splits) != 2 || splits[0].Amount != 3333 || splits[1].Amount != 6667 {
+		t.Fatalf("calculateSplits() = %+v, want 33.33 and 66.67", splits)
+	}
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"sort"
+
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/expensesplit/backend/internal/repository"
+	"github.com/google/uuid"
+)
+
+// HaveHistory reports whether userID and otherID have expenses or
+// settlements with each other in the team, so that a ledger between them
+// has something to show even if one of them has left.
+func (s *BalanceService) HaveHistory(teamID, userID, otherID uuid.UUID) (bool, error) {
+	return s.balanceRepo.HaveHistory(teamID, userID, otherID)
+}
+
+// GetLedger lists every expense split and confirmed settlement between
+// userID and otherID, oldest first, with the running balance between them.
+// Shares are worked out as for the stored balances, so the final balance
+// matches what CalculateBalances shows for the pair.
+func (s *BalanceService) GetLedger(teamID, userID, otherID uuid.UUID) (*models.Ledger, error) {
+	team, err := s.teamRepo.GetByID(teamID)
+	if err != nil {
+		return nil, err
+	}
+	users, err := s.userRepo.GetByIDs([]uuid.UUID{userID, otherID})
+	if err != nil {
+		return nil, err
+	}
+	user, ok := users[userID]
+	if !ok {
+		return nil, repository.ErrUserNotFound
+	}
+	other, ok := users[otherID]
+	if !ok {
+		return nil, repository.ErrUserNotFound
+	}
+
+	expenses, err := s.expenseRepo.GetAllByTeamID(teamID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uuid.UUID, len(expenses))
+	for i, expense := range expenses {
+		ids[i] = expense.ID
+	}
+	payers, err := s.expenseRepo.GetPayersByExpenseIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	splits, err := s.expenseRepo.GetSplitsByExpenseIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	// owed is what the pair owe each other on changes, from userID's side
+	owed := func(changes balanceChanges) models.Money {
+		return changes[balanceKey{from: otherID, to: userID}] - changes[balanceKey{from: userID, to: otherID}]
+	}
+
+	entries := []models.LedgerEntry{}
+	for _, expense := range expenses {
+		if err := markSettled(payers[expense.ID], splits[expense.ID]); err != nil {
+			return nil, err
+		}
+		for _, split := range splits[expense.ID] {
+			if split.UserID != userID && split.UserID != otherID {
+				continue
+			}
+			changes := make(balanceChanges)
+			if err := changes.addExpense(payers[expense.ID], []models.ExpenseSplit{split}, 1); err != nil {
+				return nil, err
+			}
+			amount := owed(changes)
+			if amount == 0 {
+				continue
+			}
+			entries = append(entries, models.LedgerEntry{
+				Type:        models.LedgerEntryExpense,
+				ID:          expense.ID,
+				Date:        expense.IncurredOn,
+				Description: expense.Description,
+				Amount:      amount,
+				Settled:     split.IsSettled,
+				CreatedAt:   expense.CreatedAt,
+			})
+		}
+	}
+
+	settlements, err := s.settlementRepo.GetByUsers(teamID, userID, otherID)
+	if err != nil {
+		return nil, err
+	}
+	for _, settlement := range settlements {
+		if settlement.Status != models.SettlementStatusConfirmed {
+			continue
+		}
+		changes := make(balanceChanges)
+		changes.addSettlement(settlement)
+		description := "Payment from " + user.Name + " to " + other.Name
+		if settlement.FromUser == otherID {
+			description = "Payment from " + other.Name + " to " + user.Name
+		}
+		if settlement.ReversesID != nil {
+			description = "Reversal: " + description
+		}
+		entries = append(entries, models.LedgerEntry{
+			Type:        models.LedgerEntrySettlement,
+			ID:          settlement.ID,
+			Date:        models.NewDate(settlement.CreatedAt),
+			Description: description,
+			Amount:      owed(changes),
+			CreatedAt:   settlement.CreatedAt,
+		})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].Date.Equal(entries[j].Date.Time) {
+			return entries[i].Date.Before(entries[j].Date.Time)
+		}
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+
+	var balance models.Money
+	for i := range entries {
+		balance += entries[i].Amount
+		entries[i].Balance = balance
+	}
+
+	return &models.Ledger{
+		TeamID:   teamID,
+		Currency: team.BaseCurrency,
+		User:     user.ToResponse(),
+		With:     other.ToResponse(),
+		Entries:  entries,
+		Balance:  balance,
+	}, nil
+}
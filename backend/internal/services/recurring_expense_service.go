@@ -0,0 +1,265 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/expensesplit/backend/internal/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidFrequency = errors.New("frequency must be weekly, monthly or yearly")
+	ErrInvalidSchedule  = errors.New("interval must be at least 1, day_of_month between 1 and 31 and end_date not before start_date")
+)
+
+type RecurringExpenseService struct {
+	recurringRepo   *repository.RecurringExpenseRepository
+	expenseService  *ExpenseService
+	categoryService *CategoryService
+}
+
+func NewRecurringExpenseService(
+	recurringRepo *repository.RecurringExpenseRepository,
+	expenseService *ExpenseService,
+	categoryService *CategoryService,
+) *RecurringExpenseService {
+	return &RecurringExpenseService{
+		recurringRepo:   recurringRepo,
+		expenseService:  expenseService,
+		categoryService: categoryService,
+	}
+}
+
+func (s *RecurringExpenseService) Create(teamID, createdBy uuid.UUID, req *models.RecurringExpenseRequest) (*models.RecurringExpense, error) {
+	recurring := &models.RecurringExpense{
+		TeamID:    teamID,
+		CreatedBy: createdBy,
+	}
+	if err := applyRecurringRequest(recurring, req); err != nil {
+		return nil, err
+	}
+	if err := s.resolveTemplateCategory(recurring); err != nil {
+		return nil, err
+	}
+	recurring.NextOccurrence = nextScheduled(recurring, recurring.FirstOccurrence())
+
+	if err := s.recurringRepo.Create(recurring); err != nil {
+		return nil, err
+	}
+	return recurring, nil
+}
+
+func (s *RecurringExpenseService) GetByID(teamID, id uuid.UUID) (*models.RecurringExpense, error) {
+	recurring, err := s.recurringRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if recurring.TeamID != teamID {
+		return nil, repository.ErrRecurringExpenseNotFound
+	}
+	return recurring, nil
+}
+
+func (s *RecurringExpenseService) GetTeamRecurringExpenses(teamID uuid.UUID) ([]*models.RecurringExpense, error) {
+	return s.recurringRepo.GetByTeamID(teamID)
+}
+
+// Update replaces the template and schedule. Occurrences that were already
+// created are kept; the schedule continues from the next pending
+// occurrence, or from today if it had ended.
+func (s *RecurringExpenseService) Update(teamID, id uuid.UUID, req *models.RecurringExpenseRequest, requesterID uuid.UUID) (*models.RecurringExpense, error) {
+	recurring, err := s.GetByID(teamID, id)
+	if err != nil {
+		return nil, err
+	}
+	if recurring.CreatedBy != requesterID {
+		return nil, ErrNotAuthorized
+	}
+
+	from := models.Today()
+	if recurring.NextOccurrence != nil && recurring.NextOccurrence.Before(from.Time) {
+		from = *recurring.NextOccurrence
+	}
+	if err := applyRecurringRequest(recurring, req); err != nil {
+		return nil, err
+	}
+	if err := s.resolveTemplateCategory(recurring); err != nil {
+		return nil, err
+	}
+
+	next := recurring.FirstOccurrence()
+	for next.Before(from.Time) {
+		next = recurring.OccurrenceAfter(next)
+	}
+	recurring.NextOccurrence = nextScheduled(recurring, next)
+
+	if err := s.recurringRepo.Update(recurring); err != nil {
+		return nil, err
+	}
+	return recurring, nil
+}
+
+// Delete removes the recurring expense. Expenses it already created are kept.
+func (s *RecurringExpenseService) Delete(teamID, id uuid.UUID, requesterID uuid.UUID) error {
+	recurring, err := s.GetByID(teamID, id)
+	if err != nil {
+		return err
+	}
+	if recurring.CreatedBy != requesterID {
+		return ErrNotAuthorized
+	}
+	return s.recurringRepo.Delete(id)
+}
+
+// applyRecurringRequest validates the request and copies it onto recurring.
+func applyRecurringRequest(recurring *models.RecurringExpense, req *models.RecurringExpenseRequest) error {
+	switch req.Frequency {
+	case models.FrequencyWeekly, models.FrequencyMonthly, models.FrequencyYearly:
+	default:
+		return ErrInvalidFrequency
+	}
+
+	interval := req.Interval
+	if interval == 0 {
+		interval = 1
+	}
+	startDate := models.Today()
+	if req.StartDate != nil && !req.StartDate.IsZero() {
+		startDate = *req.StartDate
+	}
+	if interval < 1 || req.DayOfMonth < 0 || req.DayOfMonth > 31 ||
+		(req.EndDate != nil && req.EndDate.Before(startDate.Time)) {
+		return ErrInvalidSchedule
+	}
+
+	template := req.Template
+	if err := validateTemplate(&template); err != nil {
+		return err
+	}
+
+	recurring.Template = template
+	recurring.Frequency = req.Frequency
+	recurring.Interval = interval
+	recurring.DayOfMonth = req.DayOfMonth
+	if req.Frequency != models.FrequencyMonthly {
+		recurring.DayOfMonth = 0
+	}
+	recurring.StartDate = startDate
+	recurring.EndDate = req.EndDate
+	return nil
+}
+
+// validateTemplate runs the checks CreateExpense can make without a date, so
+// that most invalid templates are rejected up front instead of failing on
+// every scheduler run. The date comes from each occurrence.
+func validateTemplate(template *models.ExpenseCreateRequest) error {
+	template.IncurredOn = nil
+	if template.SplitType == "" {
+		template.SplitType = models.SplitTypeEqual
+	}
+	if !isValidSplitType(template.SplitType) {
+		return ErrInvalidSplitType
+	}
+	if template.SplitType == models.SplitTypeItemized {
+		return nil
+	}
+	if template.Amount <= 0 {
+		return ErrAmountRequired
+	}
+	if len(template.SplitWith) == 0 {
+		return ErrSplitWithRequired
+	}
+	return nil
+}
+
+func (s *RecurringExpenseService) resolveTemplateCategory(recurring *models.RecurringExpense) error {
+	category, err := s.categoryService.ResolveCategory(recurring.TeamID, recurring.Template.Category)
+	if err != nil {
+		return err
+	}
+	recurring.Template.Category = category
+	return nil
+}
+
+// nextScheduled returns day, or nil if it is past the end of the schedule.
+func nextScheduled(recurring *models.RecurringExpense, day models.Date) *models.Date {
+	if recurring.EndDate != nil && day.After(recurring.EndDate.Time) {
+		return nil
+	}
+	return &day
+}
+
+// RunDue creates the expenses of all occurrences up to and including today
+// that have not been created yet, and returns how many it created.
+//
+// Every occurrence is created through ExpenseService.CreateExpense, tagged
+// with its recurring expense and date. The database refuses a second
+// expense for the same occurrence, so running this concurrently on several
+// instances, or again after a crash, never creates duplicates.
+func (s *RecurringExpenseService) RunDue(today models.Date) (int, error) {
+	due, err := s.recurringRepo.GetDue(today)
+	if err != nil {
+		return 0, err
+	}
+
+	created := 0
+	for _, recurring := range due {
+		n, err := s.materialize(recurring, today)
+		created += n
+		if err != nil {
+			// Leave the occurrence pending so it is retried on the next run
+			log.Printf("Failed to create recurring expense %s: %v", recurring.ID, err)
+		}
+	}
+	return created, nil
+}
+
+func (s *RecurringExpenseService) materialize(recurring *models.RecurringExpense, today models.Date) (int, error) {
+	created := 0
+	for recurring.NextOccurrence != nil && !recurring.NextOccurrence.After(today.Time) {
+		occurrence := *recurring.NextOccurrence
+
+		req := recurring.Template
+		req.IncurredOn = &occurrence
+		req.RecurringExpenseID = &recurring.ID
+		req.OccurrenceDate = occurrence
+		_, err := s.expenseService.CreateExpense(recurring.TeamID, recurring.CreatedBy, &req, models.RequestMeta{})
+		if err == nil {
+			created++
+		} else if err != repository.ErrOccurrenceExists {
+			return created, err
+		}
+
+		next := nextScheduled(recurring, recurring.OccurrenceAfter(occurrence))
+		advanced, err := s.recurringRepo.Advance(recurring.ID, occurrence, next)
+		if err != nil {
+			return created, err
+		}
+		if !advanced {
+			// Another instance is processing this recurring expense
+			return created, nil
+		}
+		recurring.NextOccurrence = next
+	}
+	return created, nil
+}
+
+// StartScheduler creates due recurring expenses right away and then once
+// every interval. It never returns, so run it in its own goroutine.
+func (s *RecurringExpenseService) StartScheduler(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		created, err := s.RunDue(models.Today())
+		if err != nil {
+			log.Printf("Recurring expense scheduler failed: %v", err)
+		} else if created > 0 {
+			log.Printf("Created %d recurring expenses", created)
+		}
+		<-ticker.C
+	}
+}
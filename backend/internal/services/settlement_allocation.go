@@ -0,0 +1,414 @@
+package services
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/expensesplit/backend/internal/database"
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/expensesplit/backend/internal/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrSplitSettled        = errors.New("split is already settled")
+	ErrSplitNotSettled     = errors.New("split is not settled")
+	ErrNothingOwed         = errors.New("nothing is owed on this split")
+	ErrSplitPaymentPending = errors.New("a payment for this split is waiting for confirmation")
+	ErrSplitPaidByOthers   = errors.New("split was paid off by a settlement covering other splits too, reverse that settlement instead")
+)
+
+// applySettlementTx makes a confirmed settlement count using q: it reduces
+// what its payer owes its recipient and pays off the payer's splits with
+// it. A confirmed reversal instead takes back what the reversed settlement
+// paid off.
+func (s *BalanceService) applySettlementTx(q database.Querier, settlement *models.Settlement) error {
+	if err := s.balanceRepo.LockForWriteTx(q, settlement.TeamID); err != nil {
+		return err
+	}
+	err := s.balanceRepo.AddTx(q, settlement.TeamID, settlement.FromUser, settlement.ToUser, -settlement.Amount)
+	if err != nil {
+		return err
+	}
+
+	if settlement.ReversesID == nil {
+		return s.allocator.allocateTx(q, settlement.TeamID, settlement.FromUser, settlement.ToUser)
+	}
+	// Other payments may now go towards what the reversed one paid off
+	return s.allocator.reallocateTx(q, settlement.TeamID, settlement.ToUser, settlement.FromUser)
+}
+
+// splitAllocator applies confirmed settlements to the splits they pay off.
+// Settlements change what is paid off and expense changes what is owed, so
+// both the balance and the expense service use it in their transactions.
+type splitAllocator struct {
+	expenseRepo    *repository.ExpenseRepository
+	settlementRepo *repository.SettlementRepository
+}
+
+// owedSplit is a split with what it still owes one creditor.
+type owedSplit struct {
+	split models.ExpenseSplit
+	owed  models.Money
+}
+
+// allocateTx applies the confirmed settlements from debtor to creditor that
+// haven't been used up yet to the debtor's splits owed to the creditor,
+// oldest expense first, using q. A settlement made for one split goes to
+// that split first.
+func (a splitAllocator) allocateTx(q database.Querier, teamID, debtor, creditor uuid.UUID) error {
+	if err := a.settlementRepo.LockPairTx(q, teamID, debtor, creditor); err != nil {
+		return err
+	}
+	credits, err := a.settlementRepo.GetCreditsTx(q, teamID, debtor, creditor)
+	if err != nil || len(credits) == 0 {
+		return err
+	}
+	owed, err := a.owedSplitsTx(q, teamID, debtor, creditor)
+	if err != nil {
+		return err
+	}
+
+	for _, credit := range credits {
+		order := make([]*owedSplit, 0, len(owed))
+		for i := range owed {
+			if credit.SplitID != nil && owed[i].split.ID == *credit.SplitID {
+				order = append([]*owedSplit{&owed[i]}, order...)
+			} else {
+				order = append(order, &owed[i])
+			}
+		}
+
+		for _, o := range order {
+			if credit.Amount == 0 {
+				break
+			}
+			amount := o.owed
+			if credit.Amount < amount {
+				amount = credit.Amount
+			}
+			if amount <= 0 {
+				continue
+			}
+
+			allocation := &models.SettlementAllocation{
+				SettlementID: credit.SettlementID,
+				SplitID:      o.split.ID,
+				ExpenseID:    o.split.ExpenseID,
+				Amount:       amount,
+			}
+			if err := a.settlementRepo.CreateAllocationTx(q, allocation); err != nil {
+				return err
+			}
+			credit.Amount -= amount
+			o.owed -= amount
+		}
+	}
+	return nil
+}
+
+// reallocateTx takes back everything the settlements from debtor to
+// creditor paid off and applies them again from scratch using q, for when
+// what the debtor owes the creditor changed.
+func (a splitAllocator) reallocateTx(q database.Querier, teamID, debtor, creditor uuid.UUID) error {
+	if err := a.settlementRepo.LockPairTx(q, teamID, debtor, creditor); err != nil {
+		return err
+	}
+	if err := a.settlementRepo.DeleteAllocationsBetweenTx(q, teamID, debtor, creditor); err != nil {
+		return err
+	}
+	return a.allocateTx(q, teamID, debtor, creditor)
+}
+
+// reallocateExpenseTx reallocates the settlements between every pair of
+// members the expense involves, before or after a change, using q. before
+// is nil for new and restored expenses, after for deleted ones. Splits of
+// expenses that come before the expense keep what was applied to them, so
+// only the expense and those after it are paid off again. Pairs are taken
+// in a fixed order so concurrent changes lock them in the same order.
+func (a splitAllocator) reallocateExpenseTx(q database.Querier, before, after *models.ExpenseSnapshot) error {
+	involved := make(balanceChanges)
+	var teamID uuid.UUID
+	var earliest *models.Expense
+	for _, state := range []*models.ExpenseSnapshot{before, after} {
+		if state == nil {
+			continue
+		}
+		if err := involved.addExpense(state.Payers, state.Splits, 1); err != nil {
+			return err
+		}
+		teamID = state.Expense.TeamID
+		if earliest == nil || allocatedBefore(&state.Expense, earliest) {
+			earliest = &state.Expense
+		}
+	}
+
+	pairs := make([]balanceKey, 0, len(involved))
+	for key := range involved {
+		pairs = append(pairs, key)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].from != pairs[j].from {
+			return pairs[i].from.String() < pairs[j].from.String()
+		}
+		return pairs[i].to.String() < pairs[j].to.String()
+	})
+	for _, pair := range pairs {
+		if err := a.settlementRepo.LockPairTx(q, teamID, pair.from, pair.to); err != nil {
+			return err
+		}
+		err := a.settlementRepo.DeleteAllocationsBetweenFromTx(q, teamID, pair.from, pair.to, earliest)
+		if err != nil {
+			return err
+		}
+		if err := a.allocateTx(q, teamID, pair.from, pair.to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allocatedBefore reports whether settlements pay off expense x before y,
+// i.e. whether x was incurred earlier, or entered earlier on the same day.
+func allocatedBefore(x, y *models.Expense) bool {
+	if !x.IncurredOn.Equal(y.IncurredOn.Time) {
+		return x.IncurredOn.Before(y.IncurredOn.Time)
+	}
+	return x.CreatedAt.Before(y.CreatedAt)
+}
+
+// owedSplitsTx lists the debtor's splits that still owe the creditor
+// something, oldest expense first, using q.
+func (a splitAllocator) owedSplitsTx(q database.Querier, teamID, debtor, creditor uuid.UUID) ([]owedSplit, error) {
+	splits, err := a.expenseRepo.GetUnsettledSplitsByUserTx(q, teamID, debtor)
+	if err != nil {
+		return nil, err
+	}
+	expenseIDs := make([]uuid.UUID, len(splits))
+	splitIDs := make([]uuid.UUID, len(splits))
+	for i, split := range splits {
+		expenseIDs[i] = split.ExpenseID
+		splitIDs[i] = split.ID
+	}
+	payers, err := a.expenseRepo.GetPayersByExpenseIDsTx(q, expenseIDs)
+	if err != nil {
+		return nil, err
+	}
+	allocated, err := a.settlementRepo.GetAllocatedToTx(q, splitIDs, creditor)
+	if err != nil {
+		return nil, err
+	}
+
+	var owed []owedSplit
+	for _, split := range splits {
+		shares, err := splitShares(payers[split.ExpenseID], split)
+		if err != nil {
+			return nil, err
+		}
+		if remaining := shares[creditor] - allocated[split.ID]; remaining > 0 {
+			owed = append(owed, owedSplit{split: split, owed: remaining})
+		}
+	}
+	return owed, nil
+}
+
+// splitShares is what a split owes each payer of its expense, worked out as
+// for balances.
+func splitShares(payers []models.ExpensePayer, split models.ExpenseSplit) (map[uuid.UUID]models.Money, error) {
+	changes := make(balanceChanges)
+	if err := changes.addExpense(payers, []models.ExpenseSplit{split}, 1); err != nil {
+		return nil, err
+	}
+	shares := make(map[uuid.UUID]models.Money, len(changes))
+	for key, amount := range changes {
+		shares[key.to] = amount
+	}
+	return shares, nil
+}
+
+func sumShares(shares map[uuid.UUID]models.Money) models.Money {
+	var total models.Money
+	for _, amount := range shares {
+		total += amount
+	}
+	return total
+}
+
+// markSettled sets IsSettled on each split once settlements have paid off
+// everything it owes the other payers of its expense. A sole payer's own
+// share owes nobody and is always settled.
+func markSettled(payers []models.ExpensePayer, splits []models.ExpenseSplit) error {
+	for i := range splits {
+		shares, err := splitShares(payers, splits[i])
+		if err != nil {
+			return err
+		}
+		splits[i].IsSettled = splits[i].SettledAmount >= sumShares(shares)
+	}
+	return nil
+}
+
+// getTeamSplitTx gets a split of an expense of the team using q, with
+// IsSettled set. The split stays locked until the transaction ends.
+func (s *BalanceService) getTeamSplitTx(q database.Querier, teamID, expenseID, splitID uuid.UUID) (*models.ExpenseSplit, []models.ExpensePayer, error) {
+	split, err := s.expenseRepo.GetSplitForUpdateTx(q, splitID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if split.ExpenseID != expenseID {
+		return nil, nil, repository.ErrSplitNotFound
+	}
+	expense, err := s.expenseRepo.GetByIDTx(q, expenseID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if expense.TeamID != teamID {
+		return nil, nil, repository.ErrSplitNotFound
+	}
+	payers, err := s.expenseRepo.GetPayersByExpenseIDTx(q, expenseID)
+	if err != nil {
+		return nil, nil, err
+	}
+	splits := []models.ExpenseSplit{*split}
+	if err := markSettled(payers, splits); err != nil {
+		return nil, nil, err
+	}
+	return &splits[0], payers, nil
+}
+
+// SettleSplit records payments of what is still owed on a split to each of
+// its payers, made for that split. The member who owes it or any payer can
+// settle it; like any payment, the part owed to someone other than the
+// member settling it waits for them to confirm it. The split is locked
+// while it is checked and settled, so settling it twice at once records
+// the payments only once.
+func (s *BalanceService) SettleSplit(teamID, expenseID, splitID, actorID uuid.UUID, meta models.RequestMeta) ([]models.Settlement, error) {
+	var settlements []models.Settlement
+	err := s.db.WithTx(func(tx *database.Tx) error {
+		split, payers, err := s.getTeamSplitTx(tx, teamID, expenseID, splitID)
+		if err != nil {
+			return err
+		}
+		if split.IsSettled {
+			return ErrSplitSettled
+		}
+
+		shares, err := splitShares(payers, *split)
+		if err != nil {
+			return err
+		}
+		if actorID != split.UserID && shares[actorID] == 0 {
+			return ErrNotAuthorized
+		}
+
+		existing, err := s.settlementRepo.GetBySplitIDTx(tx, splitID)
+		if err != nil {
+			return err
+		}
+		for _, settlement := range existing {
+			if settlement.Status == models.SettlementStatusPending || settlement.Status == models.SettlementStatusDisputed {
+				return ErrSplitPaymentPending
+			}
+		}
+
+		creditors := make([]uuid.UUID, 0, len(shares))
+		for creditor := range shares {
+			creditors = append(creditors, creditor)
+		}
+		sort.Slice(creditors, func(i, j int) bool {
+			return creditors[i].String() < creditors[j].String()
+		})
+
+		allocated := make(map[uuid.UUID]models.Money, len(creditors))
+		for _, creditor := range creditors {
+			amounts, err := s.settlementRepo.GetAllocatedToTx(tx, []uuid.UUID{splitID}, creditor)
+			if err != nil {
+				return err
+			}
+			allocated[creditor] = amounts[splitID]
+		}
+
+		for _, creditor := range creditors {
+			remaining := shares[creditor] - allocated[creditor]
+			if remaining <= 0 {
+				continue
+			}
+			settlement := &models.Settlement{
+				TeamID:   teamID,
+				FromUser: split.UserID,
+				ToUser:   creditor,
+				Amount:   remaining,
+				SplitID:  &split.ID,
+			}
+			if err := s.recordSettlementTx(tx, settlement, actorID, models.AuditSettlementRecorded, meta); err != nil {
+				return err
+			}
+			settlements = append(settlements, *settlement)
+		}
+		if len(settlements) == 0 {
+			return ErrNothingOwed
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return settlements, nil
+}
+
+// UnsettleSplit reverses the confirmed payments made for a split that the
+// member is a party to, so the split is owed again. Splits paid off by a
+// settlement that covered other splits too are unsettled by reversing that
+// settlement. As in SettleSplit, the split is locked while it is checked
+// and unsettled.
+func (s *BalanceService) UnsettleSplit(teamID, expenseID, splitID, actorID uuid.UUID, meta models.RequestMeta) ([]models.Settlement, error) {
+	var reversals []models.Settlement
+	err := s.db.WithTx(func(tx *database.Tx) error {
+		split, payers, err := s.getTeamSplitTx(tx, teamID, expenseID, splitID)
+		if err != nil {
+			return err
+		}
+		shares, err := splitShares(payers, *split)
+		if err != nil {
+			return err
+		}
+		if actorID != split.UserID && shares[actorID] == 0 {
+			return ErrNotAuthorized
+		}
+
+		made, err := s.settlementRepo.GetBySplitIDTx(tx, splitID)
+		if err != nil {
+			return err
+		}
+		var originals []*models.Settlement
+		for i := range made {
+			settlement := &made[i]
+			if settlement.Status != models.SettlementStatusConfirmed || settlement.ReversesID != nil ||
+				settlement.ReversedBy != nil {
+				continue
+			}
+			if actorID == settlement.FromUser || actorID == settlement.ToUser {
+				originals = append(originals, settlement)
+			}
+		}
+		if len(originals) == 0 {
+			if split.SettledAmount > 0 {
+				return ErrSplitPaidByOthers
+			}
+			return ErrSplitNotSettled
+		}
+
+		for _, original := range originals {
+			reversal, err := s.reverseSettlementTx(tx, original, actorID, meta)
+			if err != nil {
+				return err
+			}
+			reversals = append(reversals, *reversal)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reversals, nil
+}
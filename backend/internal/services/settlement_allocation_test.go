@@ -0,0 +1,105 @@
+package services
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+// splitOf gets the member's split of the expense as it stands now.
+func (e *testEnv) splitOf(tb testing.TB, expenseID, userID uuid.UUID) models.ExpenseSplitDetail {
+	tb.Helper()
+	expense, err := e.expenses.GetExpenseByID(expenseID)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for _, split := range expense.Splits {
+		if split.User.ID == userID {
+			return split
+		}
+	}
+	tb.Fatalf("expense %s has no split for %s", expenseID, userID)
+	return models.ExpenseSplitDetail{}
+}
+
+func TestSettlementsFollowExpenseChanges(t *testing.T) {
+	env := newTestEnv(t)
+	alice, bob := env.newUser(t, "Alice"), env.newUser(t, "Bob")
+	teamID := env.newTeam(t, alice, bob)
+	first := env.newExpense(t, teamID, alice, 10000, alice, bob)
+	second := env.newExpense(t, teamID, alice, 6000, alice, bob)
+
+	// Confirmed right away as Alice records it
+	payment := &models.SettlementRequest{FromUser: bob, ToUser: alice, Amount: 6000}
+	if _, err := env.balances.RecordSettlement(teamID, payment, alice, models.RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(step string, expenseID uuid.UUID, settledAmount models.Money, settled bool) {
+		t.Helper()
+		split := env.splitOf(t, expenseID, bob)
+		if split.SettledAmount != settledAmount || split.IsSettled != settled {
+			t.Errorf("%s: Bob's split has %s settled (settled: %v), want %s (settled: %v)",
+				step, split.SettledAmount, split.IsSettled, settledAmount, settled)
+		}
+	}
+	check("after paying", first.ID, 5000, true)
+	check("after paying", second.ID, 1000, false)
+	if split := env.splitOf(t, first.ID, alice); !split.IsSettled {
+		t.Error("Alice's own share of what she paid is not settled")
+	}
+
+	amount := models.Money(20000)
+	if _, err := env.expenses.UpdateExpense(first.ID, &models.ExpenseUpdateRequest{Amount: &amount}, alice, models.RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	check("after the edit", first.ID, 6000, false)
+	check("after the edit", second.ID, 0, false)
+
+	if err := env.expenses.DeleteExpense(first.ID, alice, models.RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	check("after the delete", second.ID, 3000, true)
+
+	if _, err := env.expenses.RestoreExpense(first.ID, alice, models.RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	check("after the restore", first.ID, 6000, false)
+	check("after the restore", second.ID, 0, false)
+}
+
+func TestSettleSplitConcurrently(t *testing.T) {
+	env := newTestEnv(t)
+	alice, bob := env.newUser(t, "Alice"), env.newUser(t, "Bob")
+	teamID := env.newTeam(t, alice, bob)
+	expense := env.newExpense(t, teamID, alice, 10000, alice, bob)
+	split := env.splitOf(t, expense.ID, bob)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = env.balances.SettleSplit(teamID, expense.ID, split.ID, bob, models.RequestMeta{})
+		}(i)
+	}
+	wg.Wait()
+
+	var settled, pending int
+	for _, err := range errs {
+		switch err {
+		case nil:
+			settled++
+		case ErrSplitPaymentPending:
+			pending++
+		default:
+			t.Fatal(err)
+		}
+	}
+	if settled != 1 || pending != 1 {
+		t.Errorf("%d of 2 concurrent settlements were recorded, want 1", settled)
+	}
+}
@@ -3,25 +3,31 @@ package services
 import (
 	"errors"
 
+	"github.com/expensesplit/backend/internal/database"
 	"github.com/expensesplit/backend/internal/models"
 	"github.com/expensesplit/backend/internal/repository"
 	"github.com/google/uuid"
 )
 
 var (
-	ErrTeamNameRequired = errors.New("team name is required")
-	ErrNotAuthorized    = errors.New("not authorized to perform this action")
+	ErrTeamNameRequired   = errors.New("team name is required")
+	ErrInvalidBalanceMode = errors.New("balance mode must be pairwise or simplified")
+	ErrNotAuthorized      = errors.New("not authorized to perform this action")
 )
 
 type TeamService struct {
-	teamRepo *repository.TeamRepository
-	userRepo *repository.UserRepository
+	db        *database.DB
+	teamRepo  *repository.TeamRepository
+	userRepo  *repository.UserRepository
+	auditRepo *repository.AuditRepository
 }
 
-func NewTeamService(teamRepo *repository.TeamRepository, userRepo *repository.UserRepository) *TeamService {
+func NewTeamService(db *database.DB, teamRepo *repository.TeamRepository, userRepo *repository.UserRepository, auditRepo *repository.AuditRepository) *TeamService {
 	return &TeamService{
-		teamRepo: teamRepo,
-		userRepo: userRepo,
+		db:        db,
+		teamRepo:  teamRepo,
+		userRepo:  userRepo,
+		auditRepo: auditRepo,
 	}
 }
 
@@ -30,8 +36,26 @@ func (s *TeamService) CreateTeam(req *models.TeamCreateRequest, creatorID uuid.U
 		return nil, ErrTeamNameRequired
 	}
 
+	baseCurrency := models.DefaultCurrency
+	if req.BaseCurrency != "" {
+		currency, err := models.NormalizeCurrency(req.BaseCurrency)
+		if err != nil {
+			return nil, err
+		}
+		baseCurrency = currency
+	}
+
+	if req.BalanceMode == "" {
+		req.BalanceMode = models.BalanceModePairwise
+	}
+	if !models.IsValidBalanceMode(req.BalanceMode) {
+		return nil, ErrInvalidBalanceMode
+	}
+
 	team := &models.Team{
-		Name: req.Name,
+		Name:         req.Name,
+		BaseCurrency: baseCurrency,
+		BalanceMode:  req.BalanceMode,
 	}
 
 	if err := s.teamRepo.Create(team, creatorID); err != nil {
@@ -77,7 +101,7 @@ func (s *TeamService) GetUserTeams(userID uuid.UUID) ([]*models.TeamResponse, er
 	return responses, nil
 }
 
-func (s *TeamService) AddMember(teamID uuid.UUID, req *models.AddMemberRequest, requesterID uuid.UUID) error {
+func (s *TeamService) AddMember(teamID uuid.UUID, req *models.AddMemberRequest, requesterID uuid.UUID, meta models.RequestMeta) error {
 	// Check if requester is admin
 	isAdmin, err := s.teamRepo.IsAdmin(teamID, requesterID)
 	if err != nil {
@@ -98,10 +122,17 @@ func (s *TeamService) AddMember(teamID uuid.UUID, req *models.AddMemberRequest,
 		role = "member"
 	}
 
-	return s.teamRepo.AddMember(teamID, user.ID, role)
+	return s.db.WithTx(func(tx *database.Tx) error {
+		member := &models.TeamMember{TeamID: teamID, UserID: user.ID, Role: role}
+		if err := s.teamRepo.AddMemberTx(tx, member); err != nil {
+			return err
+		}
+		event := memberAuditEvent(teamID, user.ID, requesterID, models.AuditMemberAdded, meta)
+		return recordAudit(s.auditRepo, tx, event, nil, member)
+	})
 }
 
-func (s *TeamService) RemoveMember(teamID, userID, requesterID uuid.UUID) error {
+func (s *TeamService) RemoveMember(teamID, userID, requesterID uuid.UUID, meta models.RequestMeta) error {
 	// Check if requester is admin
 	isAdmin, err := s.teamRepo.IsAdmin(teamID, requesterID)
 	if err != nil {
@@ -111,10 +142,31 @@ func (s *TeamService) RemoveMember(teamID, userID, requesterID uuid.UUID) error
 		return ErrNotAuthorized
 	}
 
-	return s.teamRepo.RemoveMember(teamID, userID)
+	before, err := s.teamRepo.GetMember(teamID, userID)
+	if err != nil {
+		return err
+	}
+	return s.db.WithTx(func(tx *database.Tx) error {
+		if err := s.teamRepo.RemoveMemberTx(tx, teamID, userID); err != nil {
+			return err
+		}
+		event := memberAuditEvent(teamID, userID, requesterID, models.AuditMemberRemoved, meta)
+		return recordAudit(s.auditRepo, tx, event, before, nil)
+	})
+}
+
+func memberAuditEvent(teamID, memberID, actorID uuid.UUID, action models.AuditAction, meta models.RequestMeta) models.AuditEvent {
+	return models.AuditEvent{
+		TeamID:      teamID,
+		ActorID:     actorID,
+		Action:      action,
+		EntityType:  models.AuditEntityMember,
+		EntityID:    memberID,
+		RequestMeta: meta,
+	}
 }
 
-func (s *TeamService) UpdateTeam(teamID uuid.UUID, name string, requesterID uuid.UUID) (*models.TeamResponse, error) {
+func (s *TeamService) UpdateTeam(teamID uuid.UUID, req *models.TeamUpdateRequest, requesterID uuid.UUID, meta models.RequestMeta) (*models.TeamResponse, error) {
 	// Check if requester is admin
 	isAdmin, err := s.teamRepo.IsAdmin(teamID, requesterID)
 	if err != nil {
@@ -129,8 +181,34 @@ func (s *TeamService) UpdateTeam(teamID uuid.UUID, name string, requesterID uuid
 		return nil, err
 	}
 
-	team.Name = name
-	if err := s.teamRepo.Update(team); err != nil {
+	before := *team
+	if req.Name != nil {
+		if *req.Name == "" {
+			return nil, ErrTeamNameRequired
+		}
+		team.Name = *req.Name
+	}
+	if req.BalanceMode != nil {
+		if !models.IsValidBalanceMode(*req.BalanceMode) {
+			return nil, ErrInvalidBalanceMode
+		}
+		team.BalanceMode = *req.BalanceMode
+	}
+	err = s.db.WithTx(func(tx *database.Tx) error {
+		if err := s.teamRepo.UpdateTx(tx, team); err != nil {
+			return err
+		}
+		event := models.AuditEvent{
+			TeamID:      teamID,
+			ActorID:     requesterID,
+			Action:      models.AuditTeamUpdated,
+			EntityType:  models.AuditEntityTeam,
+			EntityID:    teamID,
+			RequestMeta: meta,
+		}
+		return recordAudit(s.auditRepo, tx, event, before, team)
+	})
+	if err != nil {
 		return nil, err
 	}
 
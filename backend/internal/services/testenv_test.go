@@ -0,0 +1,114 @@
+package services
+
+import (
+	"os"
+	"testing"
+
+	"github.com/expensesplit/backend/internal/database"
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/expensesplit/backend/internal/repository"
+	"github.com/google/uuid"
+)
+
+// testEnv is the services wired to the database given by
+// TEST_DATABASE_URL, as in the server. Tests using it are skipped when the
+// variable is not set. Every test creates its own users and teams, so they
+// can share a database.
+type testEnv struct {
+	db         *database.DB
+	users      *repository.UserRepository
+	teamRepo   *repository.TeamRepository
+	teams      *TeamService
+	categories *CategoryService
+	expenses   *ExpenseService
+	balances   *BalanceService
+}
+
+func newTestEnv(tb testing.TB) *testEnv {
+	tb.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		tb.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := database.New(url)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	if err := db.RunMigrations(); err != nil {
+		tb.Fatal(err)
+	}
+
+	userRepo := repository.NewUserRepository(db)
+	teamRepo := repository.NewTeamRepository(db)
+	expenseRepo := repository.NewExpenseRepository(db)
+	auditRepo := repository.NewAuditRepository(db)
+	balanceRepo := repository.NewBalanceRepository(db)
+	categoryRepo := repository.NewCategoryRepository(db)
+	revisionRepo := repository.NewExpenseRevisionRepository(db)
+	settlementRepo := repository.NewSettlementRepository(db)
+	categories := NewCategoryService(db, categoryRepo, teamRepo, expenseRepo, revisionRepo, auditRepo)
+	return &testEnv{
+		db:         db,
+		users:      userRepo,
+		teamRepo:   teamRepo,
+		teams:      NewTeamService(db, teamRepo, userRepo, auditRepo),
+		categories: categories,
+		expenses: NewExpenseService(db, expenseRepo, teamRepo, userRepo, repository.NewApprovalRepository(db), auditRepo,
+			revisionRepo, balanceRepo, settlementRepo,
+			NewExchangeRateService(repository.NewExchangeRateRepository(db)),
+			categories, NewBudgetService(repository.NewBudgetRepository(db), teamRepo, categoryRepo)),
+		balances: NewBalanceService(db, expenseRepo, teamRepo, userRepo, settlementRepo, balanceRepo,
+			repository.NewBalanceSnapshotRepository(db), revisionRepo, auditRepo),
+	}
+}
+
+func (e *testEnv) newUser(tb testing.TB, name string) uuid.UUID {
+	tb.Helper()
+	user := &models.User{Email: uuid.NewString() + "@example.com", PasswordHash: "-", Name: name}
+	if err := e.users.Create(user); err != nil {
+		tb.Fatal(err)
+	}
+	return user.ID
+}
+
+// newTeam creates a team of the given members. The first one creates it.
+func (e *testEnv) newTeam(tb testing.TB, members ...uuid.UUID) uuid.UUID {
+	tb.Helper()
+	team, err := e.teams.CreateTeam(&models.TeamCreateRequest{Name: "Test team"}, members[0])
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for _, member := range members[1:] {
+		if err := e.teamRepo.AddMember(team.ID, member, "member"); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return team.ID
+}
+
+// newExpense records an expense paid by paidBy and split equally between
+// splitWith.
+func (e *testEnv) newExpense(tb testing.TB, teamID, paidBy uuid.UUID, amount models.Money, splitWith ...uuid.UUID) *models.ExpenseResponse {
+	tb.Helper()
+	expense, err := e.expenses.CreateExpense(teamID, paidBy, &models.ExpenseCreateRequest{
+		Amount:      amount,
+		Description: "Test expense",
+		SplitType:   models.SplitTypeEqual,
+		SplitWith:   splitWith,
+	}, models.RequestMeta{})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return expense
+}
+
+// owes is what from owes to in the summary's pairwise balances.
+func owes(summary *models.TeamBalanceSummary, from, to uuid.UUID) models.Money {
+	for _, balance := range summary.Balances {
+		if balance.FromUser.ID == from && balance.ToUser.ID == to {
+			return balance.Amount
+		}
+	}
+	return 0
+}
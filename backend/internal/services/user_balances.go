@@ -0,0 +1,161 @@
+package services
+
+import (
+	"sort"
+
+	"github.com/expensesplit/backend/internal/models"
+	"github.com/expensesplit/backend/internal/repository"
+	"github.com/google/uuid"
+)
+
+// GetUserBalances sums up what userID owes and is owed in every team they
+// belong to, with the same figures as each team's balances/me, and rolls
+// them up per counterparty. With net set, what userID and a counterparty
+// owe each other in different teams of the same currency cancels out.
+// The balances of all teams are loaded together, so the number of queries
+// doesn't grow with the number of teams.
+func (s *BalanceService) GetUserBalances(userID uuid.UUID, net bool) (*models.UserBalances, error) {
+	teams, err := s.teamRepo.GetUserTeams(userID)
+	if err != nil {
+		return nil, err
+	}
+	teamIDs := make([]uuid.UUID, len(teams))
+	for i, team := range teams {
+		teamIDs[i] = team.ID
+	}
+	stored, err := s.balanceRepo.GetByTeamIDs(teamIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	type counterpartyKey struct {
+		userID   uuid.UUID
+		currency string
+	}
+	counterparties := make(map[counterpartyKey]*models.CounterpartyBalance)
+	var order []counterpartyKey
+	userIDs := []uuid.UUID{userID}
+
+	teamBalances := make([]models.TeamUserBalance, 0, len(teams))
+	for _, team := range teams {
+		balanceMap := make(map[uuid.UUID]map[uuid.UUID]models.Money)
+		for _, balance := range stored[team.ID] {
+			if balanceMap[balance.FromUser] == nil {
+				balanceMap[balance.FromUser] = make(map[uuid.UUID]models.Money)
+			}
+			balanceMap[balance.FromUser][balance.ToUser] = balance.Amount
+		}
+		_, transfers := s.suggestTransfers(team.BalanceMode, balanceMap)
+
+		// Follow the suggested transfers, as member totals do
+		summary := models.UserBalanceSummary{}
+		for _, t := range transfers {
+			var otherID uuid.UUID
+			var amount models.Money // Positive = they owe you
+			switch userID {
+			case t.from:
+				otherID, amount = t.to, -t.amount
+				summary.TotalOwed += t.amount
+			case t.to:
+				otherID, amount = t.from, t.amount
+				summary.TotalOwing += t.amount
+			default:
+				continue
+			}
+			summary.NetBalance += amount
+
+			key := counterpartyKey{userID: otherID, currency: team.BaseCurrency}
+			counterparty, ok := counterparties[key]
+			if !ok {
+				counterparty = &models.CounterpartyBalance{Currency: team.BaseCurrency}
+				counterparties[key] = counterparty
+				order = append(order, key)
+				userIDs = append(userIDs, otherID)
+			}
+			if amount > 0 {
+				counterparty.TotalOwing += amount
+			} else {
+				counterparty.TotalOwed -= amount
+			}
+			counterparty.NetBalance += amount
+			counterparty.Teams = append(counterparty.Teams, models.TeamNetBalance{
+				TeamID:     team.ID,
+				TeamName:   team.Name,
+				NetBalance: amount,
+			})
+		}
+
+		teamBalances = append(teamBalances, models.TeamUserBalance{
+			TeamID:      team.ID,
+			TeamName:    team.Name,
+			Currency:    team.BaseCurrency,
+			BalanceMode: team.BalanceMode,
+			Summary:     summary,
+		})
+	}
+
+	users, err := s.userRepo.GetByIDs(userIDs)
+	if err != nil {
+		return nil, err
+	}
+	user, ok := users[userID]
+	if !ok {
+		return nil, repository.ErrUserNotFound
+	}
+	for i := range teamBalances {
+		teamBalances[i].Summary.User = user.ToResponse()
+	}
+
+	totals := make(map[string]*models.CurrencyBalance)
+	counterpartySlice := make([]models.CounterpartyBalance, 0, len(order))
+	for _, key := range order {
+		counterparty := counterparties[key]
+		other, ok := users[key.userID]
+		if !ok {
+			continue
+		}
+		counterparty.User = other.ToResponse()
+		if net {
+			counterparty.TotalOwed, counterparty.TotalOwing = 0, 0
+			if counterparty.NetBalance > 0 {
+				counterparty.TotalOwing = counterparty.NetBalance
+			} else {
+				counterparty.TotalOwed = -counterparty.NetBalance
+			}
+		}
+
+		total, ok := totals[key.currency]
+		if !ok {
+			total = &models.CurrencyBalance{Currency: key.currency}
+			totals[key.currency] = total
+		}
+		total.TotalOwed += counterparty.TotalOwed
+		total.TotalOwing += counterparty.TotalOwing
+		total.NetBalance += counterparty.NetBalance
+
+		counterpartySlice = append(counterpartySlice, *counterparty)
+	}
+	sort.SliceStable(counterpartySlice, func(i, j int) bool {
+		a, b := counterpartySlice[i], counterpartySlice[j]
+		if a.Currency != b.Currency {
+			return a.Currency < b.Currency
+		}
+		return a.User.Name < b.User.Name
+	})
+
+	totalSlice := make([]models.CurrencyBalance, 0, len(totals))
+	for _, total := range totals {
+		totalSlice = append(totalSlice, *total)
+	}
+	sort.Slice(totalSlice, func(i, j int) bool {
+		return totalSlice[i].Currency < totalSlice[j].Currency
+	})
+
+	return &models.UserBalances{
+		User:           user.ToResponse(),
+		Netted:         net,
+		Totals:         totalSlice,
+		Counterparties: counterpartySlice,
+		Teams:          teamBalances,
+	}, nil
+}
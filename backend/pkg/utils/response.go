@@ -19,10 +19,11 @@ type PaginatedResponse struct {
 }
 
 type PaginationMeta struct {
-	Page       int   `json:"page"`
-	PerPage    int   `json:"per_page"`
-	Total      int64 `json:"total"`
-	TotalPages int   `json:"total_pages"`
+	Page       int    `json:"page,omitempty"` // Not set when paging by cursor
+	PerPage    int    `json:"per_page"`
+	Total      int64  `json:"total"`
+	TotalPages int    `json:"total_pages"`
+	NextCursor string `json:"next_cursor,omitempty"` // Empty on the last page
 }
 
 // JSON sends a JSON response with the given status code
@@ -85,6 +86,12 @@ func InternalError(w http.ResponseWriter, message string) {
 
 // Paginated sends a paginated JSON response
 func Paginated(w http.ResponseWriter, data interface{}, page, perPage int, total int64) {
+	CursorPaginated(w, data, page, perPage, total, "")
+}
+
+// CursorPaginated sends a paginated JSON response with the cursor of the
+// next page
+func CursorPaginated(w http.ResponseWriter, data interface{}, page, perPage int, total int64, nextCursor string) {
 	totalPages := int(total) / perPage
 	if int(total)%perPage > 0 {
 		totalPages++
@@ -98,6 +105,7 @@ func Paginated(w http.ResponseWriter, data interface{}, page, perPage int, total
 			PerPage:    perPage,
 			Total:      total,
 			TotalPages: totalPages,
+			NextCursor: nextCursor,
 		},
 	})
 }
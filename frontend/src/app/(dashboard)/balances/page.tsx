@@ -32,19 +32,18 @@ export default function BalancesPage() {
   const { data, isLoading } = useQuery({
     queryKey: ['all-balances'],
     queryFn: async () => {
-      const teamsRes = await api.get('/teams');
-      const teams = teamsRes.data.data || [];
+      const res = await api.get('/me/balances');
+      const teams = res.data.data.teams || [];
       
       const balances: TeamBalance[] = [];
       let owe = 0;
       let owed = 0;
 
       for (const team of teams) {
-        const balRes = await api.get(`/teams/${team.id}/balances/me`);
-        const amount = balRes.data.data.net_balance;
+        const amount = team.summary.net_balance;
         balances.push({
-          team_id: team.id,
-          team_name: team.name,
+          team_id: team.team_id,
+          team_name: team.team_name,
           balance: amount
         });
         